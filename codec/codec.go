@@ -0,0 +1,64 @@
+package codec
+
+import (
+	"fmt"
+	"strings"
+	"wisp/common"
+)
+
+// SchemaVersion is the version of the market event schema written by all codecs.
+// Decoders reject events with a newer version than they know.
+// Version 2 added the instrument, exchange and receive times and the sequence.
+const SchemaVersion = 2
+
+const (
+	JSON     = "json"
+	Protobuf = "protobuf"
+	MsgPack  = "msgpack"
+)
+
+// Codec encodes market events for sinks and websocket clients
+type Codec interface {
+	Name() string
+	ContentType() string
+	// Binary reports whether the encoding must be sent in binary websocket frames
+	Binary() bool
+	Encode(ev *common.MarketEvent) ([]byte, error)
+	Decode(data []byte) (*common.MarketEvent, error)
+}
+
+var codecs = []Codec{jsonCodec{}, protobufCodec{}, msgpackCodec{}}
+
+// Get returns the codec with the given name, an empty name selects JSON
+func Get(name string) (Codec, error) {
+	if name == "" {
+		name = JSON
+	}
+	for _, c := range codecs {
+		if c.Name() == strings.ToLower(name) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("codec: unknown encoding %q", name)
+}
+
+// ByContentType returns the codec producing contentType, parameters are ignored
+func ByContentType(contentType string) (Codec, error) {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	for _, c := range codecs {
+		if c.ContentType() == contentType {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("codec: unknown content type %q", contentType)
+}
+
+func checkVersion(v uint32) error {
+	if v == 0 || v > SchemaVersion {
+		return fmt.Errorf("codec: unsupported schema version %d", v)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package codec
+
+import (
+	"bytes"
+	"github.com/vmihailenco/msgpack/v4"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"wisp/common"
+)
+
+// testEvents returns one event per channel with every field set
+func testEvents() []*common.MarketEvent {
+	d := common.MustDecimal
+	events := []*common.MarketEvent{
+		common.NewDepthEvent(common.BINANCE, &common.Depth{
+			Symbol:       "btcusdt",
+			LastUpdateId: 1027024,
+			UTime:        time.Unix(0, 1500000000123*int64(time.Millisecond)).UTC(),
+			AskList:      common.DepthRecords{{Price: d("4.00000200"), Amount: d("12")}, {Price: d("4.1"), Amount: d("1")}},
+			BidList:      common.DepthRecords{{Price: d("4.00000000"), Amount: d("431.00000000")}},
+		}),
+		common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt", Last: d("9500.5"), Buy: d("9500.4"), Sell: d("9500.6"), High: d("9800"), Low: d("9100"), Vol: d("1234.5678"), Date: 1500000000000}),
+		common.NewKlineEvent(common.BINANCE, &common.Kline{Symbol: "btcusdt", Timestamp: 1499040000000, Open: d("0.0163479"), Close: d("0.015771"), High: d("0.8"), Low: d("0.015758"), Vol: d("148976.11427815")}, common.KLINE_PERIOD_1H),
+		common.NewTradeEvent(common.BINANCE, &common.Trade{Symbol: "btcusdt", Tid: 28457, Price: d("4.000001"), Amount: d("12"), Side: common.TRADE_SIDE_SELL, Timestamp: 1499865549590}),
+		common.NewExecutionReportEvent(common.BINANCE, &common.ExecutionReport{
+			Symbol:            "ETHBTC",
+			ClientOrderId:     "mUvoqJxFIILMdfAW5iGSOW",
+			Side:              "BUY",
+			OrderType:         "LIMIT",
+			TimeInForce:       "GTC",
+			ExecutionType:     "TRADE",
+			Status:            "PARTIALLY_FILLED",
+			OrderId:           4293153,
+			TradeId:           718,
+			Price:             d("0.10264410"),
+			Quantity:          d("1.00000000"),
+			LastExecutedQty:   d("0.5"),
+			CumulativeQty:     d("0.5"),
+			LastExecutedPrice: d("0.102644"),
+			Commission:        d("0.0005"),
+			CommissionAsset:   "BNB",
+			EventTime:         1499405658658,
+			TransactTime:      1499405658657,
+		}),
+		common.NewAccountPositionEvent(common.BINANCE, &common.AccountPosition{
+			EventTime:      1564034571105,
+			LastUpdateTime: 1564034571073,
+			Balances: []common.AssetBalance{
+				{Asset: "ETH", Free: d("10000.000000"), Locked: d("0")},
+				{Asset: "BTC", Free: d("0.5"), Locked: d("0.25")},
+			},
+		}),
+		common.NewBalanceUpdateEvent(common.BINANCE, &common.BalanceUpdate{Asset: "BTC", Delta: d("-100.5"), EventTime: 1573200697110, ClearTime: 1573200697068}),
+	}
+	for i, ev := range events {
+		ev.Instrument = common.Instrument{Base: "BTC", Quote: "USDT", Venue: common.BINANCE, Type: common.INSTRUMENT_SPOT}
+		ev.ExchangeTime = 1500000000000 + int64(i)
+		ev.ReceiveTime = 1500000000100 + int64(i)
+		ev.Sequence = uint64(i + 1)
+	}
+	return events
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		for _, want := range testEvents() {
+			t.Run(c.Name()+"/"+want.Channel, func(t *testing.T) {
+				data, err := c.Encode(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := c.Decode(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if depth, ok := got.Data.(*common.Depth); ok {
+					depth.UTime = depth.UTime.UTC()
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("decoded %+v (%+v), want %+v (%+v)", got, got.Data, want, want.Data)
+				}
+				if got.Topic() != want.Topic() {
+					t.Errorf("topic = %s, want %s", got.Topic(), want.Topic())
+				}
+			})
+		}
+	}
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// field is a length-delimited string field with the given tag
+func field(tag byte, s string) []byte {
+	return append([]byte{tag, byte(len(s))}, s...)
+}
+
+// klineGolden is a kline event laid out field by field as in market.proto,
+// it fails if a field number or wire type of the protobuf codec changes
+var klineGolden = join(
+	[]byte{0x08, 0x02},       // 1 version: 2
+	field(0x12, "binance"),   // 2 venue
+	field(0x1a, "btcusdt"),   // 3 symbol
+	field(0x22, "kline"),     // 4 channel
+	field(0x2a, "1m"),        // 5 period
+	[]byte{0x32, 17},         // 6 instrument, 17 bytes
+	field(0x0a, "BTC"),       //   1 base
+	field(0x12, "USDT"),      //   2 quote, 3 venue omitted
+	field(0x22, "spot"),      //   4 type
+	[]byte{0x38, 0xe8, 0x07}, // 7 exchange_time: 1000
+	[]byte{0x40, 0xe9, 0x07}, // 8 receive_time: 1001
+	[]byte{0x48, 0x07},       // 9 sequence: 7
+	[]byte{0x62, 24},         // 12 kline, 24 bytes
+	[]byte{0x08, 0xc0, 0x07}, //   1 timestamp: 960
+	field(0x12, "1.5"),       //   2 open
+	field(0x1a, "2"),         //   3 close
+	field(0x22, "2.25"),      //   4 high
+	field(0x2a, "1"),         //   5 low
+	field(0x32, "10"),        //   6 vol
+)
+
+func TestProtobufGolden(t *testing.T) {
+	d := common.MustDecimal
+	ev := common.NewKlineEvent(common.BINANCE, &common.Kline{Symbol: "btcusdt", Timestamp: 960, Open: d("1.5"), Close: d("2"), High: d("2.25"), Low: d("1"), Vol: d("10")}, common.KLINE_PERIOD_1MIN)
+	ev.Instrument = common.Instrument{Base: "BTC", Quote: "USDT", Type: common.INSTRUMENT_SPOT}
+	ev.ExchangeTime = 1000
+	ev.ReceiveTime = 1001
+	ev.Sequence = 7
+
+	c, _ := Get(Protobuf)
+	data, err := c.Encode(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, klineGolden) {
+		t.Errorf("encoded\n% x\nwant\n% x", data, klineGolden)
+	}
+	got, err := c.Decode(klineGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ev) {
+		t.Errorf("decoded %+v, want %+v", got, ev)
+	}
+}
+
+func TestRejectSchemaVersion(t *testing.T) {
+	w, err := toWire(testEvents()[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgpackVersion := func(v uint32) []byte {
+		w.Version = v
+		data, _ := msgpack.Marshal(w)
+		return data
+	}
+	tests := []struct {
+		codec string
+		data  []byte
+	}{
+		{JSON, []byte(`{"v":3,"venue":"binance","symbol":"btcusdt","channel":"ticker","data":{}}`)},
+		{JSON, []byte(`{"venue":"binance","symbol":"btcusdt","channel":"ticker","data":{}}`)},
+		{Protobuf, join([]byte{0x08, 0x03}, field(0x22, "ticker"), []byte{0x5a, 0})},
+		{Protobuf, join(field(0x22, "ticker"), []byte{0x5a, 0})},
+		{MsgPack, msgpackVersion(SchemaVersion + 1)},
+		{MsgPack, msgpackVersion(0)},
+	}
+	for _, tt := range tests {
+		c, _ := Get(tt.codec)
+		ev, err := c.Decode(tt.data)
+		if err == nil || !strings.Contains(err.Error(), "unsupported schema version") {
+			t.Errorf("%s: decoded %+v, %v, want unsupported schema version", tt.codec, ev, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"wisp/common"
+)
+
+// jsonEvent is the JSON envelope, data keeps the JSON form of the common models
+type jsonEvent struct {
+	Version      uint32            `json:"v"`
+	Topic        string            `json:"topic"`
+	Venue        string            `json:"venue"`
+	Symbol       string            `json:"symbol"`
+	Instrument   common.Instrument `json:"instrument"`
+	Channel      string            `json:"channel"`
+	Period       string            `json:"period,omitempty"`
+	ExchangeTime int64             `json:"exchangeTime,omitempty"`
+	ReceiveTime  int64             `json:"receiveTime"`
+	Sequence     uint64            `json:"seq"`
+	Data         interface{}       `json:"data"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return JSON
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
+
+func (jsonCodec) Encode(ev *common.MarketEvent) ([]byte, error) {
+	return json.Marshal(jsonEvent{
+		Version:      SchemaVersion,
+		Topic:        ev.Topic(),
+		Venue:        ev.Venue,
+		Symbol:       ev.Symbol,
+		Instrument:   ev.Instrument,
+		Channel:      ev.Channel,
+		Period:       ev.Period,
+		ExchangeTime: ev.ExchangeTime,
+		ReceiveTime:  ev.ReceiveTime,
+		Sequence:     ev.Sequence,
+		Data:         ev.Data,
+	})
+}
+
+func (jsonCodec) Decode(data []byte) (*common.MarketEvent, error) {
+	raw := json.RawMessage{}
+	je := jsonEvent{Data: &raw}
+	if err := json.Unmarshal(data, &je); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(je.Version); err != nil {
+		return nil, err
+	}
+
+	ev := &common.MarketEvent{
+		Venue:        je.Venue,
+		Symbol:       je.Symbol,
+		Instrument:   je.Instrument,
+		Channel:      je.Channel,
+		Period:       je.Period,
+		ExchangeTime: je.ExchangeTime,
+		ReceiveTime:  je.ReceiveTime,
+		Sequence:     je.Sequence,
+	}
+	switch ev.Channel {
+	case common.CHANNEL_DEPTH:
+		ev.Data = new(common.Depth)
+	case common.CHANNEL_TICKER:
+		ev.Data = new(common.Ticker)
+	case common.CHANNEL_KLINE:
+		ev.Data = new(common.Kline)
+	case common.CHANNEL_TRADE:
+		ev.Data = new(common.Trade)
+	case common.CHANNEL_EXECUTION_REPORT:
+		ev.Data = new(common.ExecutionReport)
+	case common.CHANNEL_ACCOUNT_POSITION:
+		ev.Data = new(common.AccountPosition)
+	case common.CHANNEL_BALANCE_UPDATE:
+		ev.Data = new(common.BalanceUpdate)
+	default:
+		return nil, fmt.Errorf("codec: unknown channel %q", ev.Channel)
+	}
+	if err := json.Unmarshal(raw, ev.Data); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
@@ -0,0 +1,36 @@
+package codec
+
+import (
+	"github.com/vmihailenco/msgpack/v4"
+	"wisp/common"
+)
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return MsgPack
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Binary() bool {
+	return true
+}
+
+func (msgpackCodec) Encode(ev *common.MarketEvent) ([]byte, error) {
+	w, err := toWire(ev)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(w)
+}
+
+func (msgpackCodec) Decode(data []byte) (*common.MarketEvent, error) {
+	w := &wireEvent{}
+	if err := msgpack.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+	return fromWire(w)
+}
@@ -0,0 +1,436 @@
+package codec
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"wisp/common"
+)
+
+// protobufCodec writes the messages of market.proto with protowire, so no
+// generated code is needed. Field numbers must stay in sync with market.proto.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return Protobuf
+}
+
+func (protobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (protobufCodec) Binary() bool {
+	return true
+}
+
+func (protobufCodec) Encode(ev *common.MarketEvent) ([]byte, error) {
+	w, err := toWire(ev)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	b = appendVarint(b, 1, uint64(w.Version))
+	b = appendString(b, 2, w.Venue)
+	b = appendString(b, 3, w.Symbol)
+	b = appendString(b, 4, w.Channel)
+	b = appendString(b, 5, w.Period)
+	if w.Instrument != nil {
+		var m []byte
+		m = appendString(m, 1, w.Instrument.Base)
+		m = appendString(m, 2, w.Instrument.Quote)
+		m = appendString(m, 3, w.Instrument.Venue)
+		m = appendString(m, 4, w.Instrument.Type)
+		b = appendMessage(b, 6, m)
+	}
+	b = appendVarint(b, 7, uint64(w.ExchangeTime))
+	b = appendVarint(b, 8, uint64(w.ReceiveTime))
+	b = appendVarint(b, 9, w.Sequence)
+	switch {
+	case w.Depth != nil:
+		var m []byte
+		m = appendVarint(m, 1, uint64(w.Depth.LastUpdateId))
+		m = appendVarint(m, 2, uint64(w.Depth.Time))
+		m = appendLevels(m, 3, w.Depth.Asks)
+		m = appendLevels(m, 4, w.Depth.Bids)
+		b = appendMessage(b, 10, m)
+	case w.Ticker != nil:
+		var m []byte
+		m = appendString(m, 1, w.Ticker.Last)
+		m = appendString(m, 2, w.Ticker.Buy)
+		m = appendString(m, 3, w.Ticker.Sell)
+		m = appendString(m, 4, w.Ticker.High)
+		m = appendString(m, 5, w.Ticker.Low)
+		m = appendString(m, 6, w.Ticker.Vol)
+		m = appendVarint(m, 7, w.Ticker.Date)
+		b = appendMessage(b, 11, m)
+	case w.Kline != nil:
+		var m []byte
+		m = appendVarint(m, 1, uint64(w.Kline.Timestamp))
+		m = appendString(m, 2, w.Kline.Open)
+		m = appendString(m, 3, w.Kline.Close)
+		m = appendString(m, 4, w.Kline.High)
+		m = appendString(m, 5, w.Kline.Low)
+		m = appendString(m, 6, w.Kline.Vol)
+		b = appendMessage(b, 12, m)
+	case w.Trade != nil:
+		var m []byte
+		m = appendVarint(m, 1, uint64(w.Trade.Tid))
+		m = appendString(m, 2, w.Trade.Price)
+		m = appendString(m, 3, w.Trade.Amount)
+		m = appendString(m, 4, w.Trade.Side)
+		m = appendVarint(m, 5, uint64(w.Trade.Timestamp))
+		b = appendMessage(b, 13, m)
+	case w.ExecutionReport != nil:
+		r := w.ExecutionReport
+		var m []byte
+		m = appendString(m, 1, r.ClientOrderId)
+		m = appendString(m, 2, r.Side)
+		m = appendString(m, 3, r.OrderType)
+		m = appendString(m, 4, r.TimeInForce)
+		m = appendString(m, 5, r.ExecutionType)
+		m = appendString(m, 6, r.Status)
+		m = appendVarint(m, 7, uint64(r.OrderId))
+		m = appendVarint(m, 8, uint64(r.TradeId))
+		m = appendString(m, 9, r.Price)
+		m = appendString(m, 10, r.Quantity)
+		m = appendString(m, 11, r.LastExecutedQty)
+		m = appendString(m, 12, r.CumulativeQty)
+		m = appendString(m, 13, r.LastExecutedPrice)
+		m = appendString(m, 14, r.Commission)
+		m = appendString(m, 15, r.CommissionAsset)
+		m = appendVarint(m, 16, r.EventTime)
+		m = appendVarint(m, 17, r.TransactTime)
+		b = appendMessage(b, 14, m)
+	case w.AccountPosition != nil:
+		var m []byte
+		m = appendVarint(m, 1, w.AccountPosition.EventTime)
+		m = appendVarint(m, 2, w.AccountPosition.LastUpdateTime)
+		for _, balance := range w.AccountPosition.Balances {
+			var bm []byte
+			bm = appendString(bm, 1, balance.Asset)
+			bm = appendString(bm, 2, balance.Free)
+			bm = appendString(bm, 3, balance.Locked)
+			m = appendMessage(m, 3, bm)
+		}
+		b = appendMessage(b, 15, m)
+	case w.BalanceUpdate != nil:
+		var m []byte
+		m = appendString(m, 1, w.BalanceUpdate.Asset)
+		m = appendString(m, 2, w.BalanceUpdate.Delta)
+		m = appendVarint(m, 3, w.BalanceUpdate.EventTime)
+		m = appendVarint(m, 4, w.BalanceUpdate.ClearTime)
+		b = appendMessage(b, 16, m)
+	}
+	return b, nil
+}
+
+func (protobufCodec) Decode(data []byte) (*common.MarketEvent, error) {
+	w := &wireEvent{}
+	err := decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			w.Version = uint32(v)
+		case 2:
+			w.Venue = string(data)
+		case 3:
+			w.Symbol = string(data)
+		case 4:
+			w.Channel = string(data)
+		case 5:
+			w.Period = string(data)
+		case 6:
+			w.Instrument = &wireInstrument{}
+			return decodeInstrument(w.Instrument, data)
+		case 7:
+			w.ExchangeTime = int64(v)
+		case 8:
+			w.ReceiveTime = int64(v)
+		case 9:
+			w.Sequence = v
+		case 10:
+			w.Depth = &wireDepth{}
+			return decodeDepth(w.Depth, data)
+		case 11:
+			w.Ticker = &wireTicker{}
+			return decodeTicker(w.Ticker, data)
+		case 12:
+			w.Kline = &wireKline{}
+			return decodeKline(w.Kline, data)
+		case 13:
+			w.Trade = &wireTrade{}
+			return decodeTrade(w.Trade, data)
+		case 14:
+			w.ExecutionReport = &wireExecutionReport{}
+			return decodeExecutionReport(w.ExecutionReport, data)
+		case 15:
+			w.AccountPosition = &wireAccountPosition{}
+			return decodeAccountPosition(w.AccountPosition, data)
+		case 16:
+			w.BalanceUpdate = &wireBalanceUpdate{}
+			return decodeBalanceUpdate(w.BalanceUpdate, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromWire(w)
+}
+
+func decodeInstrument(i *wireInstrument, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			i.Base = string(data)
+		case 2:
+			i.Quote = string(data)
+		case 3:
+			i.Venue = string(data)
+		case 4:
+			i.Type = string(data)
+		}
+		return nil
+	})
+}
+
+func decodeDepth(d *wireDepth, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			d.LastUpdateId = int64(v)
+		case 2:
+			d.Time = int64(v)
+		case 3, 4:
+			l := wireLevel{}
+			err := decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					l.Price = string(data)
+				case 2:
+					l.Amount = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if num == 3 {
+				d.Asks = append(d.Asks, l)
+			} else {
+				d.Bids = append(d.Bids, l)
+			}
+		}
+		return nil
+	})
+}
+
+func decodeTicker(t *wireTicker, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			t.Last = string(data)
+		case 2:
+			t.Buy = string(data)
+		case 3:
+			t.Sell = string(data)
+		case 4:
+			t.High = string(data)
+		case 5:
+			t.Low = string(data)
+		case 6:
+			t.Vol = string(data)
+		case 7:
+			t.Date = v
+		}
+		return nil
+	})
+}
+
+func decodeKline(k *wireKline, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			k.Timestamp = int64(v)
+		case 2:
+			k.Open = string(data)
+		case 3:
+			k.Close = string(data)
+		case 4:
+			k.High = string(data)
+		case 5:
+			k.Low = string(data)
+		case 6:
+			k.Vol = string(data)
+		}
+		return nil
+	})
+}
+
+func decodeTrade(t *wireTrade, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			t.Tid = int64(v)
+		case 2:
+			t.Price = string(data)
+		case 3:
+			t.Amount = string(data)
+		case 4:
+			t.Side = string(data)
+		case 5:
+			t.Timestamp = int64(v)
+		}
+		return nil
+	})
+}
+
+func decodeExecutionReport(r *wireExecutionReport, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			r.ClientOrderId = string(data)
+		case 2:
+			r.Side = string(data)
+		case 3:
+			r.OrderType = string(data)
+		case 4:
+			r.TimeInForce = string(data)
+		case 5:
+			r.ExecutionType = string(data)
+		case 6:
+			r.Status = string(data)
+		case 7:
+			r.OrderId = int64(v)
+		case 8:
+			r.TradeId = int64(v)
+		case 9:
+			r.Price = string(data)
+		case 10:
+			r.Quantity = string(data)
+		case 11:
+			r.LastExecutedQty = string(data)
+		case 12:
+			r.CumulativeQty = string(data)
+		case 13:
+			r.LastExecutedPrice = string(data)
+		case 14:
+			r.Commission = string(data)
+		case 15:
+			r.CommissionAsset = string(data)
+		case 16:
+			r.EventTime = v
+		case 17:
+			r.TransactTime = v
+		}
+		return nil
+	})
+}
+
+func decodeAccountPosition(a *wireAccountPosition, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			a.EventTime = v
+		case 2:
+			a.LastUpdateTime = v
+		case 3:
+			b := wireBalance{}
+			err := decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					b.Asset = string(data)
+				case 2:
+					b.Free = string(data)
+				case 3:
+					b.Locked = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			a.Balances = append(a.Balances, b)
+		}
+		return nil
+	})
+}
+
+func decodeBalanceUpdate(u *wireBalanceUpdate, data []byte) error {
+	return decodeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			u.Asset = string(data)
+		case 2:
+			u.Delta = string(data)
+		case 3:
+			u.EventTime = v
+		case 4:
+			u.ClearTime = v
+		}
+		return nil
+	})
+}
+
+// decodeFields calls f for every field of a message, varint values are passed
+// in v and length-delimited values in data. Fields of other wire types are skipped.
+func decodeFields(b []byte, f func(num protowire.Number, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := f(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// default values are omitted as in proto3
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendLevels(b []byte, num protowire.Number, levels []wireLevel) []byte {
+	for _, l := range levels {
+		var m []byte
+		m = appendString(m, 1, l.Price)
+		m = appendString(m, 2, l.Amount)
+		b = appendMessage(b, num, m)
+	}
+	return b
+}
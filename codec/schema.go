@@ -0,0 +1,322 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+	"wisp/common"
+	"wisp/utils"
+)
+
+// wireEvent is the binary form of common.MarketEvent shared by the protobuf and
+// MessagePack codecs, see market.proto. Decimals are carried as strings so no
+// precision is lost, the symbol is only stored in the envelope.
+type wireEvent struct {
+	Version      uint32          `msgpack:"v"`
+	Venue        string          `msgpack:"venue"`
+	Symbol       string          `msgpack:"symbol"`
+	Channel      string          `msgpack:"channel"`
+	Period       string          `msgpack:"period,omitempty"`
+	Instrument   *wireInstrument `msgpack:"instrument,omitempty"`
+	ExchangeTime int64           `msgpack:"et,omitempty"`
+	ReceiveTime  int64           `msgpack:"rt"`
+	Sequence     uint64          `msgpack:"seq"`
+	Depth        *wireDepth      `msgpack:"depth,omitempty"`
+	Ticker       *wireTicker     `msgpack:"ticker,omitempty"`
+	Kline        *wireKline      `msgpack:"kline,omitempty"`
+	Trade        *wireTrade      `msgpack:"trade,omitempty"`
+	// user data events, published to sinks only
+	ExecutionReport *wireExecutionReport `msgpack:"executionReport,omitempty"`
+	AccountPosition *wireAccountPosition `msgpack:"accountPosition,omitempty"`
+	BalanceUpdate   *wireBalanceUpdate   `msgpack:"balanceUpdate,omitempty"`
+}
+
+type wireInstrument struct {
+	Base  string `msgpack:"base"`
+	Quote string `msgpack:"quote"`
+	Venue string `msgpack:"venue,omitempty"`
+	Type  string `msgpack:"type"`
+}
+
+type wireLevel struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	Price    string
+	Amount   string
+}
+
+type wireDepth struct {
+	LastUpdateId int64       `msgpack:"u"`
+	Time         int64       `msgpack:"t"` // unix milliseconds
+	Asks         []wireLevel `msgpack:"a"`
+	Bids         []wireLevel `msgpack:"b"`
+}
+
+type wireTicker struct {
+	Last string `msgpack:"last"`
+	Buy  string `msgpack:"buy"`
+	Sell string `msgpack:"sell"`
+	High string `msgpack:"high"`
+	Low  string `msgpack:"low"`
+	Vol  string `msgpack:"vol"`
+	Date uint64 `msgpack:"date"`
+}
+
+type wireKline struct {
+	Timestamp int64  `msgpack:"t"`
+	Open      string `msgpack:"o"`
+	Close     string `msgpack:"c"`
+	High      string `msgpack:"h"`
+	Low       string `msgpack:"l"`
+	Vol       string `msgpack:"v"`
+}
+
+type wireTrade struct {
+	Tid       int64  `msgpack:"id"`
+	Price     string `msgpack:"p"`
+	Amount    string `msgpack:"q"`
+	Side      string `msgpack:"side"`
+	Timestamp int64  `msgpack:"t"`
+}
+
+type wireExecutionReport struct {
+	ClientOrderId     string `msgpack:"c"`
+	Side              string `msgpack:"side"`
+	OrderType         string `msgpack:"o"`
+	TimeInForce       string `msgpack:"f"`
+	ExecutionType     string `msgpack:"x"`
+	Status            string `msgpack:"status"`
+	OrderId           int64  `msgpack:"id"`
+	TradeId           int64  `msgpack:"tid"`
+	Price             string `msgpack:"p"`
+	Quantity          string `msgpack:"q"`
+	LastExecutedQty   string `msgpack:"lq"`
+	CumulativeQty     string `msgpack:"cq"`
+	LastExecutedPrice string `msgpack:"lp"`
+	Commission        string `msgpack:"n"`
+	CommissionAsset   string `msgpack:"na"`
+	EventTime         uint64 `msgpack:"et"`
+	TransactTime      uint64 `msgpack:"tt"`
+}
+
+type wireBalance struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	Asset    string
+	Free     string
+	Locked   string
+}
+
+type wireAccountPosition struct {
+	EventTime      uint64        `msgpack:"et"`
+	LastUpdateTime uint64        `msgpack:"u"`
+	Balances       []wireBalance `msgpack:"b"`
+}
+
+type wireBalanceUpdate struct {
+	Asset     string `msgpack:"a"`
+	Delta     string `msgpack:"d"`
+	EventTime uint64 `msgpack:"et"`
+	ClearTime uint64 `msgpack:"ct"`
+}
+
+func toWire(ev *common.MarketEvent) (*wireEvent, error) {
+	w := &wireEvent{
+		Version:      SchemaVersion,
+		Venue:        ev.Venue,
+		Symbol:       ev.Symbol,
+		Channel:      ev.Channel,
+		Period:       ev.Period,
+		ExchangeTime: ev.ExchangeTime,
+		ReceiveTime:  ev.ReceiveTime,
+		Sequence:     ev.Sequence,
+	}
+	if ev.Instrument != (common.Instrument{}) {
+		i := wireInstrument(ev.Instrument)
+		w.Instrument = &i
+	}
+	switch data := ev.Data.(type) {
+	case *common.Depth:
+		w.Depth = &wireDepth{
+			LastUpdateId: data.LastUpdateId,
+			Time:         data.UTime.UnixNano() / int64(time.Millisecond),
+			Asks:         toWireLevels(data.AskList),
+			Bids:         toWireLevels(data.BidList),
+		}
+	case *common.Ticker:
+		w.Ticker = &wireTicker{
+			Last: data.Last.String(),
+			Buy:  data.Buy.String(),
+			Sell: data.Sell.String(),
+			High: data.High.String(),
+			Low:  data.Low.String(),
+			Vol:  data.Vol.String(),
+			Date: data.Date,
+		}
+	case *common.Kline:
+		w.Kline = &wireKline{
+			Timestamp: data.Timestamp,
+			Open:      data.Open.String(),
+			Close:     data.Close.String(),
+			High:      data.High.String(),
+			Low:       data.Low.String(),
+			Vol:       data.Vol.String(),
+		}
+	case *common.Trade:
+		w.Trade = &wireTrade{
+			Tid:       data.Tid,
+			Price:     data.Price.String(),
+			Amount:    data.Amount.String(),
+			Side:      data.Side,
+			Timestamp: data.Timestamp,
+		}
+	case *common.ExecutionReport:
+		w.ExecutionReport = &wireExecutionReport{
+			ClientOrderId:     data.ClientOrderId,
+			Side:              data.Side,
+			OrderType:         data.OrderType,
+			TimeInForce:       data.TimeInForce,
+			ExecutionType:     data.ExecutionType,
+			Status:            data.Status,
+			OrderId:           data.OrderId,
+			TradeId:           data.TradeId,
+			Price:             data.Price.String(),
+			Quantity:          data.Quantity.String(),
+			LastExecutedQty:   data.LastExecutedQty.String(),
+			CumulativeQty:     data.CumulativeQty.String(),
+			LastExecutedPrice: data.LastExecutedPrice.String(),
+			Commission:        data.Commission.String(),
+			CommissionAsset:   data.CommissionAsset,
+			EventTime:         data.EventTime,
+			TransactTime:      data.TransactTime,
+		}
+	case *common.AccountPosition:
+		w.AccountPosition = &wireAccountPosition{EventTime: data.EventTime, LastUpdateTime: data.LastUpdateTime}
+		for _, b := range data.Balances {
+			w.AccountPosition.Balances = append(w.AccountPosition.Balances, wireBalance{Asset: b.Asset, Free: b.Free.String(), Locked: b.Locked.String()})
+		}
+	case *common.BalanceUpdate:
+		w.BalanceUpdate = &wireBalanceUpdate{
+			Asset:     data.Asset,
+			Delta:     data.Delta.String(),
+			EventTime: data.EventTime,
+			ClearTime: data.ClearTime,
+		}
+	default:
+		return nil, fmt.Errorf("codec: unsupported event data %T", ev.Data)
+	}
+	return w, nil
+}
+
+func toWireLevels(records common.DepthRecords) []wireLevel {
+	levels := make([]wireLevel, len(records))
+	for i, r := range records {
+		levels[i] = wireLevel{Price: r.Price.String(), Amount: r.Amount.String()}
+	}
+	return levels
+}
+
+func fromWire(w *wireEvent) (*common.MarketEvent, error) {
+	if err := checkVersion(w.Version); err != nil {
+		return nil, err
+	}
+	ev := &common.MarketEvent{
+		Venue:        w.Venue,
+		Symbol:       w.Symbol,
+		Channel:      w.Channel,
+		Period:       w.Period,
+		ExchangeTime: w.ExchangeTime,
+		ReceiveTime:  w.ReceiveTime,
+		Sequence:     w.Sequence,
+	}
+	if w.Instrument != nil {
+		ev.Instrument = common.Instrument(*w.Instrument)
+	}
+	p := new(utils.DecimalParser)
+	switch {
+	case w.Depth != nil:
+		ev.Data = &common.Depth{
+			Symbol:       w.Symbol,
+			LastUpdateId: w.Depth.LastUpdateId,
+			UTime:        time.Unix(0, w.Depth.Time*int64(time.Millisecond)),
+			AskList:      parseLevels(p, w.Depth.Asks),
+			BidList:      parseLevels(p, w.Depth.Bids),
+		}
+	case w.Ticker != nil:
+		ev.Data = &common.Ticker{
+			Symbol: w.Symbol,
+			Last:   p.Parse(w.Ticker.Last),
+			Buy:    p.Parse(w.Ticker.Buy),
+			Sell:   p.Parse(w.Ticker.Sell),
+			High:   p.Parse(w.Ticker.High),
+			Low:    p.Parse(w.Ticker.Low),
+			Vol:    p.Parse(w.Ticker.Vol),
+			Date:   w.Ticker.Date,
+		}
+	case w.Kline != nil:
+		ev.Data = &common.Kline{
+			Symbol:    w.Symbol,
+			Timestamp: w.Kline.Timestamp,
+			Open:      p.Parse(w.Kline.Open),
+			Close:     p.Parse(w.Kline.Close),
+			High:      p.Parse(w.Kline.High),
+			Low:       p.Parse(w.Kline.Low),
+			Vol:       p.Parse(w.Kline.Vol),
+		}
+	case w.Trade != nil:
+		ev.Data = &common.Trade{
+			Symbol:    w.Symbol,
+			Tid:       w.Trade.Tid,
+			Price:     p.Parse(w.Trade.Price),
+			Amount:    p.Parse(w.Trade.Amount),
+			Side:      w.Trade.Side,
+			Timestamp: w.Trade.Timestamp,
+		}
+	case w.ExecutionReport != nil:
+		r := w.ExecutionReport
+		ev.Data = &common.ExecutionReport{
+			Symbol:            w.Symbol,
+			ClientOrderId:     r.ClientOrderId,
+			Side:              r.Side,
+			OrderType:         r.OrderType,
+			TimeInForce:       r.TimeInForce,
+			ExecutionType:     r.ExecutionType,
+			Status:            r.Status,
+			OrderId:           r.OrderId,
+			TradeId:           r.TradeId,
+			Price:             p.Parse(r.Price),
+			Quantity:          p.Parse(r.Quantity),
+			LastExecutedQty:   p.Parse(r.LastExecutedQty),
+			CumulativeQty:     p.Parse(r.CumulativeQty),
+			LastExecutedPrice: p.Parse(r.LastExecutedPrice),
+			Commission:        p.Parse(r.Commission),
+			CommissionAsset:   r.CommissionAsset,
+			EventTime:         r.EventTime,
+			TransactTime:      r.TransactTime,
+		}
+	case w.AccountPosition != nil:
+		position := &common.AccountPosition{EventTime: w.AccountPosition.EventTime, LastUpdateTime: w.AccountPosition.LastUpdateTime}
+		for _, b := range w.AccountPosition.Balances {
+			position.Balances = append(position.Balances, common.AssetBalance{Asset: b.Asset, Free: p.Parse(b.Free), Locked: p.Parse(b.Locked)})
+		}
+		ev.Data = position
+	case w.BalanceUpdate != nil:
+		ev.Data = &common.BalanceUpdate{
+			Asset:     w.BalanceUpdate.Asset,
+			Delta:     p.Parse(w.BalanceUpdate.Delta),
+			EventTime: w.BalanceUpdate.EventTime,
+			ClearTime: w.BalanceUpdate.ClearTime,
+		}
+	default:
+		return nil, fmt.Errorf("codec: event %s has no data", ev.Topic())
+	}
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return ev, nil
+}
+
+func parseLevels(p *utils.DecimalParser, levels []wireLevel) common.DepthRecords {
+	records := make(common.DepthRecords, len(levels))
+	for i, l := range levels {
+		records[i] = common.DepthRecord{Price: p.Parse(l.Price), Amount: p.Parse(l.Amount)}
+	}
+	return records
+}
@@ -0,0 +1,262 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//定点十进制数，值为 value * 10^exp
+//解析时保留原始精度，如 "0.01000000" 序列化后仍为 "0.01000000"，零值表示0
+type Decimal struct {
+	value *big.Int
+	exp   int32
+}
+
+var (
+	bigZero = big.NewInt(0)
+	bigOne  = big.NewInt(1)
+	bigTen  = big.NewInt(10)
+)
+
+func NewDecimal(value int64, exp int32) Decimal {
+	return Decimal{value: big.NewInt(value), exp: exp}
+}
+
+//解析时允许的最大指数绝对值，避免 1e999999999 之类的输入在格式化及比较时分配大量内存
+const DECIMAL_MAX_EXP = 64
+
+//解析十进制字符串，支持符号、小数及科学计数法，如 -1.5、0.001、1e-8
+func NewDecimalFromString(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(str[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("数值格式错误: %q", s)
+		}
+		exp, str = e, str[:i]
+	}
+
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		exp -= int64(len(str) - i - 1)
+		str = str[:i] + str[i+1:]
+	}
+
+	digits := strings.TrimLeft(str, "+-")
+	if digits == "" || len(str)-len(digits) > 1 || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return Decimal{}, fmt.Errorf("数值格式错误: %q", s)
+	}
+	if exp > DECIMAL_MAX_EXP || exp < -DECIMAL_MAX_EXP {
+		return Decimal{}, fmt.Errorf("数值指数超出范围 ±%d: %q", DECIMAL_MAX_EXP, s)
+	}
+	value, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("数值格式错误: %q", s)
+	}
+	return Decimal{value: value, exp: int32(exp)}, nil
+}
+
+//解析十进制字符串，格式错误时panic，用于常量
+func MustDecimal(s string) Decimal {
+	d, err := NewDecimalFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+//由浮点数转换，取能还原该浮点数的最短十进制表示
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := NewDecimalFromString(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+func (this Decimal) bigValue() *big.Int {
+	if this.value == nil {
+		return bigZero
+	}
+	return this.value
+}
+
+//转换为浮点数，供需要float64的场景使用
+func (this Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(this.String(), 64)
+	return f
+}
+
+func (this Decimal) String() string {
+	value := this.bigValue()
+	digits := new(big.Int).Abs(value).String()
+	sign := ""
+	if value.Sign() < 0 {
+		sign = "-"
+	}
+
+	if this.exp >= 0 {
+		if value.Sign() == 0 {
+			return "0"
+		}
+		return sign + digits + strings.Repeat("0", int(this.exp))
+	}
+
+	scale := int(-this.exp)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+func (this Decimal) Sign() int {
+	return this.bigValue().Sign()
+}
+
+func (this Decimal) IsZero() bool {
+	return this.Sign() == 0
+}
+
+//比较大小，返回 -1、0、1
+func (this Decimal) Cmp(d Decimal) int {
+	a, b, _ := align(this, d)
+	return a.Cmp(b)
+}
+
+//数值相等，不比较精度，如 1.0 与 1.00 相等
+func (this Decimal) Equal(d Decimal) bool {
+	return this.Cmp(d) == 0
+}
+
+func (this Decimal) Add(d Decimal) Decimal {
+	a, b, exp := align(this, d)
+	return Decimal{value: new(big.Int).Add(a, b), exp: exp}
+}
+
+func (this Decimal) Sub(d Decimal) Decimal {
+	a, b, exp := align(this, d)
+	return Decimal{value: new(big.Int).Sub(a, b), exp: exp}
+}
+
+func (this Decimal) Mul(d Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(this.bigValue(), d.bigValue()), exp: this.exp + d.exp}
+}
+
+func (this Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(this.bigValue()), exp: this.exp}
+}
+
+func (this Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(this.bigValue()), exp: this.exp}
+}
+
+//除法，结果保留places位小数并四舍五入，除数为0时panic
+func (this Decimal) Div(d Decimal, places int32) Decimal {
+	if d.IsZero() {
+		panic("decimal除数为0")
+	}
+	num := new(big.Int).Set(this.bigValue())
+	den := new(big.Int).Set(d.bigValue())
+	if shift := this.exp - d.exp + places; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return Decimal{value: quoRound(num, den), exp: -places}
+}
+
+//四舍五入保留places位小数，精度不足时原样返回
+func (this Decimal) Round(places int32) Decimal {
+	if -this.exp <= places {
+		return this
+	}
+	return Decimal{value: quoRound(this.bigValue(), pow10(-this.exp-places)), exp: -places}
+}
+
+//按步长(最小变动价位)四舍五入，结果精度与步长一致
+func (this Decimal) RoundStep(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return this
+	}
+	a, b, exp := align(this, step)
+	q := quoRound(a, b)
+	return Decimal{value: q.Mul(q, b), exp: exp}.rescale(step.exp)
+}
+
+//按步长(最小变动数量)向下取整，结果精度与步长一致
+func (this Decimal) FloorStep(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return this
+	}
+	a, b, exp := align(this, step)
+	m := new(big.Int).Mod(a, b) //b为正数时Mod结果非负
+	return Decimal{value: new(big.Int).Sub(a, m), exp: exp}.rescale(step.exp)
+}
+
+//调整为指定精度，仅用于能整除的场景
+func (this Decimal) rescale(exp int32) Decimal {
+	if this.exp == exp {
+		return this
+	}
+	if this.exp > exp {
+		return Decimal{value: new(big.Int).Mul(this.bigValue(), pow10(this.exp-exp)), exp: exp}
+	}
+	return Decimal{value: new(big.Int).Quo(this.bigValue(), pow10(exp-this.exp)), exp: exp}
+}
+
+//序列化为字符串，保留原始精度
+func (this Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + this.String() + `"`), nil
+}
+
+//支持字符串及数字两种形式，字符串只去掉首尾成对的一组引号
+func (this *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+	d, err := NewDecimalFromString(string(data))
+	if err != nil {
+		return err
+	}
+	*this = d
+	return nil
+}
+
+//对齐两个数的精度，返回对齐后的整数值及公共指数
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	av, bv := a.bigValue(), b.bigValue()
+	switch {
+	case a.exp > b.exp:
+		return new(big.Int).Mul(av, pow10(a.exp-b.exp)), bv, b.exp
+	case a.exp < b.exp:
+		return av, new(big.Int).Mul(bv, pow10(b.exp-a.exp)), a.exp
+	default:
+		return av, bv, a.exp
+	}
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+//整数除法，余数过半时远离0取整
+func quoRound(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(new(big.Int).Abs(den)) >= 0 {
+		if num.Sign()*den.Sign() < 0 {
+			q.Sub(q, bigOne)
+		} else {
+			q.Add(q, bigOne)
+		}
+	}
+	return q
+}
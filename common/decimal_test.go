@@ -0,0 +1,67 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewDecimalFromString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"0.01000000", "0.01000000", false},
+		{"-1.5", "-1.5", false},
+		{"1e-8", "0.00000001", false},
+		{"12E2", "1200", false},
+		{"1e64", "1" + strings.Repeat("0", 64), false},
+		{"1e-64", "0." + strings.Repeat("0", 63) + "1", false},
+		{"1e65", "", true},
+		{"1e-65", "", true},
+		{"1e999999999", "", true},
+		{"0." + strings.Repeat("0", 64) + "1", "", true},
+		{"1e99999999999", "", true},
+		{"", "", true},
+		{"+-1", "", true},
+		{"1.2.3", "", true},
+	}
+	for _, tt := range tests {
+		d, err := NewDecimalFromString(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewDecimalFromString(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && d.String() != tt.want {
+			t.Errorf("NewDecimalFromString(%q) = %s, want %s", tt.in, d.String(), tt.want)
+		}
+	}
+}
+
+func TestDecimalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{`"1.50"`, "1.50", false},
+		{`1.50`, "1.50", false},
+		{`null`, "0", false},
+		{`"`, "", true},
+		{`"1.5`, "", true},
+		{`1.5"`, "", true},
+		{`""1.5""`, "", true},
+		{`"1e999999999"`, "", true},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		err := d.UnmarshalJSON([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && d.String() != tt.want {
+			t.Errorf("Unmarshal(%s) = %s, want %s", tt.in, d.String(), tt.want)
+		}
+	}
+}
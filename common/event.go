@@ -0,0 +1,93 @@
+package common
+
+import (
+	"strings"
+	"sync"
+)
+
+//行情事件信封，Data为 *Depth、*Ticker、*Kline 或 *Trade，
+//用户数据事件为 *ExecutionReport、*AccountPosition 或 *BalanceUpdate
+type MarketEvent struct {
+	Venue        string      `json:"venue"`
+	Symbol       string      `json:"symbol"` //交易所符号，如 btcusdt
+	Instrument   Instrument  `json:"instrument"`
+	Channel      string      `json:"channel"`
+	Period       string      `json:"period,omitempty"`       //k线周期，如 1m
+	ExchangeTime int64       `json:"exchangeTime,omitempty"` //交易所事件时间(毫秒)，交易所未提供时为0，如币安部分深度推送，此时以ReceiveTime为准
+	ReceiveTime  int64       `json:"receiveTime"`            //本地接收时间(毫秒)
+	Sequence     uint64      `json:"seq"`                    //同一主题内递增的本地序号
+	Data         interface{} `json:"data"`
+}
+
+func NewDepthEvent(venue string, depth *Depth) *MarketEvent {
+	return &MarketEvent{Venue: venue, Symbol: depth.Symbol, Channel: CHANNEL_DEPTH, Data: depth}
+}
+
+func NewTickerEvent(venue string, ticker *Ticker) *MarketEvent {
+	return &MarketEvent{Venue: venue, Symbol: ticker.Symbol, Channel: CHANNEL_TICKER, Data: ticker}
+}
+
+func NewKlineEvent(venue string, kline *Kline, period int) *MarketEvent {
+	return &MarketEvent{Venue: venue, Symbol: kline.Symbol, Channel: CHANNEL_KLINE, Period: KLINE_PERIOD[period], Data: kline}
+}
+
+func NewTradeEvent(venue string, trade *Trade) *MarketEvent {
+	return &MarketEvent{Venue: venue, Symbol: trade.Symbol, Channel: CHANNEL_TRADE, Data: trade}
+}
+
+func NewExecutionReportEvent(venue string, report *ExecutionReport) *MarketEvent {
+	return &MarketEvent{Venue: venue, Symbol: report.Symbol, Channel: CHANNEL_EXECUTION_REPORT, Data: report}
+}
+
+func NewAccountPositionEvent(venue string, position *AccountPosition) *MarketEvent {
+	return &MarketEvent{Venue: venue, Channel: CHANNEL_ACCOUNT_POSITION, Data: position}
+}
+
+func NewBalanceUpdateEvent(venue string, update *BalanceUpdate) *MarketEvent {
+	return &MarketEvent{Venue: venue, Channel: CHANNEL_BALANCE_UPDATE, Data: update}
+}
+
+//用户数据主题的首个单词，与行情主题区分，避免按交易所绑定的行情消费方收到账户数据
+const USER_TOPIC_PREFIX = "user"
+
+//是否为订单回报、账户余额等用户数据事件
+func (this *MarketEvent) IsUserData() bool {
+	switch this.Channel {
+	case CHANNEL_EXECUTION_REPORT, CHANNEL_ACCOUNT_POSITION, CHANNEL_BALANCE_UPDATE:
+		return true
+	}
+	return false
+}
+
+//事件主题，各部分小写并以.分隔，如 binance.btcusdt.kline.1m，
+//用户数据事件不含交易标的，如 user.binance.execution_report
+func (this *MarketEvent) Topic() string {
+	parts := []string{this.Venue, this.Symbol, this.Channel}
+	if this.IsUserData() {
+		parts = []string{USER_TOPIC_PREFIX, this.Venue, this.Channel}
+	}
+	if this.Period != "" {
+		parts = append(parts, this.Period)
+	}
+	for i, p := range parts {
+		parts[i] = strings.Replace(strings.ToLower(p), ".", "_", -1)
+	}
+	return strings.Join(parts, ".")
+}
+
+//按主题生成从1开始递增的序号，消费方可据此发现丢失或乱序的事件
+type Sequencer struct {
+	sync.Mutex
+	seq map[string]uint64
+}
+
+func NewSequencer() *Sequencer {
+	return &Sequencer{seq: make(map[string]uint64)}
+}
+
+func (this *Sequencer) Next(topic string) uint64 {
+	this.Lock()
+	defer this.Unlock()
+	this.seq[topic]++
+	return this.seq[topic]
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMarketEventTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		ev       *MarketEvent
+		want     string
+		userData bool
+	}{
+		{"depth", NewDepthEvent(BINANCE, &Depth{Symbol: "btcusdt"}), "binance.btcusdt.depth", false},
+		{"ticker", NewTickerEvent(BINANCE, &Ticker{Symbol: "btcusdt"}), "binance.btcusdt.ticker", false},
+		{"kline", NewKlineEvent(BINANCE, &Kline{Symbol: "btcusdt"}, KLINE_PERIOD_1H), "binance.btcusdt.kline.1h", false},
+		{"trade", NewTradeEvent(BINANCE, &Trade{Symbol: "btcusdt"}), "binance.btcusdt.trade", false},
+		{"lower case", NewTickerEvent("Binance", &Ticker{Symbol: "BTCUSDT"}), "binance.btcusdt.ticker", false},
+		{"dotted symbol", NewTradeEvent("okex", &Trade{Symbol: "BTC.USDT"}), "okex.btc_usdt.trade", false},
+		{"execution report", NewExecutionReportEvent(BINANCE, &ExecutionReport{Symbol: "ETHBTC"}), "user.binance.execution_report", true},
+		{"account position", NewAccountPositionEvent(BINANCE, &AccountPosition{}), "user.binance.account_position", true},
+		{"balance update", NewBalanceUpdateEvent(BINANCE, &BalanceUpdate{Asset: "BTC"}), "user.binance.balance_update", true},
+	}
+	for _, tt := range tests {
+		if got := tt.ev.Topic(); got != tt.want {
+			t.Errorf("%s: Topic() = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := tt.ev.IsUserData(); got != tt.userData {
+			t.Errorf("%s: IsUserData() = %v, want %v", tt.name, got, tt.userData)
+		}
+		//只有用户数据主题以 user. 开头，行情主题的首个单词为交易所
+		if got := strings.HasPrefix(tt.ev.Topic(), USER_TOPIC_PREFIX+"."); got != tt.userData {
+			t.Errorf("%s: topic %s has user prefix %v, want %v", tt.name, tt.ev.Topic(), got, tt.userData)
+		}
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	sequencer := NewSequencer()
+	topics := []string{"binance.btcusdt.ticker", "binance.ethusdt.ticker", "user.binance.balance_update"}
+	const perTopic = 100
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[string]map[uint64]bool)
+	for _, topic := range topics {
+		seen[topic] = make(map[uint64]bool)
+		for i := 0; i < perTopic; i++ {
+			wg.Add(1)
+			go func(topic string) {
+				defer wg.Done()
+				seq := sequencer.Next(topic)
+				mu.Lock()
+				seen[topic][seq] = true
+				mu.Unlock()
+			}(topic)
+		}
+	}
+	wg.Wait()
+
+	//每个主题的序号从1开始连续且不重复
+	for _, topic := range topics {
+		for seq := uint64(1); seq <= perTopic; seq++ {
+			if !seen[topic][seq] {
+				t.Errorf("%s: sequence %d missing", topic, seq)
+			}
+		}
+		if got := sequencer.Next(topic); got != perTopic+1 {
+			t.Errorf("%s: Next() = %d, want %d", topic, got, perTopic+1)
+		}
+	}
+	if got := sequencer.Next("binance.btcusdt.depth"); got != 1 {
+		t.Errorf("new topic starts at %d, want 1", got)
+	}
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	INSTRUMENT_SPOT      = "spot"
+	INSTRUMENT_PERPETUAL = "perpetual"
+	INSTRUMENT_FUTURES   = "futures"
+)
+
+//统一交易标的标识，Base/Quote为大写的标准资产名称，如 BTC/USDT
+type Instrument struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+	Venue string `json:"venue,omitempty"`
+	Type  string `json:"type"`
+}
+
+func NewInstrument(venue, base, quote string) Instrument {
+	return Instrument{
+		Base:  strings.ToUpper(base),
+		Quote: strings.ToUpper(quote),
+		Venue: venue,
+		Type:  INSTRUMENT_SPOT,
+	}
+}
+
+//解析标准交易对写法 BTC/USDT，可带交易所前缀 binance:BTC/USDT
+func ParseInstrument(s string) (Instrument, error) {
+	venue := ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		venue, s = s[:i], s[i+1:]
+	}
+	pair := strings.Split(s, "/")
+	if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+		return Instrument{}, fmt.Errorf("交易对格式错误: %s，应为 BASE/QUOTE", s)
+	}
+	return NewInstrument(venue, pair[0], pair[1]), nil
+}
+
+//是否为标准交易对写法
+func IsInstrument(s string) bool {
+	return strings.Contains(s, "/")
+}
+
+//标准交易对名称，如 BTC/USDT
+func (this Instrument) Pair() string {
+	return this.Base + "/" + this.Quote
+}
+
+func (this Instrument) String() string {
+	if this.Venue == "" {
+		return this.Pair()
+	}
+	return this.Venue + ":" + this.Pair()
+}
+
+//交易所符号与统一交易标的之间的双向映射
+type SymbolMapper interface {
+	ToVenue(instrument Instrument) (string, error)
+	FromVenue(symbol string) (Instrument, error)
+}
+
+//以分隔符连接的交易所符号映射，如 BTC-USDT、XBT/USD
+//Aliases为交易所资产名称到标准名称的映射，如 XBT -> BTC
+type DelimitedSymbolMapper struct {
+	Venue     string
+	Separator string
+	Lower     bool
+	Aliases   map[string]string
+}
+
+func (this *DelimitedSymbolMapper) ToVenue(instrument Instrument) (string, error) {
+	if instrument.Type != "" && instrument.Type != INSTRUMENT_SPOT {
+		return "", fmt.Errorf("%s 不支持的交易标的类型: %s", this.Venue, instrument.Type)
+	}
+	symbol := this.toVenueAsset(instrument.Base) + this.Separator + this.toVenueAsset(instrument.Quote)
+	if this.Lower {
+		return strings.ToLower(symbol), nil
+	}
+	return symbol, nil
+}
+
+func (this *DelimitedSymbolMapper) FromVenue(symbol string) (Instrument, error) {
+	pair := strings.Split(symbol, this.Separator)
+	if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+		return Instrument{}, fmt.Errorf("%s 交易对格式错误: %s", this.Venue, symbol)
+	}
+	return NewInstrument(this.Venue, this.fromVenueAsset(pair[0]), this.fromVenueAsset(pair[1])), nil
+}
+
+func (this *DelimitedSymbolMapper) fromVenueAsset(asset string) string {
+	asset = strings.ToUpper(asset)
+	if alias, ok := this.Aliases[asset]; ok {
+		return alias
+	}
+	return asset
+}
+
+func (this *DelimitedSymbolMapper) toVenueAsset(asset string) string {
+	asset = strings.ToUpper(asset)
+	for venueAsset, alias := range this.Aliases {
+		if alias == asset {
+			return venueAsset
+		}
+	}
+	return asset
+}
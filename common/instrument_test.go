@@ -0,0 +1,76 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseInstrument(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Instrument
+		wantErr bool
+	}{
+		{"BTC/USDT", Instrument{Base: "BTC", Quote: "USDT", Type: INSTRUMENT_SPOT}, false},
+		{"btc/usdt", Instrument{Base: "BTC", Quote: "USDT", Type: INSTRUMENT_SPOT}, false},
+		{"binance:eth/btc", Instrument{Base: "ETH", Quote: "BTC", Venue: BINANCE, Type: INSTRUMENT_SPOT}, false},
+		{"btcusdt", Instrument{}, true},
+		{"BTC/", Instrument{}, true},
+		{"/USDT", Instrument{}, true},
+		{"BTC/USDT/ETH", Instrument{}, true},
+		{"binance:", Instrument{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseInstrument(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseInstrument(%q) err = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseInstrument(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestInstrumentString(t *testing.T) {
+	if got := NewInstrument("", "btc", "usdt").String(); got != "BTC/USDT" {
+		t.Errorf("String() = %q, want BTC/USDT", got)
+	}
+	if got := NewInstrument(BINANCE, "btc", "usdt").String(); got != "binance:BTC/USDT" {
+		t.Errorf("String() = %q, want binance:BTC/USDT", got)
+	}
+}
+
+func TestDelimitedSymbolMapper(t *testing.T) {
+	kraken := &DelimitedSymbolMapper{Venue: "kraken", Separator: "/", Aliases: map[string]string{"XBT": "BTC", "XDG": "DOGE"}}
+	okex := &DelimitedSymbolMapper{Venue: "okex", Separator: "-", Lower: true}
+
+	tests := []struct {
+		mapper     *DelimitedSymbolMapper
+		venue      string
+		instrument Instrument
+	}{
+		{kraken, "XBT/USD", NewInstrument("kraken", "BTC", "USD")},
+		{kraken, "XDG/XBT", NewInstrument("kraken", "DOGE", "BTC")},
+		{kraken, "ETH/USD", NewInstrument("kraken", "ETH", "USD")},
+		{okex, "btc-usdt", NewInstrument("okex", "BTC", "USDT")},
+	}
+	for _, tt := range tests {
+		got, err := tt.mapper.FromVenue(tt.venue)
+		if err != nil || got != tt.instrument {
+			t.Errorf("%s FromVenue(%q) = %+v, %v, want %+v", tt.mapper.Venue, tt.venue, got, err, tt.instrument)
+		}
+		symbol, err := tt.mapper.ToVenue(tt.instrument)
+		if err != nil || symbol != tt.venue {
+			t.Errorf("%s ToVenue(%v) = %q, %v, want %q", tt.mapper.Venue, tt.instrument, symbol, err, tt.venue)
+		}
+	}
+
+	for _, symbol := range []string{"XBTUSD", "XBT/", "XBT/USD/EUR"} {
+		if _, err := kraken.FromVenue(symbol); err == nil {
+			t.Errorf("kraken FromVenue(%q) succeeded", symbol)
+		}
+	}
+	if _, err := okex.ToVenue(Instrument{Base: "BTC", Quote: "USDT", Type: INSTRUMENT_PERPETUAL}); err == nil {
+		t.Error("okex ToVenue of a perpetual succeeded")
+	}
+}
@@ -1,38 +1,125 @@
 package common
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
+
+//交易所接口配置
+type APIConfig struct {
+	HttpClient   *http.Client //http请求客户端
+	Endpoint     string       //rest接口地址，为空时使用交易所默认地址
+	ApiKey       string       //接口密钥
+	ApiSecretKey string       //签名密钥
+	ProxyUrl     string       //代理地址，websocket及rest请求共用，如 socks5://127.0.0.1:1080，为空时直连
+}
 
 type DepthRecord struct {
-	Price  float64
-	Amount float64
+	Price  Decimal
+	Amount Decimal
 }
 
 type DepthRecords []DepthRecord
 
 type Depth struct {
-	Symbol  string
-	UTime   time.Time
-	AskList DepthRecords
-	BidList DepthRecords
+	Symbol       string
+	LastUpdateId int64
+	UTime        time.Time
+	AskList      DepthRecords
+	BidList      DepthRecords
 }
 
 type Ticker struct {
 	Symbol string  `json:"omitempty"`
-	Last   float64 `json:"last"`
-	Buy    float64 `json:"buy"`
-	Sell   float64 `json:"sell"`
-	High   float64 `json:"high"`
-	Low    float64 `json:"low"`
-	Vol    float64 `json:"vol"`
+	Last   Decimal `json:"last"`
+	Buy    Decimal `json:"buy"`
+	Sell   Decimal `json:"sell"`
+	High   Decimal `json:"high"`
+	Low    Decimal `json:"low"`
+	Vol    Decimal `json:"vol"`
 	Date   uint64  `json:"date"`
 }
 
 type Kline struct {
 	Symbol    string  `json:"s"`
 	Timestamp int64   `json:"t"`
-	Open      float64 `json:"o"`
-	Close     float64 `json:"c"`
-	High      float64 `json:"h"`
-	Low       float64 `json:"l"`
-	Vol       float64 `json:"v"`
+	Open      Decimal `json:"o"`
+	Close     Decimal `json:"c"`
+	High      Decimal `json:"h"`
+	Low       Decimal `json:"l"`
+	Vol       Decimal `json:"v"`
+}
+
+//逐笔成交，Side为主动成交方向
+type Trade struct {
+	Symbol    string  `json:"s"`
+	Tid       int64   `json:"id"`
+	Price     Decimal `json:"p"`
+	Amount    Decimal `json:"q"`
+	Side      string  `json:"side"`
+	Timestamp int64   `json:"t"`
+}
+
+//交易对信息
+type SymbolInfo struct {
+	Symbol         string `json:"symbol"`
+	Status         string `json:"status"`
+	BaseAsset      string `json:"baseAsset"`
+	BasePrecision  int    `json:"basePrecision"`
+	QuoteAsset     string `json:"quoteAsset"`
+	QuotePrecision int    `json:"quotePrecision"`
+
+	TickSize    Decimal `json:"tickSize"`    //最小变动价位
+	StepSize    Decimal `json:"stepSize"`    //最小变动数量
+	MinQty      Decimal `json:"minQty"`      //最小下单数量
+	MinNotional Decimal `json:"minNotional"` //最小成交额
+}
+
+type ExchangeInfo struct {
+	ServerTime int64
+	Symbols    []SymbolInfo
+}
+
+//订单执行回报
+type ExecutionReport struct {
+	Symbol            string  `json:"s"`
+	ClientOrderId     string  `json:"c"`
+	Side              string  `json:"S"`
+	OrderType         string  `json:"o"`
+	TimeInForce       string  `json:"f"`
+	ExecutionType     string  `json:"x"`
+	Status            string  `json:"X"`
+	OrderId           int64   `json:"i"`
+	TradeId           int64   `json:"t"`
+	Price             Decimal `json:"p"`
+	Quantity          Decimal `json:"q"`
+	LastExecutedQty   Decimal `json:"l"`
+	CumulativeQty     Decimal `json:"z"`
+	LastExecutedPrice Decimal `json:"L"`
+	Commission        Decimal `json:"n"`
+	CommissionAsset   string  `json:"N"`
+	EventTime         uint64  `json:"E"`
+	TransactTime      uint64  `json:"T"`
+}
+
+//资产余额
+type AssetBalance struct {
+	Asset  string  `json:"a"`
+	Free   Decimal `json:"f"`
+	Locked Decimal `json:"l"`
+}
+
+//账户余额变动推送，只包含发生变化的资产
+type AccountPosition struct {
+	EventTime      uint64         `json:"E"`
+	LastUpdateTime uint64         `json:"u"`
+	Balances       []AssetBalance `json:"B"`
+}
+
+//充值、提现或划转引起的余额变化
+type BalanceUpdate struct {
+	Asset     string  `json:"a"`
+	Delta     Decimal `json:"d"`
+	EventTime uint64  `json:"E"`
+	ClearTime uint64  `json:"T"`
 }
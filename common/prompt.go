@@ -1,7 +1,5 @@
 package common
 
-import "github.com/gorilla/websocket"
-
 var Logo = `
 ----------------------------
  _      ___        
@@ -49,4 +47,24 @@ var KLINE_PERIOD = map[int]string{
 	KLINE_PERIOD_1M:    "1M",
 }
 
-var ChanMap = map[string]*websocket.Conn{}
+const BINANCE = "binance"
+
+//行情频道
+const (
+	CHANNEL_DEPTH  = "depth"
+	CHANNEL_TICKER = "ticker"
+	CHANNEL_KLINE  = "kline"
+	CHANNEL_TRADE  = "trade"
+)
+
+//用户数据频道，需ApiKey订阅，只发布到行情输出，不向公开的websocket客户端推送
+const (
+	CHANNEL_EXECUTION_REPORT = "execution_report"
+	CHANNEL_ACCOUNT_POSITION = "account_position"
+	CHANNEL_BALANCE_UPDATE   = "balance_update"
+)
+
+const (
+	TRADE_SIDE_BUY  = "buy"
+	TRADE_SIDE_SELL = "sell"
+)
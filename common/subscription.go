@@ -0,0 +1,72 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//行情订阅项，Param 为深度档数或K线周期，其余频道为0
+type Subscription struct {
+	Exchange string `json:"exchange"`
+	Symbol   string `json:"symbol"`
+	Channel  string `json:"channel"`
+	Param    int    `json:"param,omitempty"`
+}
+
+//订阅项的唯一标识，如 binance.btcusdt.depth.5、binance.btcusdt.kline.1m
+func (this Subscription) String() string {
+	switch this.Channel {
+	case CHANNEL_DEPTH:
+		return fmt.Sprintf("%s.%s.%s.%d", this.Exchange, this.Symbol, this.Channel, this.Param)
+	case CHANNEL_KLINE:
+		return fmt.Sprintf("%s.%s.%s.%s", this.Exchange, this.Symbol, this.Channel, KLINE_PERIOD[this.Param])
+	default:
+		return fmt.Sprintf("%s.%s.%s", this.Exchange, this.Symbol, this.Channel)
+	}
+}
+
+//JSON中附带订阅项标识，便于识别K线周期等参数
+func (this Subscription) MarshalJSON() ([]byte, error) {
+	type subscription Subscription
+	return json.Marshal(struct {
+		Id string `json:"id"`
+		subscription
+	}{this.String(), subscription(this)})
+}
+
+//K线周期名称转换为 KLINE_PERIOD_* 常量，如 1m、1h
+func ParseKlinePeriod(name string) (int, bool) {
+	for period, n := range KLINE_PERIOD {
+		if n == name {
+			return period, true
+		}
+	}
+	return 0, false
+}
+
+//按标识排序
+func SortSubscriptions(subs []Subscription) {
+	sort.Slice(subs, func(i, j int) bool { return subs[i].String() < subs[j].String() })
+}
+
+//比较两个订阅集合，返回需要新增及取消的订阅项
+func DiffSubscriptions(current, target []Subscription) (added, removed []Subscription) {
+	have := make(map[string]bool, len(current))
+	for _, sub := range current {
+		have[sub.String()] = true
+	}
+	want := make(map[string]bool, len(target))
+	for _, sub := range target {
+		want[sub.String()] = true
+		if !have[sub.String()] {
+			added = append(added, sub)
+		}
+	}
+	for _, sub := range current {
+		if !want[sub.String()] {
+			removed = append(removed, sub)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSubscriptions(t *testing.T) {
+	ticker := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TICKER}
+	depth5 := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_DEPTH, Param: 5}
+	depth20 := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_DEPTH, Param: 20}
+	kline1m := Subscription{Exchange: BINANCE, Symbol: "ethusdt", Channel: CHANNEL_KLINE, Param: KLINE_PERIOD_1MIN}
+	kline1h := Subscription{Exchange: BINANCE, Symbol: "ethusdt", Channel: CHANNEL_KLINE, Param: KLINE_PERIOD_1H}
+
+	tests := []struct {
+		name        string
+		current     []Subscription
+		target      []Subscription
+		wantAdded   []Subscription
+		wantRemoved []Subscription
+	}{
+		{"empty", nil, nil, nil, nil},
+		{"add all", nil, []Subscription{ticker, depth5}, []Subscription{ticker, depth5}, nil},
+		{"remove all", []Subscription{ticker, depth5}, nil, nil, []Subscription{ticker, depth5}},
+		{"unchanged", []Subscription{ticker, depth5}, []Subscription{depth5, ticker}, nil, nil},
+		{"depth size", []Subscription{ticker, depth5}, []Subscription{ticker, depth20}, []Subscription{depth20}, []Subscription{depth5}},
+		{"kline period", []Subscription{kline1m}, []Subscription{kline1m, kline1h}, []Subscription{kline1h}, nil},
+		{"replace", []Subscription{ticker, kline1m}, []Subscription{depth5, kline1h}, []Subscription{depth5, kline1h}, []Subscription{ticker, kline1m}},
+	}
+	for _, tt := range tests {
+		added, removed := DiffSubscriptions(tt.current, tt.target)
+		if !reflect.DeepEqual(added, tt.wantAdded) {
+			t.Errorf("%s: added = %v, want %v", tt.name, added, tt.wantAdded)
+		}
+		if !reflect.DeepEqual(removed, tt.wantRemoved) {
+			t.Errorf("%s: removed = %v, want %v", tt.name, removed, tt.wantRemoved)
+		}
+	}
+}
+
+func TestSubscriptionString(t *testing.T) {
+	tests := []struct {
+		sub  Subscription
+		want string
+	}{
+		{Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TICKER}, "binance.btcusdt.ticker"},
+		{Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TRADE}, "binance.btcusdt.trade"},
+		{Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_DEPTH, Param: 10}, "binance.btcusdt.depth.10"},
+		{Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_KLINE, Param: KLINE_PERIOD_1H}, "binance.btcusdt.kline.1h"},
+	}
+	for _, tt := range tests {
+		if got := tt.sub.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.sub, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SYMBOL_STATUS_TRADING = "TRADING"
+
+//交易对元数据注册表，以交易所符号(小写)为键，供适配器取整、校验数值及对外查询
+type SymbolRegistry struct {
+	mu         sync.RWMutex
+	symbols    map[string]SymbolInfo
+	updateTime time.Time
+}
+
+func NewSymbolRegistry() *SymbolRegistry {
+	return &SymbolRegistry{symbols: make(map[string]SymbolInfo)}
+}
+
+//全量更新交易对信息，返回新上线及已下线的交易对
+func (this *SymbolRegistry) Update(symbols []SymbolInfo) (added, removed []string) {
+	next := make(map[string]SymbolInfo, len(symbols))
+	for _, s := range symbols {
+		next[strings.ToLower(s.Symbol)] = s
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for k := range next {
+		if _, ok := this.symbols[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	for k := range this.symbols {
+		if _, ok := next[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	this.symbols = next
+	this.updateTime = time.Now()
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func (this *SymbolRegistry) Get(symbol string) (SymbolInfo, bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	s, ok := this.symbols[strings.ToLower(symbol)]
+	return s, ok
+}
+
+//按交易对名称排序返回全部交易对
+func (this *SymbolRegistry) List() []SymbolInfo {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	list := make([]SymbolInfo, 0, len(this.symbols))
+	for _, s := range this.symbols {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Symbol < list[j].Symbol })
+	return list
+}
+
+func (this *SymbolRegistry) Len() int {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return len(this.symbols)
+}
+
+func (this *SymbolRegistry) UpdateTime() time.Time {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.updateTime
+}
+
+//价格按最小变动价位四舍五入，未知交易对原样返回
+func (this *SymbolRegistry) RoundPrice(symbol string, price Decimal) Decimal {
+	s, ok := this.Get(symbol)
+	if !ok {
+		return price
+	}
+	return price.RoundStep(s.TickSize)
+}
+
+//数量按最小变动数量向下取整，未知交易对原样返回
+func (this *SymbolRegistry) RoundAmount(symbol string, amount Decimal) Decimal {
+	s, ok := this.Get(symbol)
+	if !ok {
+		return amount
+	}
+	return amount.FloorStep(s.StepSize)
+}
+
+//校验交易对状态，以及价格、数量是否符合精度及最小下单限制
+func (this *SymbolRegistry) Validate(symbol string, price, amount Decimal) error {
+	s, ok := this.Get(symbol)
+	if !ok {
+		return fmt.Errorf("未知交易对: %s", symbol)
+	}
+	if s.Status != SYMBOL_STATUS_TRADING {
+		return fmt.Errorf("交易对 %s 当前状态为 %s", symbol, s.Status)
+	}
+	if !price.RoundStep(s.TickSize).Equal(price) {
+		return fmt.Errorf("交易对 %s 价格 %v 不符合最小变动价位 %v", symbol, price, s.TickSize)
+	}
+	if !amount.FloorStep(s.StepSize).Equal(amount) {
+		return fmt.Errorf("交易对 %s 数量 %v 不符合最小变动数量 %v", symbol, amount, s.StepSize)
+	}
+	if amount.Cmp(s.MinQty) < 0 {
+		return fmt.Errorf("交易对 %s 数量 %v 小于最小数量 %v", symbol, amount, s.MinQty)
+	}
+	if notional := price.Mul(amount); notional.Cmp(s.MinNotional) < 0 {
+		return fmt.Errorf("交易对 %s 成交额 %v 小于最小成交额 %v", symbol, notional, s.MinNotional)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRegistry() *SymbolRegistry {
+	registry := NewSymbolRegistry()
+	registry.Update([]SymbolInfo{
+		{
+			Symbol:      "BTCUSDT",
+			Status:      SYMBOL_STATUS_TRADING,
+			TickSize:    MustDecimal("0.01"),
+			StepSize:    MustDecimal("0.00001"),
+			MinQty:      MustDecimal("0.0001"),
+			MinNotional: MustDecimal("10"),
+		},
+		{Symbol: "LUNAUSDT", Status: "BREAK", TickSize: MustDecimal("0.0001"), StepSize: MustDecimal("0.1")},
+	})
+	return registry
+}
+
+func TestSymbolRegistryUpdate(t *testing.T) {
+	registry := newTestRegistry()
+	added, removed := registry.Update([]SymbolInfo{{Symbol: "BTCUSDT"}, {Symbol: "ETHUSDT"}, {Symbol: "BNBUSDT"}})
+	if want := []string{"bnbusdt", "ethusdt"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"lunausdt"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if _, ok := registry.Get("BtcUsdt"); !ok {
+		t.Error("Get is case sensitive")
+	}
+	var symbols []string
+	for _, s := range registry.List() {
+		symbols = append(symbols, s.Symbol)
+	}
+	if want := []string{"BNBUSDT", "BTCUSDT", "ETHUSDT"}; !reflect.DeepEqual(symbols, want) {
+		t.Errorf("List() = %v, want %v", symbols, want)
+	}
+}
+
+func TestSymbolRegistryRound(t *testing.T) {
+	registry := newTestRegistry()
+	tests := []struct {
+		symbol     string
+		value      string
+		wantPrice  string
+		wantAmount string
+	}{
+		{"btcusdt", "30000.125", "30000.13", "30000.12500"},
+		{"btcusdt", "30000.124", "30000.12", "30000.12400"},
+		{"btcusdt", "0.123456789", "0.12", "0.12345"},
+		{"btcusdt", "-1.005", "-1.01", "-1.00500"},
+		{"lunausdt", "1.23456", "1.2346", "1.2"},
+		{"ethusdt", "1.23456", "1.23456", "1.23456"},
+	}
+	for _, tt := range tests {
+		value := MustDecimal(tt.value)
+		if got := registry.RoundPrice(tt.symbol, value).String(); got != tt.wantPrice {
+			t.Errorf("RoundPrice(%s, %s) = %s, want %s", tt.symbol, tt.value, got, tt.wantPrice)
+		}
+		if got := registry.RoundAmount(tt.symbol, value).String(); got != tt.wantAmount {
+			t.Errorf("RoundAmount(%s, %s) = %s, want %s", tt.symbol, tt.value, got, tt.wantAmount)
+		}
+	}
+}
+
+func TestSymbolRegistryValidate(t *testing.T) {
+	registry := newTestRegistry()
+	tests := []struct {
+		name    string
+		symbol  string
+		price   string
+		amount  string
+		wantErr string
+	}{
+		{"valid", "btcusdt", "30000.01", "0.001", ""},
+		{"min notional", "btcusdt", "10", "1", ""},
+		{"unknown", "ethusdt", "1", "1", "未知交易对"},
+		{"not trading", "lunausdt", "1", "1", "当前状态为 BREAK"},
+		{"tick size", "btcusdt", "30000.001", "0.001", "最小变动价位"},
+		{"step size", "btcusdt", "30000", "0.000001", "最小变动数量"},
+		{"min qty", "btcusdt", "30000", "0.00001", "小于最小数量"},
+		{"below notional", "btcusdt", "9.99", "1", "小于最小成交额"},
+	}
+	for _, tt := range tests {
+		err := registry.Validate(tt.symbol, MustDecimal(tt.price), MustDecimal(tt.amount))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"wisp/common"
+	"wisp/sink"
+)
+
+//wisp配置文件，描述交易所订阅、代理、行情输出、服务及日志
+type Config struct {
+	Server    ServerConfig      `yaml:"server"`
+	Log       LogConfig         `yaml:"log"`
+	Proxies   map[string]string `yaml:"proxies"` //代理名称及地址，供交易所引用
+	Exchanges []ExchangeConfig  `yaml:"exchanges"`
+	Sinks     []sink.Config     `yaml:"sinks"`
+	Reload    ReloadConfig      `yaml:"reload"`
+}
+
+type ServerConfig struct {
+	Listen          string        `yaml:"listen"`           //websocket监听地址
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` //收到退出信号后等待关闭完成的最长时间
+	UserToken       string        `yaml:"user_token"`       //websocket客户端接收用户数据所需的令牌，为空时不推送用户数据
+	AdminListen     string        `yaml:"admin_listen"`     //管理接口监听地址，为空时与websocket共用listen，此时必须配置admin_token
+	AdminToken      string        `yaml:"admin_token"`      //管理接口令牌，请求以 Authorization: Bearer 携带，为空时不校验
+}
+
+//配置热加载，也可通过SIGHUP触发
+type ReloadConfig struct {
+	Watch    bool          `yaml:"watch"`    //是否监测配置文件变化
+	Interval time.Duration `yaml:"interval"` //检查间隔
+}
+
+type LogConfig struct {
+	Dir        string            `yaml:"dir"`         //日志目录
+	Level      string            `yaml:"level"`       //全局日志等级
+	Format     string            `yaml:"format"`      //日志文件格式: text 或 json
+	Modules    map[string]string `yaml:"modules"`     //模块日志等级，如 ws: debug
+	MaxSize    int64             `yaml:"max_size"`    //单个日志文件最大MB数，0为不限制
+	MaxBackups int               `yaml:"max_backups"` //最多保留的历史日志文件数，0为不限制
+	MaxAge     time.Duration     `yaml:"max_age"`     //历史日志最长保留时间，0为不限制
+	Compress   bool              `yaml:"compress"`    //是否gzip压缩历史日志
+	Overflow   string            `yaml:"overflow"`    //日志通道写满时的处理策略
+	Outputs    []LogOutput       `yaml:"outputs"`     //文件以外的日志输出
+	Alert      string            `yaml:"alert"`       //ERROR日志告警地址
+	Sample     SampleConfig      `yaml:"sample"`      //行情回调日志采样
+}
+
+type LogOutput struct {
+	Name   string `yaml:"name"` //stdout、stderr、syslog 或 syslog://udp/host:514
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type SampleConfig struct {
+	First    int           `yaml:"first"`    //每个周期内每个交易标的及频道先输出的条数
+	Every    int           `yaml:"every"`    //超出后每多少条输出一条，0为不再输出
+	Interval time.Duration `yaml:"interval"` //采样周期
+}
+
+//交易所订阅配置
+type ExchangeConfig struct {
+	Name          string        `yaml:"name"`
+	Proxy         string        `yaml:"proxy"` //代理名称或地址，为空时直连
+	ApiKey        string        `yaml:"api_key"`
+	SecretKey     string        `yaml:"secret_key"`
+	SymbolRefresh time.Duration `yaml:"symbol_refresh"` //交易对元数据刷新间隔，0为仅启动时加载
+	Symbols       []string      `yaml:"symbols"`        //交易所符号或 BASE/QUOTE
+	Channels      []string      `yaml:"channels"`       //depth、ticker、kline、trade
+	DepthSize     int           `yaml:"depth_size"`     //深度档数: 5/10/20
+	Klines        []string      `yaml:"klines"`         //K线周期，如 1m、1h
+}
+
+//默认配置，与配置文件合并，文件中未出现的项沿用默认值
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Listen: ":8080", ShutdownTimeout: 15 * time.Second, AdminListen: "127.0.0.1:8081"},
+		Reload: ReloadConfig{Watch: true, Interval: 5 * time.Second},
+		Log: LogConfig{
+			Dir:        "logs",
+			Level:      "info",
+			Format:     "text",
+			MaxSize:    100,
+			MaxBackups: 30,
+			MaxAge:     30 * 24 * time.Hour,
+			Compress:   true,
+			Overflow:   "drop-newest",
+			Outputs:    []LogOutput{{Name: "stdout"}},
+			Sample:     SampleConfig{First: 5, Every: 1000, Interval: time.Minute},
+		},
+	}
+}
+
+//读取配置文件，展开 ${VAR} 环境变量并应用 WISP_ 前缀的环境变量覆盖后校验
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+func Decode(r io.Reader) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg := Default()
+	if err := yaml.UnmarshalStrict([]byte(expandEnv(string(data))), cfg); err != nil {
+		return nil, err
+	}
+	cfg.applyEnv(os.Getenv)
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+//仅展开 ${VAR} 形式，避免密码等值中的 $ 被误替换
+func expandEnv(s string) string {
+	return envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return os.Getenv(envPattern.FindStringSubmatch(m)[1])
+	})
+}
+
+//环境变量覆盖:
+//WISP_LISTEN、WISP_LOG_LEVEL、WISP_LOG_FORMAT、WISP_LOG_DIR，
+//WISP_<交易所>_PROXY、WISP_<交易所>_SYMBOLS(逗号分隔)、WISP_<交易所>_API_KEY、WISP_<交易所>_SECRET_KEY
+func (this *Config) applyEnv(getenv func(string) string) {
+	set := func(key string, value *string) {
+		if v := getenv(key); v != "" {
+			*value = v
+		}
+	}
+	set("WISP_LISTEN", &this.Server.Listen)
+	set("WISP_LOG_LEVEL", &this.Log.Level)
+	set("WISP_LOG_FORMAT", &this.Log.Format)
+	set("WISP_LOG_DIR", &this.Log.Dir)
+
+	for i := range this.Exchanges {
+		ex := &this.Exchanges[i]
+		prefix := "WISP_" + strings.ToUpper(ex.Name) + "_"
+		set(prefix+"PROXY", &ex.Proxy)
+		set(prefix+"API_KEY", &ex.ApiKey)
+		set(prefix+"SECRET_KEY", &ex.SecretKey)
+		if v := getenv(prefix + "SYMBOLS"); v != "" {
+			ex.Symbols = splitList(v)
+		}
+	}
+}
+
+//统一大小写并去掉空白
+func (this *Config) normalize() {
+	for i := range this.Exchanges {
+		ex := &this.Exchanges[i]
+		ex.Name = strings.ToLower(strings.TrimSpace(ex.Name))
+		for j := range ex.Symbols {
+			ex.Symbols[j] = strings.TrimSpace(ex.Symbols[j])
+		}
+		for j := range ex.Channels {
+			ex.Channels[j] = strings.ToLower(strings.TrimSpace(ex.Channels[j]))
+		}
+		if ex.DepthSize == 0 {
+			ex.DepthSize = 5
+		}
+		if len(ex.Klines) == 0 && ex.hasChannel(common.CHANNEL_KLINE) {
+			ex.Klines = []string{common.KLINE_PERIOD[common.KLINE_PERIOD_1MIN]}
+		}
+	}
+}
+
+//交易所使用的代理地址，proxy为代理名称时取 proxies 中的地址
+func (this *Config) ProxyUrl(ex ExchangeConfig) string {
+	if url, ok := this.Proxies[ex.Proxy]; ok {
+		return url
+	}
+	return ex.Proxy
+}
+
+//查找交易所配置
+func (this *Config) Exchange(name string) (ExchangeConfig, bool) {
+	for _, ex := range this.Exchanges {
+		if ex.Name == name {
+			return ex, true
+		}
+	}
+	return ExchangeConfig{}, false
+}
+
+func (this ExchangeConfig) hasChannel(channel string) bool {
+	for _, c := range this.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+//展开交易所的交易标的及频道为订阅项，按字符串排序
+func (this ExchangeConfig) Subscriptions() []common.Subscription {
+	subs := make([]common.Subscription, 0, len(this.Symbols)*len(this.Channels))
+	for _, symbol := range this.Symbols {
+		for _, channel := range this.Channels {
+			switch channel {
+			case common.CHANNEL_DEPTH:
+				subs = append(subs, common.Subscription{Exchange: this.Name, Symbol: symbol, Channel: channel, Param: this.DepthSize})
+			case common.CHANNEL_KLINE:
+				for _, k := range this.Klines {
+					period, _ := common.ParseKlinePeriod(k)
+					subs = append(subs, common.Subscription{Exchange: this.Name, Symbol: symbol, Channel: channel, Param: period})
+				}
+			default:
+				subs = append(subs, common.Subscription{Exchange: this.Name, Symbol: symbol, Channel: channel})
+			}
+		}
+	}
+	common.SortSubscriptions(subs)
+	return subs
+}
+
+//所有交易所的订阅项
+func (this *Config) Subscriptions() []common.Subscription {
+	var subs []common.Subscription
+	for _, ex := range this.Exchanges {
+		subs = append(subs, ex.Subscriptions()...)
+	}
+	return subs
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"wisp/common"
+	"wisp/sink"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   []string //每条问题应包含的内容，为空表示校验通过
+	}{
+		{"default", func(cfg *Config) {}, nil},
+		{"exchange", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{Name: "binance", Symbols: []string{"btcusdt", "ETH/USDT"}, Channels: []string{"depth", "kline"}, DepthSize: 10, Klines: []string{"1m", "1h"}}}
+		}, nil},
+		{"empty listen", func(cfg *Config) { cfg.Server.Listen = "" }, []string{"server.listen"}},
+		{"shutdown timeout", func(cfg *Config) { cfg.Server.ShutdownTimeout = 0 }, []string{"server.shutdown_timeout"}},
+		{"shared admin without token", func(cfg *Config) { cfg.Server.AdminListen = "" }, []string{"server.admin_token"}},
+		{"shared admin with token", func(cfg *Config) { cfg.Server.AdminListen, cfg.Server.AdminToken = "", "secret" }, nil},
+		{"admin on listen", func(cfg *Config) { cfg.Server.AdminListen = cfg.Server.Listen }, []string{"server.admin_listen"}},
+		{"reload interval", func(cfg *Config) { cfg.Reload.Interval = 0 }, []string{"reload.interval"}},
+		{"reload interval unused", func(cfg *Config) { cfg.Reload.Watch, cfg.Reload.Interval = false, 0 }, nil},
+		{"log", func(cfg *Config) {
+			cfg.Log.Dir = ""
+			cfg.Log.Level = "verbose"
+			cfg.Log.Format = "xml"
+			cfg.Log.Modules = map[string]string{"ws": "loud"}
+			cfg.Log.MaxBackups = -1
+			cfg.Log.Overflow = "spill"
+		}, []string{"log.dir", "log.level", "log.format", "log.modules.ws", "max_backups", "log.overflow"}},
+		{"log outputs", func(cfg *Config) {
+			cfg.Log.Outputs = []LogOutput{{}, {Name: "stderr", Level: "loud", Format: "xml"}}
+		}, []string{"log.outputs[0]: name", "log.outputs[1]: 未知的日志等级", "log.outputs[1]: 未知的日志格式"}},
+		{"log alert", func(cfg *Config) { cfg.Log.Alert = "ftp://alert" }, []string{"log.alert"}},
+		{"log sample", func(cfg *Config) { cfg.Log.Sample.Every = -1 }, []string{"log.sample"}},
+		{"proxies", func(cfg *Config) {
+			cfg.Proxies = map[string]string{"b": "ftp://127.0.0.1:21", "a": "127.0.0.1"}
+		}, []string{"proxies.a: 代理地址格式错误", "proxies.b: 不支持的代理协议"}},
+		{"named proxy", func(cfg *Config) {
+			cfg.Proxies = map[string]string{"local": "socks5://127.0.0.1:1080"}
+			cfg.Exchanges = []ExchangeConfig{{Name: "binance", Proxy: "local", DepthSize: 5}}
+		}, nil},
+		{"unknown exchange", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{Name: "okex", DepthSize: 5}}
+		}, []string{"exchanges.okex: 未知的交易所"}},
+		{"duplicate exchange", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{Name: "binance", DepthSize: 5}, {Name: "binance", DepthSize: 5}}
+		}, []string{"exchanges.binance: 交易所重复配置"}},
+		{"exchange problems", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{
+				Name:          "binance",
+				Proxy:         "socks4://127.0.0.1:1080",
+				SymbolRefresh: -time.Second,
+				Symbols:       []string{"btcusdt", "BTCUSDT", "", "BTC/"},
+				Channels:      []string{"depth", "orders"},
+				DepthSize:     15,
+				Klines:        []string{"7m"},
+			}}
+		}, []string{
+			"exchanges.binance.proxy: 不支持的代理协议",
+			"exchanges.binance.symbol_refresh",
+			"交易标的 BTCUSDT 重复",
+			"交易标的不能为空",
+			"交易对格式错误",
+			"未知的频道 \"orders\"",
+			"exchanges.binance.depth_size",
+			"未知的K线周期 \"7m\"",
+		}},
+		{"channels without symbols", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{Name: "binance", Channels: []string{"ticker"}, DepthSize: 5}}
+		}, []string{"配置了频道但没有交易标的"}},
+		{"unnamed exchange", func(cfg *Config) {
+			cfg.Exchanges = []ExchangeConfig{{DepthSize: 5}}
+		}, []string{"exchanges[0]: 未知的交易所"}},
+		{"sinks", func(cfg *Config) {
+			cfg.Sinks = []sink.Config{{Type: sink.TypeKafka, Encoding: "protobuf"}, {Type: "zmq", Encoding: "xml"}}
+		}, []string{"sinks[1]: 未知的行情输出类型", "sinks[1]: 未知的行情编码"}},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if len(tt.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*ConfigError)
+		if !ok {
+			t.Errorf("%s: err = %v, want *ConfigError", tt.name, err)
+			continue
+		}
+		if len(e.Problems) != len(tt.want) {
+			t.Errorf("%s: got %d problems %q, want %d", tt.name, len(e.Problems), e.Problems, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(e.Problems[i], want) {
+				t.Errorf("%s: problem %d = %q, want it to contain %q", tt.name, i, e.Problems[i], want)
+			}
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want func(cfg *Config)
+	}{
+		{"none", nil, func(cfg *Config) {}},
+		{"server and log", map[string]string{
+			"WISP_LISTEN":     ":9090",
+			"WISP_LOG_LEVEL":  "debug",
+			"WISP_LOG_FORMAT": "json",
+			"WISP_LOG_DIR":    "/var/log/wisp",
+		}, func(cfg *Config) {
+			cfg.Server.Listen = ":9090"
+			cfg.Log.Level = "debug"
+			cfg.Log.Format = "json"
+			cfg.Log.Dir = "/var/log/wisp"
+		}},
+		{"exchange", map[string]string{
+			"WISP_BINANCE_PROXY":      "socks5://127.0.0.1:1080",
+			"WISP_BINANCE_API_KEY":    "key",
+			"WISP_BINANCE_SECRET_KEY": "secret",
+			"WISP_BINANCE_SYMBOLS":    " btcusdt, ,ETH/USDT ",
+		}, func(cfg *Config) {
+			ex := &cfg.Exchanges[0]
+			ex.Proxy = "socks5://127.0.0.1:1080"
+			ex.ApiKey = "key"
+			ex.SecretKey = "secret"
+			ex.Symbols = []string{"btcusdt", "ETH/USDT"}
+		}},
+		{"empty value keeps file", map[string]string{"WISP_LISTEN": "", "WISP_BINANCE_SYMBOLS": ""}, func(cfg *Config) {}},
+		{"other exchange", map[string]string{"WISP_OKEX_API_KEY": "key"}, func(cfg *Config) {}},
+	}
+	for _, tt := range tests {
+		newConfig := func() *Config {
+			cfg := Default()
+			cfg.Exchanges = []ExchangeConfig{{Name: "binance", Symbols: []string{"ltcusdt"}, ApiKey: "file"}}
+			return cfg
+		}
+		got, want := newConfig(), newConfig()
+		got.applyEnv(func(key string) string { return tt.env[key] })
+		tt.want(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: applyEnv = %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	os.Setenv("WISP_TEST_API_KEY", "k$y")
+	defer os.Unsetenv("WISP_TEST_API_KEY")
+
+	tests := []struct {
+		name    string
+		yaml    string
+		check   func(cfg *Config) bool
+		wantErr string
+	}{
+		{"defaults", "server:\n  admin_token: secret\n", func(cfg *Config) bool {
+			return cfg.Server.Listen == ":8080" && cfg.Server.AdminListen == "127.0.0.1:8081" && cfg.Log.Level == "info"
+		}, ""},
+		{"expand env", "exchanges:\n  - name: binance\n    api_key: ${WISP_TEST_API_KEY}\n    secret_key: pa$$word\n", func(cfg *Config) bool {
+			ex := cfg.Exchanges[0]
+			return ex.ApiKey == "k$y" && ex.SecretKey == "pa$$word"
+		}, ""},
+		{"unset env", "exchanges:\n  - name: binance\n    api_key: ${WISP_TEST_UNSET}\n", func(cfg *Config) bool {
+			return cfg.Exchanges[0].ApiKey == ""
+		}, ""},
+		{"normalize", "exchanges:\n  - name: ' Binance '\n    symbols: [' btcusdt ']\n    channels: [' Kline ', DEPTH]\n", func(cfg *Config) bool {
+			ex := cfg.Exchanges[0]
+			return ex.Name == "binance" && ex.Symbols[0] == "btcusdt" && ex.DepthSize == 5 &&
+				reflect.DeepEqual(ex.Channels, []string{"kline", "depth"}) && reflect.DeepEqual(ex.Klines, []string{"1m"})
+		}, ""},
+		{"subscriptions", "exchanges:\n  - name: binance\n    symbols: [btcusdt]\n    channels: [ticker, kline]\n    klines: [1m, 1h]\n", func(cfg *Config) bool {
+			return reflect.DeepEqual(cfg.Subscriptions(), []common.Subscription{
+				{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_KLINE, Param: common.KLINE_PERIOD_1H},
+				{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_KLINE, Param: common.KLINE_PERIOD_1MIN},
+				{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_TICKER},
+			})
+		}, ""},
+		{"unknown field", "server:\n  port: 8080\n", nil, "field port not found"},
+		{"invalid", "server:\n  listen: ''\n", nil, "server.listen"},
+	}
+	for _, tt := range tests {
+		cfg, err := Decode(strings.NewReader(tt.yaml))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !tt.check(cfg) {
+			t.Errorf("%s: unexpected config %+v", tt.name, cfg)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"wisp/codec"
+	"wisp/common"
+	"wisp/log"
+	"wisp/sink"
+)
+
+//配置校验错误，列出所有不合法的配置项
+type ConfigError struct {
+	Problems []string
+}
+
+func (this *ConfigError) Error() string {
+	return "配置错误: " + strings.Join(this.Problems, "; ")
+}
+
+func (this *ConfigError) add(format string, v ...interface{}) {
+	this.Problems = append(this.Problems, fmt.Sprintf(format, v...))
+}
+
+//支持的交易所
+var exchangeNames = []string{common.BINANCE}
+
+var channels = []string{common.CHANNEL_DEPTH, common.CHANNEL_TICKER, common.CHANNEL_KLINE, common.CHANNEL_TRADE}
+
+var sinkTypes = []string{sink.TypeAMQP, sink.TypeKafka, sink.TypeNATS, sink.TypeRedis}
+
+func (this *Config) Validate() error {
+	e := &ConfigError{}
+
+	if this.Server.Listen == "" {
+		e.add("server.listen 不能为空")
+	}
+	if this.Server.ShutdownTimeout <= 0 {
+		e.add("server.shutdown_timeout 须大于0")
+	}
+	if this.Server.AdminListen == "" && this.Server.AdminToken == "" {
+		e.add("server.admin_token: 管理接口与websocket共用监听地址时必须配置令牌")
+	}
+	if this.Server.AdminListen != "" && this.Server.AdminListen == this.Server.Listen {
+		e.add("server.admin_listen 不能与 listen 相同，共用时留空并配置 admin_token")
+	}
+	this.validateLog(e)
+	if this.Reload.Watch && this.Reload.Interval <= 0 {
+		e.add("reload.interval: 监测配置文件时检查间隔须大于0")
+	}
+
+	names := make([]string, 0, len(this.Proxies))
+	for name := range this.Proxies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		validateProxy(e, fmt.Sprintf("proxies.%s", name), this.Proxies[name])
+	}
+
+	seen := make(map[string]bool)
+	for i, ex := range this.Exchanges {
+		where := fmt.Sprintf("exchanges[%d]", i)
+		if ex.Name != "" {
+			where = fmt.Sprintf("exchanges.%s", ex.Name)
+		}
+		this.validateExchange(e, where, ex)
+		if seen[ex.Name] {
+			e.add("%s: 交易所重复配置", where)
+		}
+		seen[ex.Name] = true
+	}
+
+	for i, s := range this.Sinks {
+		where := fmt.Sprintf("sinks[%d]", i)
+		if !contains(sinkTypes, s.Type) {
+			e.add("%s: 未知的行情输出类型 %q", where, s.Type)
+		}
+		if _, err := codec.Get(s.Encoding); err != nil {
+			e.add("%s: 未知的行情编码 %q", where, s.Encoding)
+		}
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (this *Config) validateLog(e *ConfigError) {
+	l := this.Log
+	if l.Dir == "" {
+		e.add("log.dir 不能为空")
+	}
+	if !validLevel(l.Level) {
+		e.add("log.level: 未知的日志等级 %q", l.Level)
+	}
+	if _, err := log.NewEncoder(l.Format, ""); err != nil {
+		e.add("log.format: 未知的日志格式 %q", l.Format)
+	}
+	for module, level := range l.Modules {
+		if !validLevel(level) {
+			e.add("log.modules.%s: 未知的日志等级 %q", module, level)
+		}
+	}
+	if l.MaxSize < 0 || l.MaxBackups < 0 || l.MaxAge < 0 {
+		e.add("log: max_size、max_backups 及 max_age 不能为负数")
+	}
+	if _, err := log.ParseOverflowPolicy(l.Overflow); err != nil {
+		e.add("log.overflow: %v", err)
+	}
+	for i, out := range l.Outputs {
+		where := fmt.Sprintf("log.outputs[%d]", i)
+		if out.Name == "" {
+			e.add("%s: name 不能为空", where)
+		}
+		if out.Level != "" && !validLevel(out.Level) {
+			e.add("%s: 未知的日志等级 %q", where, out.Level)
+		}
+		if _, err := log.NewEncoder(out.Format, ""); err != nil {
+			e.add("%s: 未知的日志格式 %q", where, out.Format)
+		}
+	}
+	if l.Alert != "" {
+		if u, err := url.Parse(l.Alert); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			e.add("log.alert: 告警地址需为http(s)地址 %q", l.Alert)
+		}
+	}
+	if l.Sample.First < 0 || l.Sample.Every < 0 || l.Sample.Interval < 0 {
+		e.add("log.sample: first、every 及 interval 不能为负数")
+	}
+}
+
+func (this *Config) validateExchange(e *ConfigError, where string, ex ExchangeConfig) {
+	if !contains(exchangeNames, ex.Name) {
+		e.add("%s: 未知的交易所 %q，支持 %s", where, ex.Name, strings.Join(exchangeNames, "、"))
+	}
+	if ex.Proxy != "" {
+		if _, ok := this.Proxies[ex.Proxy]; !ok {
+			validateProxy(e, where+".proxy", ex.Proxy)
+		}
+	}
+	if ex.SymbolRefresh < 0 {
+		e.add("%s.symbol_refresh 不能为负数", where)
+	}
+	if len(ex.Channels) > 0 && len(ex.Symbols) == 0 {
+		e.add("%s: 配置了频道但没有交易标的", where)
+	}
+
+	symbols := make(map[string]bool)
+	for _, symbol := range ex.Symbols {
+		if symbol == "" {
+			e.add("%s.symbols: 交易标的不能为空", where)
+			continue
+		}
+		if common.IsInstrument(symbol) {
+			if _, err := common.ParseInstrument(symbol); err != nil {
+				e.add("%s.symbols: %v", where, err)
+			}
+		}
+		if symbols[strings.ToLower(symbol)] {
+			e.add("%s.symbols: 交易标的 %s 重复", where, symbol)
+		}
+		symbols[strings.ToLower(symbol)] = true
+	}
+	for _, channel := range ex.Channels {
+		if !contains(channels, channel) {
+			e.add("%s.channels: 未知的频道 %q，支持 %s", where, channel, strings.Join(channels, "、"))
+		}
+	}
+	if ex.DepthSize != 5 && ex.DepthSize != 10 && ex.DepthSize != 20 {
+		e.add("%s.depth_size: 深度档数只能为 5/10/20", where)
+	}
+	for _, k := range ex.Klines {
+		if _, ok := common.ParseKlinePeriod(k); !ok {
+			e.add("%s.klines: 未知的K线周期 %q", where, k)
+		}
+	}
+}
+
+func validateProxy(e *ConfigError, where, proxy string) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		e.add("%s: 代理地址格式错误 %q", where, proxy)
+		return
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		e.add("%s: 不支持的代理协议 %q，支持 http、https、socks5", where, u.Scheme)
+	}
+}
+
+//日志等级名称是否合法，ParseLevel 对未知名称返回INFO
+func validLevel(level string) bool {
+	return log.ParseLevel(level).String() == strings.ToUpper(level)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
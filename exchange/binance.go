@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/json-iterator/go"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 	. "wisp/common"
@@ -15,66 +15,281 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+var binanceLog = log.Named("exchange").WithField("exchange", BINANCE)
+
 type binanceExchange struct {
 	*ws.WebsocketBuilder
 	sync.Once
 	*ws.WebsocketConnection
+	apiConfig       *APIConfig
+	rest            *binanceRestClient
+	symbols         *SymbolRegistry
 	baseUrl         string
 	combinedBaseUrl string //组合订阅地址
 	depthCallback   func(*Depth)
 	klineCallback   func(*Kline, int)
 	tickerCallback  func(*Ticker)
+	tradeCallback   func(*Trade)
+	eventCallback   func(*MarketEvent)
+	sequencer       *Sequencer
+	streams         map[string]*ws.WebsocketConnection //订阅的数据流及其连接，如 btcusdt@trade
+	streamsL        sync.Mutex
+
+	executionReportCallback func(*ExecutionReport)
+	accountPositionCallback func(*AccountPosition)
+	balanceUpdateCallback   func(*BalanceUpdate)
+	userStream              *binanceUserStream //用户数据流，由userStreamL保护
+	userStreamPending       bool               //用户数据流连接建立中，由userStreamL保护
+	userStreamL             sync.Mutex
 }
 
 func NewBinanceExchange() *binanceExchange {
+	return NewBinanceExchangeWithConfig(&APIConfig{})
+}
+
+func NewBinanceExchangeWithConfig(config *APIConfig) *binanceExchange {
 	binance := &binanceExchange{WebsocketBuilder: ws.NewWebsocketBuilder()}
+	binance.apiConfig = config
+	binance.rest = NewBinanceRestClient(config)
+	binance.symbols = NewSymbolRegistry()
+	binance.sequencer = NewSequencer()
+	binance.streams = make(map[string]*ws.WebsocketConnection)
 	binance.baseUrl = "wss://stream.binance.com:9443/ws"
 	binance.combinedBaseUrl = "wss://stream.binance.com/stream?streams="
 	return binance
 }
 
+func (this *binanceExchange) GetExchangeName() string {
+	return BINANCE
+}
+
+//rest行情接口
+func (this *binanceExchange) Rest() *binanceRestClient {
+	return this.rest
+}
+
 func (this *binanceExchange) connect() {
 	this.Do(func() {
-		this.WebsocketConnection = this.WebsocketBuilder.Build()
-		this.WebsocketConnection.RecvMsg()
+		conn, err := this.WebsocketBuilder.Build()
+		if err != nil {
+			binanceLog.Error("币安连接失败: %v\n", err.Error())
+			return
+		}
+		this.WebsocketConnection = conn
+		conn.RecvMsg()
 	})
 }
 
 func (this *binanceExchange) protocolHandle(data []byte) error {
 	text := string(data)
-	log.Info("币安消息: %v\n", text)
+	binanceLog.Info("币安消息: %v\n", text)
 	return nil
 }
 
-func (this *binanceExchange) errorHandle(err error) {
-	log.Info("币安异常信息: %v\n", err.Error())
-	this.Reconnect()
+//数据流连接异常时重连该连接，重连失败时连接保持关闭，下次读取出错时再次重连
+func (this *binanceExchange) errorHandle(conn *ws.WebsocketConnection, err error) {
+	binanceLog.Info("币安异常信息: conn_id=%d %v\n", conn.Id(), err.Error())
+	if err := conn.Reconnect(); err != nil {
+		binanceLog.Error("币安重连失败: conn_id=%d %v\n", conn.Id(), err.Error())
+	}
 }
 
-func (this *binanceExchange) subscribe(endpoint string, handle func(msg []byte) error) {
-	builder := ws.NewWebsocketBuilder().
+func (this *binanceExchange) newStreamBuilder(endpoint string, handle func(msg []byte) error) *ws.WebsocketBuilder {
+	return ws.NewWebsocketBuilder().
 		SetWebsocketUrl(endpoint).
 		SetReconnectIntervalTime(12 * time.Hour).
 		SetProtocolHandle(handle).
 		OpenDump().
-		SetProxyUrl("socks5://127.0.0.1:1080").
 		//SetHeartBeat([]byte("pong"), 2*time.Second).
-		SetErrorHandle(this.errorHandle)
-	conn := builder.Build()
+		SetProxyUrl(this.apiConfig.ProxyUrl)
+}
+
+//每个数据流使用独立连接，重复订阅返回错误
+func (this *binanceExchange) subscribe(stream string, handle func(msg []byte) error) error {
+	this.streamsL.Lock()
+	_, ok := this.streams[stream]
+	this.streamsL.Unlock()
+	if ok {
+		return fmt.Errorf("重复订阅: %s", stream)
+	}
+
+	//连接建立后才会开始读取，异常回调中conn已赋值
+	var conn *ws.WebsocketConnection
+	conn, err := this.newStreamBuilder(this.combinedBaseUrl+stream, handle).
+		SetErrorHandle(func(err error) { this.errorHandle(conn, err) }).
+		Build()
+	if err != nil {
+		return fmt.Errorf("订阅 %s 连接失败: %v", stream, err)
+	}
+	this.streamsL.Lock()
+	if _, ok := this.streams[stream]; ok {
+		this.streamsL.Unlock()
+		conn.Shutdown()
+		return fmt.Errorf("重复订阅: %s", stream)
+	}
+	this.streams[stream] = conn
+	this.streamsL.Unlock()
 	conn.RecvMsg()
+	return nil
+}
+
+//关闭数据流的连接
+func (this *binanceExchange) unsubscribe(stream string) error {
+	this.streamsL.Lock()
+	conn, ok := this.streams[stream]
+	delete(this.streams, stream)
+	this.streamsL.Unlock()
+	if !ok {
+		return fmt.Errorf("未订阅: %s", stream)
+	}
+	conn.Shutdown()
+	binanceLog.Info("取消订阅: %s\n", stream)
+	return nil
+}
+
+//已订阅的数据流
+func (this *binanceExchange) Streams() []string {
+	this.streamsL.Lock()
+	defer this.streamsL.Unlock()
+	streams := make([]string, 0, len(this.streams))
+	for stream := range this.streams {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+//关闭所有数据流连接，取消用户数据流并删除listenKey
+func (this *binanceExchange) Close() error {
+	this.streamsL.Lock()
+	streams := this.streams
+	this.streams = make(map[string]*ws.WebsocketConnection)
+	this.streamsL.Unlock()
+	for _, conn := range streams {
+		conn.Shutdown()
+	}
+	if stream := this.takeUserStream(); stream != nil {
+		return this.closeUserStream(stream)
+	}
+	return nil
+}
+
+//各数据流及用户数据流连接的状态，按连接编号排序
+func (this *binanceExchange) Connections() []ws.ConnectionState {
+	this.streamsL.Lock()
+	states := make([]ws.ConnectionState, 0, len(this.streams)+1)
+	for stream, conn := range this.streams {
+		state := conn.State()
+		state.Streams = []string{stream}
+		states = append(states, state)
+	}
+	this.streamsL.Unlock()
+
+	if stream := this.currentUserStream(); stream != nil {
+		state := stream.conn.State()
+		//地址中的listenKey不对外展示
+		state.Url = this.baseUrl
+		state.Streams = []string{"userData"}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Id < states[j].Id })
+	return states
+}
+
+//强制指定连接重连，重连失败时返回错误
+func (this *binanceExchange) ReconnectConnection(id uint64) error {
+	var conn *ws.WebsocketConnection
+	this.streamsL.Lock()
+	for _, c := range this.streams {
+		if c.Id() == id {
+			conn = c
+		}
+	}
+	this.streamsL.Unlock()
+	if stream := this.currentUserStream(); conn == nil && stream != nil && stream.conn.Id() == id {
+		conn = stream.conn
+	}
+	if conn == nil {
+		return fmt.Errorf("连接不存在: %d", id)
+	}
+
+	binanceLog.Warn("强制重连: conn_id=%d\n", id)
+	if err := conn.Reconnect(); err != nil {
+		return fmt.Errorf("连接 %d 重连失败: %v", id, err)
+	}
+	return nil
+}
+
+func depthStream(symbol string, size int) string {
+	return fmt.Sprintf("%s@depth%d@1000ms", symbol, size)
+}
+
+func tickerStream(symbol string) string {
+	return symbol + "@miniTicker"
+}
+
+func klineStream(symbol string, period int) string {
+	res, ok := KLINE_PERIOD[period]
+	if !ok {
+		res = "1m"
+	}
+	return symbol + "@kline_" + res
+}
+
+func tradeStream(symbol string) string {
+	return symbol + "@trade"
+}
+
+func (this *binanceExchange) UnsubDepths(symbol string, size int) error {
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	return this.unsubscribe(depthStream(symbol, size))
+}
+
+func (this *binanceExchange) UnsubTicker(symbol string) error {
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	return this.unsubscribe(tickerStream(symbol))
+}
+
+func (this *binanceExchange) UnsubKline(symbol string, period int) error {
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	return this.unsubscribe(klineStream(symbol, period))
+}
+
+func (this *binanceExchange) UnsubTrade(symbol string) error {
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	return this.unsubscribe(tradeStream(symbol))
 }
 
 func (this *binanceExchange) SubDepths(symbol string, size int) error {
-	if this.depthCallback == nil {
+	if this.depthCallback == nil && this.eventCallback == nil {
 		return errors.New("深度回调方法未初始化")
 	}
 	if size != 5 && size != 10 && size != 20 {
 		return errors.New("深度订阅错误，超出档数: 5/10/20")
 	}
-	endpoint := fmt.Sprintf("%s%s@depth%d@1000ms", this.combinedBaseUrl, strings.ToLower(symbol), size)
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if err := this.checkSymbol(symbol); err != nil {
+		return err
+	}
 	//log.Info("打印深度端点: %s\n", endpoint)
 	handle := func(msg []byte) error {
 		//log.Info("打印消息: %v\n",string(msg))
+		receiveTime := time.Now()
 		rawDepth := struct {
 			Stream string `json:"stream"`
 			Data   struct {
@@ -88,26 +303,41 @@ func (this *binanceExchange) SubDepths(symbol string, size int) error {
 			return err
 		}
 
-		depth := this.parseDepthData(rawDepth.Data.Bids, rawDepth.Data.Asks)
+		depth, err := this.parseDepthData(rawDepth.Data.Bids, rawDepth.Data.Asks)
+		if err != nil {
+			return err
+		}
 		depth.Symbol = symbol
-		depth.UTime = time.Now()
-		this.depthCallback(depth)
+		depth.LastUpdateId = rawDepth.Data.LastUpdateID
+		depth.UTime = receiveTime
+		this.roundDepth(depth)
+		//部分深度推送(<symbol>@depth<levels>)只有lastUpdateId，不含事件时间E，ExchangeTime为0
+		this.dispatch(NewDepthEvent(BINANCE, depth), 0, receiveTime)
+		if this.depthCallback != nil {
+			this.depthCallback(depth)
+		}
 		return nil
 	}
-	this.subscribe(endpoint, handle)
-	return nil
+	return this.subscribe(depthStream(symbol, size), handle)
 }
 
 func (this *binanceExchange) SubTicker(symbol string) error {
-	if this.tickerCallback == nil {
+	if this.tickerCallback == nil && this.eventCallback == nil {
 		return errors.New("ticker回调函数未初始化")
 	}
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if err := this.checkSymbol(symbol); err != nil {
+		return err
+	}
 
-	endpoint := fmt.Sprintf("%s%s@miniTicker", this.combinedBaseUrl, strings.ToLower(symbol))
 	//endpoint = this.combinedBaseUrl + "btcusdt@miniTicker"
 
 	handle := func(msg []byte) error {
 		//log.Info("打印消息: %v\n", string(msg))
+		receiveTime := time.Now()
 		dataMap := make(map[string]interface{})
 		err := json.Unmarshal(msg, &dataMap)
 		if err != nil {
@@ -121,30 +351,38 @@ func (this *binanceExchange) SubTicker(symbol string) error {
 		switch msgType {
 		case "24hrMiniTicker":
 
-			ticker := this.parseTicker(data)
+			ticker, err := this.parseTicker(data)
+			if err != nil {
+				return err
+			}
 			ticker.Symbol = symbol
-			this.tickerCallback(ticker)
+			this.roundTicker(ticker)
+			this.dispatch(NewTickerEvent(BINANCE, ticker), int64(ticker.Date), receiveTime)
+			if this.tickerCallback != nil {
+				this.tickerCallback(ticker)
+			}
 			return nil
 
 		default:
 			return errors.New("未知消息类型")
 		}
-		return nil
 	}
-	this.subscribe(endpoint, handle)
-	return nil
+	return this.subscribe(tickerStream(symbol), handle)
 }
 
 func (this *binanceExchange) SubKline(symbol string, period int) error {
-	if this.klineCallback == nil {
+	if this.klineCallback == nil && this.eventCallback == nil {
 		return errors.New("kline回调函数未初始化")
 	}
-	res, ok := KLINE_PERIOD[period]
-	if !ok {
-		res = "1m"
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if err := this.checkSymbol(symbol); err != nil {
+		return err
 	}
-	endpoint := fmt.Sprintf("%s%s@kline_%s", this.combinedBaseUrl, strings.ToLower(symbol), res)
 	handle := func(msg []byte) error {
+		receiveTime := time.Now()
 		dataMap := make(map[string]interface{})
 		err := json.Unmarshal(msg, &dataMap)
 		if err != nil {
@@ -159,52 +397,168 @@ func (this *binanceExchange) SubKline(symbol string, period int) error {
 		switch msgType {
 		case "kline":
 			k := data["k"].(map[string]interface{})
-			kline := this.parseKline(k)
+			kline, err := this.parseKline(k)
+			if err != nil {
+				return err
+			}
 			kline.Symbol = symbol
-			this.klineCallback(kline, period)
+			this.roundKline(kline)
+			eventTime, err := ToInt64(data["E"])
+			if err != nil {
+				return err
+			}
+			this.dispatch(NewKlineEvent(BINANCE, kline, period), eventTime, receiveTime)
+			if this.klineCallback != nil {
+				this.klineCallback(kline, period)
+			}
 		default:
 			return errors.New("未知数据类型")
 		}
 		return nil
 	}
-	this.subscribe(endpoint, handle)
-	return nil
+	return this.subscribe(klineStream(symbol, period), handle)
+}
+
+func (this *binanceExchange) SubTrade(symbol string) error {
+	if this.tradeCallback == nil && this.eventCallback == nil {
+		return errors.New("成交回调函数未初始化")
+	}
+	symbol, err := this.venueSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if err := this.checkSymbol(symbol); err != nil {
+		return err
+	}
+	handle := func(msg []byte) error {
+		receiveTime := time.Now()
+		dataMap := make(map[string]interface{})
+		err := json.Unmarshal(msg, &dataMap)
+		if err != nil {
+			return err
+		}
+
+		data := dataMap["data"].(map[string]interface{})
+		msgType, ok := data["e"].(string)
+		if !ok {
+			return errors.New("成交消息类型错误")
+		}
+		switch msgType {
+		case "trade":
+			trade, err := this.parseTrade(data)
+			if err != nil {
+				return err
+			}
+			trade.Symbol = symbol
+			trade.Price = this.symbols.RoundPrice(symbol, trade.Price)
+			eventTime, err := ToInt64(data["E"])
+			if err != nil {
+				return err
+			}
+			this.dispatch(NewTradeEvent(BINANCE, trade), eventTime, receiveTime)
+			if this.tradeCallback != nil {
+				this.tradeCallback(trade)
+			}
+		default:
+			return errors.New("未知数据类型")
+		}
+		return nil
+	}
+	return this.subscribe(tradeStream(symbol), handle)
 }
 
-func (this *binanceExchange) parseDepthData(bids, asks [][]interface{}) *Depth {
+//补全事件信封中的统一交易标的、时间及序号后回调统一事件
+func (this *binanceExchange) dispatch(ev *MarketEvent, exchangeTime int64, receiveTime time.Time) {
+	if this.eventCallback == nil {
+		return
+	}
+	if instrument, err := this.SymbolMapper().FromVenue(ev.Symbol); err == nil {
+		ev.Instrument = instrument
+	}
+	ev.ExchangeTime = exchangeTime
+	ev.ReceiveTime = receiveTime.UnixNano() / int64(time.Millisecond)
+	ev.Sequence = this.sequencer.Next(ev.Topic())
+	this.eventCallback(ev)
+}
+
+func (this *binanceExchange) parseDepthData(bids, asks [][]interface{}) (*Depth, error) {
+	var err error
 	depth := new(Depth)
-	for _, v := range bids {
-		depth.BidList = append(depth.BidList, DepthRecord{ToFloat64(v[0]), ToFloat64(v[1])})
+	if depth.BidList, err = parseDepthRecords(bids); err != nil {
+		return nil, err
+	}
+	if depth.AskList, err = parseDepthRecords(asks); err != nil {
+		return nil, err
 	}
+	return depth, nil
+}
 
-	for _, v := range asks {
-		depth.AskList = append(depth.AskList, DepthRecord{ToFloat64(v[0]), ToFloat64(v[1])})
+func parseDepthRecords(list [][]interface{}) (DepthRecords, error) {
+	records := make(DepthRecords, 0, len(list))
+	parser := new(DecimalParser)
+	for _, v := range list {
+		if len(v) < 2 {
+			return nil, errors.New("深度数据格式错误")
+		}
+		records = append(records, DepthRecord{Price: parser.Parse(v[0]), Amount: parser.Parse(v[1])})
 	}
-	return depth
+	return records, parser.Err
 }
 
-func (this *binanceExchange) parseTicker(tickerMap map[string]interface{}) *Ticker {
+func (this *binanceExchange) parseTicker(tickerMap map[string]interface{}) (*Ticker, error) {
+	parser := new(DecimalParser)
 	ticker := new(Ticker)
-	ticker.Date = ToUint64(tickerMap["E"])
-	ticker.Last = ToFloat64(tickerMap["c"])
-	ticker.Vol = ToFloat64(tickerMap["v"])
-	ticker.Low = ToFloat64(tickerMap["l"])
-	ticker.High = ToFloat64(tickerMap["h"])
-	ticker.Buy = ToFloat64(tickerMap["b"])
-	ticker.Sell = ToFloat64(tickerMap["a"])
-	return ticker
+	ticker.Date = parser.Uint64(tickerMap["E"])
+	ticker.Last = parser.Parse(tickerMap["c"])
+	ticker.Vol = parser.Parse(tickerMap["v"])
+	ticker.Low = parser.Parse(tickerMap["l"])
+	ticker.High = parser.Parse(tickerMap["h"])
+	ticker.Buy = parser.Parse(tickerMap["b"])
+	ticker.Sell = parser.Parse(tickerMap["a"])
+	return ticker, parser.Err
 }
 
-func (this *binanceExchange) parseKline(k map[string]interface{}) *Kline {
+func (this *binanceExchange) parseKline(k map[string]interface{}) (*Kline, error) {
+	parser := new(DecimalParser)
 	kline := &Kline{
-		Timestamp: int64(ToInt(k["t"])),
-		Open:      ToFloat64(k["o"]),
-		Close:     ToFloat64(k["c"]),
-		High:      ToFloat64(k["h"]),
-		Low:       ToFloat64(k["l"]),
-		Vol:       ToFloat64(k["v"]),
-	}
-	return kline
+		Timestamp: parser.Int64(k["t"]),
+		Open:      parser.Parse(k["o"]),
+		Close:     parser.Parse(k["c"]),
+		High:      parser.Parse(k["h"]),
+		Low:       parser.Parse(k["l"]),
+		Vol:       parser.Parse(k["v"]),
+	}
+	return kline, parser.Err
+}
+
+func (this *binanceExchange) parseTrade(t map[string]interface{}) (*Trade, error) {
+	parser := new(DecimalParser)
+	isBuyerMaker, _ := t["m"].(bool)
+	trade := &Trade{
+		Tid:       parser.Int64(t["t"]),
+		Price:     parser.Parse(t["p"]),
+		Amount:    parser.Parse(t["q"]),
+		Side:      binanceTradeSide(isBuyerMaker),
+		Timestamp: parser.Int64(t["T"]),
+	}
+	return trade, parser.Err
+}
+
+//买方为挂单方时主动方为卖方
+func binanceTradeSide(isBuyerMaker bool) string {
+	if isBuyerMaker {
+		return TRADE_SIDE_SELL
+	}
+	return TRADE_SIDE_BUY
+}
+
+//统一行情事件回调，与各类型回调可同时设置
+func (this *binanceExchange) SetEventCallback(eventCallback func(*MarketEvent)) {
+	this.eventCallback = eventCallback
+}
+
+func (this *binanceExchange) SetTradeCallback(tradeCallback func(*Trade)) {
+	this.tradeCallback = tradeCallback
 }
 
 func (this *binanceExchange) SetCallbacks(depthCallback func(*Depth), tickerCallback func(*Ticker), klineCallback func(*Kline, int)) {
@@ -0,0 +1,365 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	. "wisp/common"
+	. "wisp/utils"
+)
+
+const (
+	binanceWeightLimit = 1200 //每分钟请求权重上限
+	binanceMaxRetries  = 3    //触发429限频后的最大重试次数
+)
+
+type binanceRestClient struct {
+	httpClient  *http.Client
+	baseUrl     string
+	apiKey      string
+	weightL     sync.Mutex
+	usedWeight  int       //当前分钟已使用权重，取自X-MBX-USED-WEIGHT响应头
+	weightTime  time.Time //权重统计所属分钟
+	bannedUntil time.Time //418封禁解除时间
+}
+
+func NewBinanceRestClient(config *APIConfig) *binanceRestClient {
+	client := &binanceRestClient{
+		httpClient: config.HttpClient,
+		baseUrl:    "https://api.binance.com",
+		apiKey:     config.ApiKey,
+	}
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{Timeout: 10 * time.Second}
+		if proxy, err := url.Parse(config.ProxyUrl); err == nil && config.ProxyUrl != "" {
+			client.httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+		}
+	}
+	if config.Endpoint != "" {
+		client.baseUrl = strings.TrimRight(config.Endpoint, "/")
+	}
+	return client
+}
+
+//设置接口地址，可用于指向测试网或测试桩
+func (this *binanceRestClient) SetBaseUrl(baseUrl string) *binanceRestClient {
+	this.baseUrl = strings.TrimRight(baseUrl, "/")
+	return this
+}
+
+//当前分钟已使用的请求权重
+func (this *binanceRestClient) UsedWeight() int {
+	this.weightL.Lock()
+	defer this.weightL.Unlock()
+	if time.Now().Truncate(time.Minute).After(this.weightTime) {
+		return 0
+	}
+	return this.usedWeight
+}
+
+func (this *binanceRestClient) GetServerTime() (time.Time, error) {
+	resp, err := this.doRequest(http.MethodGet, "/api/v3/time", nil, 1, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	res := struct {
+		ServerTime int64 `json:"serverTime"`
+	}{}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, res.ServerTime*int64(time.Millisecond)), nil
+}
+
+func (this *binanceRestClient) GetExchangeInfo() (*ExchangeInfo, error) {
+	resp, err := this.doRequest(http.MethodGet, "/api/v3/exchangeInfo", nil, 10, false)
+	if err != nil {
+		return nil, err
+	}
+	raw := struct {
+		ServerTime int64 `json:"serverTime"`
+		Symbols    []struct {
+			Symbol              string                   `json:"symbol"`
+			Status              string                   `json:"status"`
+			BaseAsset           string                   `json:"baseAsset"`
+			BaseAssetPrecision  int                      `json:"baseAssetPrecision"`
+			QuoteAsset          string                   `json:"quoteAsset"`
+			QuoteAssetPrecision int                      `json:"quoteAssetPrecision"`
+			Filters             []map[string]interface{} `json:"filters"`
+		} `json:"symbols"`
+	}{}
+	if err := json.Unmarshal(resp, &raw); err != nil {
+		return nil, err
+	}
+
+	info := &ExchangeInfo{ServerTime: raw.ServerTime}
+	for _, s := range raw.Symbols {
+		symbol := SymbolInfo{
+			Symbol:         s.Symbol,
+			Status:         s.Status,
+			BaseAsset:      s.BaseAsset,
+			BasePrecision:  s.BaseAssetPrecision,
+			QuoteAsset:     s.QuoteAsset,
+			QuotePrecision: s.QuoteAssetPrecision,
+		}
+		if err := this.parseSymbolFilters(&symbol, s.Filters); err != nil {
+			return nil, fmt.Errorf("交易对 %s 过滤器解析错误: %v", s.Symbol, err)
+		}
+		info.Symbols = append(info.Symbols, symbol)
+	}
+	return info, nil
+}
+
+func (this *binanceRestClient) parseSymbolFilters(symbol *SymbolInfo, filters []map[string]interface{}) error {
+	parser := new(DecimalParser)
+	for _, f := range filters {
+		switch f["filterType"] {
+		case "PRICE_FILTER":
+			symbol.TickSize = parser.Parse(f["tickSize"])
+		case "LOT_SIZE":
+			symbol.StepSize = parser.Parse(f["stepSize"])
+			symbol.MinQty = parser.Parse(f["minQty"])
+		case "MIN_NOTIONAL", "NOTIONAL":
+			symbol.MinNotional = parser.Parse(f["minNotional"])
+		}
+	}
+	return parser.Err
+}
+
+//深度快照，size可选: 5/10/20/50/100/500/1000/5000
+func (this *binanceRestClient) GetDepth(symbol string, size int) (*Depth, error) {
+	params := url.Values{}
+	params.Set("symbol", strings.ToUpper(symbol))
+	params.Set("limit", strconv.Itoa(size))
+
+	resp, err := this.doRequest(http.MethodGet, "/api/v3/depth", params, this.depthWeight(size), false)
+	if err != nil {
+		return nil, err
+	}
+	raw := struct {
+		LastUpdateID int64           `json:"lastUpdateId"`
+		Bids         [][]interface{} `json:"bids"`
+		Asks         [][]interface{} `json:"asks"`
+	}{}
+	if err := json.Unmarshal(resp, &raw); err != nil {
+		return nil, err
+	}
+
+	depth := new(Depth)
+	depth.Symbol = symbol
+	depth.LastUpdateId = raw.LastUpdateID
+	depth.UTime = time.Now()
+	if depth.BidList, err = parseDepthRecords(raw.Bids); err != nil {
+		return nil, err
+	}
+	if depth.AskList, err = parseDepthRecords(raw.Asks); err != nil {
+		return nil, err
+	}
+	return depth, nil
+}
+
+//历史k线，since为开始时间(毫秒)，为0时返回最近的size根
+func (this *binanceRestClient) GetKlines(symbol string, period, size int, since int64) ([]Kline, error) {
+	interval, ok := KLINE_PERIOD[period]
+	if !ok {
+		return nil, fmt.Errorf("不支持的k线周期: %d", period)
+	}
+	params := url.Values{}
+	params.Set("symbol", strings.ToUpper(symbol))
+	params.Set("interval", interval)
+	params.Set("limit", strconv.Itoa(size))
+	if since > 0 {
+		params.Set("startTime", strconv.FormatInt(since, 10))
+	}
+
+	resp, err := this.doRequest(http.MethodGet, "/api/v3/klines", params, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	var raw [][]interface{}
+	if err := json.Unmarshal(resp, &raw); err != nil {
+		return nil, err
+	}
+
+	parser := new(DecimalParser)
+	klines := make([]Kline, 0, len(raw))
+	for _, k := range raw {
+		if len(k) < 6 {
+			return nil, errors.New("k线数据格式错误")
+		}
+		klines = append(klines, Kline{
+			Symbol:    symbol,
+			Timestamp: parser.Int64(k[0]),
+			Open:      parser.Parse(k[1]),
+			High:      parser.Parse(k[2]),
+			Low:       parser.Parse(k[3]),
+			Close:     parser.Parse(k[4]),
+			Vol:       parser.Parse(k[5]),
+		})
+	}
+	if parser.Err != nil {
+		return nil, parser.Err
+	}
+	return klines, nil
+}
+
+//最近成交
+func (this *binanceRestClient) GetTrades(symbol string, size int) ([]Trade, error) {
+	params := url.Values{}
+	params.Set("symbol", strings.ToUpper(symbol))
+	params.Set("limit", strconv.Itoa(size))
+
+	resp, err := this.doRequest(http.MethodGet, "/api/v3/trades", params, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Id           int64   `json:"id"`
+		Price        Decimal `json:"price"`
+		Qty          Decimal `json:"qty"`
+		Time         int64   `json:"time"`
+		IsBuyerMaker bool    `json:"isBuyerMaker"`
+	}
+	if err := json.Unmarshal(resp, &raw); err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(raw))
+	for _, t := range raw {
+		trades = append(trades, Trade{
+			Symbol:    symbol,
+			Tid:       t.Id,
+			Price:     t.Price,
+			Amount:    t.Qty,
+			Side:      binanceTradeSide(t.IsBuyerMaker),
+			Timestamp: t.Time,
+		})
+	}
+	return trades, nil
+}
+
+func (this *binanceRestClient) depthWeight(size int) int {
+	switch {
+	case size <= 100:
+		return 1
+	case size <= 500:
+		return 5
+	case size <= 1000:
+		return 10
+	default:
+		return 50
+	}
+}
+
+//发送请求，处理权重统计及429/418限频退避
+func (this *binanceRestClient) doRequest(method, path string, params url.Values, weight int, withApiKey bool) ([]byte, error) {
+	reqUrl := this.baseUrl + path
+	if len(params) > 0 {
+		reqUrl += "?" + params.Encode()
+	}
+
+	for retry := 0; ; retry++ {
+		if err := this.waitWeight(weight); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(method, reqUrl, nil)
+		if err != nil {
+			return nil, err
+		}
+		if withApiKey {
+			req.Header.Set("X-MBX-APIKEY", this.apiKey)
+		}
+
+		res, err := this.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		this.updateWeight(res.Header)
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			return body, nil
+		case http.StatusTeapot:
+			//IP已被封禁，在解禁前不再发送请求
+			bannedUntil := time.Now().Add(this.retryAfter(res.Header, time.Minute))
+			this.weightL.Lock()
+			this.bannedUntil = bannedUntil
+			this.weightL.Unlock()
+			return nil, fmt.Errorf("HttpStatusCode: %d, IP已被封禁至 %v, Desc: %s", res.StatusCode, bannedUntil, string(body))
+		case http.StatusTooManyRequests:
+			if retry >= binanceMaxRetries {
+				return nil, fmt.Errorf("HttpStatusCode: %d, Desc: %s", res.StatusCode, string(body))
+			}
+			wait := this.retryAfter(res.Header, time.Duration(1<<uint(retry))*time.Second)
+			binanceLog.Warn("币安接口触发限频，%v 后重试: %s\n", wait, path)
+			time.Sleep(wait)
+		default:
+			return nil, fmt.Errorf("HttpStatusCode: %d, Desc: %s", res.StatusCode, string(body))
+		}
+	}
+}
+
+//当前分钟权重不足时等待至下一分钟
+func (this *binanceRestClient) waitWeight(weight int) error {
+	this.weightL.Lock()
+	bannedUntil := this.bannedUntil
+	this.weightL.Unlock()
+	if time.Now().Before(bannedUntil) {
+		return fmt.Errorf("IP已被封禁至 %v", bannedUntil)
+	}
+
+	if this.UsedWeight()+weight > binanceWeightLimit {
+		wait := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))
+		binanceLog.Warn("币安接口权重已用尽，等待 %v\n", wait)
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+func (this *binanceRestClient) updateWeight(header http.Header) {
+	value := header.Get("X-MBX-USED-WEIGHT-1M")
+	if value == "" {
+		value = header.Get("X-MBX-USED-WEIGHT")
+	}
+	if value == "" {
+		return
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+
+	this.weightL.Lock()
+	defer this.weightL.Unlock()
+	this.usedWeight = weight
+	this.weightTime = time.Now().Truncate(time.Minute)
+}
+
+func (this *binanceRestClient) retryAfter(header http.Header, def time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+//用户数据流listenKey管理接口，listenKey为空时创建新的listenKey
+func (this *binanceRestClient) userDataStream(method, listenKey string) ([]byte, error) {
+	params := url.Values{}
+	if listenKey != "" {
+		params.Set("listenKey", listenKey)
+	}
+	return this.doRequest(method, "/api/v3/userDataStream", params, 1, true)
+}
@@ -0,0 +1,234 @@
+package exchange
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	. "wisp/common"
+)
+
+//测试桩依次返回statuses中的状态码，之后均返回200
+func newRestStub(header http.Header, statuses ...int) (*httptest.Server, *binanceRestClient, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			w.Write([]byte(`{"code":-1003,"msg":"limited"}`))
+			return
+		}
+		w.Write([]byte(`{"serverTime":1500000000000}`))
+	}))
+	return srv, NewBinanceRestClient(&APIConfig{}).SetBaseUrl(srv.URL), &calls
+}
+
+func TestBinanceRestUsedWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"1m", http.Header{"X-Mbx-Used-Weight-1m": {"37"}}, 37},
+		{"legacy", http.Header{"X-Mbx-Used-Weight": {"12"}}, 12},
+		{"prefer 1m", http.Header{"X-Mbx-Used-Weight-1m": {"40"}, "X-Mbx-Used-Weight": {"12"}}, 40},
+		{"missing", http.Header{}, 0},
+		{"invalid", http.Header{"X-Mbx-Used-Weight-1m": {"abc"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client, _ := newRestStub(tt.header)
+			defer srv.Close()
+			if _, err := client.GetServerTime(); err != nil {
+				t.Fatal(err)
+			}
+			if got := client.UsedWeight(); got != tt.want {
+				t.Errorf("UsedWeight() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinanceRestTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"no retry", 0, false, 1},
+		{"retry once", 1, false, 2},
+		{"retries exhausted", binanceMaxRetries + 1, true, binanceMaxRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := make([]int, tt.failures)
+			for i := range statuses {
+				statuses[i] = http.StatusTooManyRequests
+			}
+			srv, client, calls := newRestStub(http.Header{"Retry-After": {"1"}}, statuses...)
+			defer srv.Close()
+
+			start := time.Now()
+			_, err := client.GetServerTime()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			//每次重试前按Retry-After等待
+			if min := time.Duration(tt.wantCalls-1) * time.Second; time.Since(start) < min {
+				t.Errorf("returned after %v, want at least %v", time.Since(start), min)
+			}
+		})
+	}
+}
+
+func TestBinanceRestBanned(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantBan    time.Duration
+	}{
+		{"retry after", "120", 120 * time.Second},
+		{"default", "", time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client, calls := newRestStub(http.Header{"Retry-After": {tt.retryAfter}}, http.StatusTeapot)
+			defer srv.Close()
+
+			_, err := client.GetServerTime()
+			if err == nil || !strings.Contains(err.Error(), "418") {
+				t.Fatalf("err = %v, want 418 error", err)
+			}
+			client.weightL.Lock()
+			ban := time.Until(client.bannedUntil)
+			client.weightL.Unlock()
+			if ban <= tt.wantBan-5*time.Second || ban > tt.wantBan {
+				t.Errorf("banned for %v, want %v", ban, tt.wantBan)
+			}
+
+			//解禁前不再请求接口
+			if _, err := client.GetServerTime(); err == nil {
+				t.Error("request during ban succeeded")
+			}
+			if got := atomic.LoadInt32(calls); got != 1 {
+				t.Errorf("calls = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestBinanceRestMarketData(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		call      func(client *binanceRestClient) (interface{}, error)
+		wantQuery string
+		want      interface{} //为nil时期望返回错误
+	}{
+		{"depth", "/api/v3/depth", `{"lastUpdateId":1027024,"bids":[["4.00000000","431.00000000"]],"asks":[["4.00000200","12.00000000"],["4.1","1"]]}`,
+			func(client *binanceRestClient) (interface{}, error) {
+				depth, err := client.GetDepth("btcusdt", 5)
+				if depth != nil {
+					depth.UTime = time.Time{}
+				}
+				return depth, err
+			},
+			"limit=5&symbol=BTCUSDT",
+			&Depth{
+				Symbol:       "btcusdt",
+				LastUpdateId: 1027024,
+				BidList:      DepthRecords{{Price: MustDecimal("4.00000000"), Amount: MustDecimal("431.00000000")}},
+				AskList:      DepthRecords{{Price: MustDecimal("4.00000200"), Amount: MustDecimal("12.00000000")}, {Price: MustDecimal("4.1"), Amount: MustDecimal("1")}},
+			}},
+		{"depth malformed", "/api/v3/depth", `{"lastUpdateId":1,"bids":[["4.0"]],"asks":[]}`,
+			func(client *binanceRestClient) (interface{}, error) { return client.GetDepth("btcusdt", 5) },
+			"limit=5&symbol=BTCUSDT", nil},
+		{"klines", "/api/v3/klines", `[[1499040000000,"0.01634790","0.80000000","0.01575800","0.01577100","148976.11427815",1499644799999,"2434.19055334",308,"1756.87402397","28.46694368","0"]]`,
+			func(client *binanceRestClient) (interface{}, error) {
+				return client.GetKlines("btcusdt", KLINE_PERIOD_1H, 1, 1499040000000)
+			},
+			"interval=1h&limit=1&startTime=1499040000000&symbol=BTCUSDT",
+			[]Kline{{
+				Symbol:    "btcusdt",
+				Timestamp: 1499040000000,
+				Open:      MustDecimal("0.01634790"),
+				High:      MustDecimal("0.80000000"),
+				Low:       MustDecimal("0.01575800"),
+				Close:     MustDecimal("0.01577100"),
+				Vol:       MustDecimal("148976.11427815"),
+			}}},
+		{"klines short row", "/api/v3/klines", `[[1499040000000,"0.1","0.2"]]`,
+			func(client *binanceRestClient) (interface{}, error) {
+				return client.GetKlines("btcusdt", KLINE_PERIOD_1MIN, 1, 0)
+			},
+			"interval=1m&limit=1&symbol=BTCUSDT", nil},
+		{"trades", "/api/v3/trades", `[{"id":28457,"price":"4.00000100","qty":"12.00000000","quoteQty":"48.000012","time":1499865549590,"isBuyerMaker":true,"isBestMatch":true},
+			{"id":28458,"price":"4.1","qty":"1","time":1499865549591,"isBuyerMaker":false}]`,
+			func(client *binanceRestClient) (interface{}, error) { return client.GetTrades("btcusdt", 2) },
+			"limit=2&symbol=BTCUSDT",
+			[]Trade{
+				{Symbol: "btcusdt", Tid: 28457, Price: MustDecimal("4.00000100"), Amount: MustDecimal("12.00000000"), Side: TRADE_SIDE_SELL, Timestamp: 1499865549590},
+				{Symbol: "btcusdt", Tid: 28458, Price: MustDecimal("4.1"), Amount: MustDecimal("1"), Side: TRADE_SIDE_BUY, Timestamp: 1499865549591},
+			}},
+		{"exchange info", "/api/v3/exchangeInfo", `{"serverTime":1565246363776,"symbols":[{"symbol":"ETHBTC","status":"TRADING","baseAsset":"ETH","baseAssetPrecision":8,
+			"quoteAsset":"BTC","quoteAssetPrecision":8,"filters":[{"filterType":"PRICE_FILTER","minPrice":"0.00000100","maxPrice":"100000.00000000","tickSize":"0.00000100"},
+			{"filterType":"LOT_SIZE","minQty":"0.00100000","maxQty":"100000.00000000","stepSize":"0.00100000"},{"filterType":"NOTIONAL","minNotional":"0.00010000"},
+			{"filterType":"MAX_NUM_ORDERS","maxNumOrders":200}]}]}`,
+			func(client *binanceRestClient) (interface{}, error) { return client.GetExchangeInfo() },
+			"",
+			&ExchangeInfo{ServerTime: 1565246363776, Symbols: []SymbolInfo{{
+				Symbol:         "ETHBTC",
+				Status:         "TRADING",
+				BaseAsset:      "ETH",
+				BasePrecision:  8,
+				QuoteAsset:     "BTC",
+				QuotePrecision: 8,
+				TickSize:       MustDecimal("0.00000100"),
+				StepSize:       MustDecimal("0.00100000"),
+				MinQty:         MustDecimal("0.00100000"),
+				MinNotional:    MustDecimal("0.00010000"),
+			}}}},
+		{"exchange info bad filter", "/api/v3/exchangeInfo", `{"symbols":[{"symbol":"ETHBTC","filters":[{"filterType":"PRICE_FILTER","tickSize":"0.0.1"}]}]}`,
+			func(client *binanceRestClient) (interface{}, error) { return client.GetExchangeInfo() },
+			"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path, query string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path, query = r.URL.Path, r.URL.RawQuery
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			client := NewBinanceRestClient(&APIConfig{}).SetBaseUrl(srv.URL)
+
+			got, err := tt.call(client)
+			if path != tt.path || query != tt.wantQuery {
+				t.Errorf("requested %s?%s, want %s?%s", path, query, tt.path, tt.wantQuery)
+			}
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("got %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
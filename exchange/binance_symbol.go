@@ -0,0 +1,164 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	. "wisp/common"
+)
+
+//交易对元数据
+func (this *binanceExchange) Symbols() *SymbolRegistry {
+	return this.symbols
+}
+
+//首次加载失败后的重试间隔，每次翻倍，不超过最大值及刷新间隔
+const (
+	binanceSymbolRetryMin = 5 * time.Second
+	binanceSymbolRetryMax = 5 * time.Minute
+)
+
+//从exchangeInfo加载交易对元数据，并按interval定期刷新以感知上线、下线
+//首次加载失败时返回错误，同时在后台重试直至加载成功，之后按interval刷新
+func (this *binanceExchange) StartSymbolRefresh(interval time.Duration) error {
+	err := this.refreshSymbols()
+	if err == nil && interval <= 0 {
+		return nil
+	}
+	go this.symbolRefreshLoop(interval, err == nil)
+	return err
+}
+
+func (this *binanceExchange) symbolRefreshLoop(interval time.Duration, loaded bool) {
+	retry := binanceSymbolRetryMin
+	for {
+		wait := interval
+		if !loaded {
+			wait = retry
+			if interval > 0 && wait > interval {
+				wait = interval
+			}
+			if retry *= 2; retry > binanceSymbolRetryMax {
+				retry = binanceSymbolRetryMax
+			}
+		}
+		time.Sleep(wait)
+
+		if err := this.refreshSymbols(); err != nil {
+			binanceLog.Error("币安交易对信息刷新失败: %v\n", err.Error())
+			continue
+		}
+		loaded = true
+		if interval <= 0 {
+			return
+		}
+	}
+}
+
+func (this *binanceExchange) refreshSymbols() error {
+	info, err := this.rest.GetExchangeInfo()
+	if err != nil {
+		return err
+	}
+	first := this.symbols.Len() == 0
+	added, removed := this.symbols.Update(info.Symbols)
+	if first {
+		binanceLog.Info("币安交易对信息加载完成，共 %d 个交易对\n", this.symbols.Len())
+		return nil
+	}
+	if len(added) > 0 {
+		binanceLog.Info("币安新上线交易对: %v\n", added)
+	}
+	if len(removed) > 0 {
+		binanceLog.Info("币安已下线交易对: %v\n", removed)
+	}
+	return nil
+}
+
+//交易对元数据加载后，拒绝订阅未知或非交易状态的交易对
+func (this *binanceExchange) checkSymbol(symbol string) error {
+	if this.symbols.Len() == 0 {
+		return nil
+	}
+	s, ok := this.symbols.Get(symbol)
+	if !ok {
+		return fmt.Errorf("未知交易对: %s", symbol)
+	}
+	if s.Status != SYMBOL_STATUS_TRADING {
+		return fmt.Errorf("交易对 %s 当前状态为 %s", symbol, s.Status)
+	}
+	return nil
+}
+
+func (this *binanceExchange) roundDepth(depth *Depth) {
+	for _, list := range []DepthRecords{depth.BidList, depth.AskList} {
+		for i := range list {
+			list[i].Price = this.symbols.RoundPrice(depth.Symbol, list[i].Price)
+			list[i].Amount = this.symbols.RoundAmount(depth.Symbol, list[i].Amount)
+		}
+	}
+}
+
+func (this *binanceExchange) roundTicker(ticker *Ticker) {
+	ticker.Last = this.symbols.RoundPrice(ticker.Symbol, ticker.Last)
+	ticker.Buy = this.symbols.RoundPrice(ticker.Symbol, ticker.Buy)
+	ticker.Sell = this.symbols.RoundPrice(ticker.Symbol, ticker.Sell)
+	ticker.High = this.symbols.RoundPrice(ticker.Symbol, ticker.High)
+	ticker.Low = this.symbols.RoundPrice(ticker.Symbol, ticker.Low)
+}
+
+func (this *binanceExchange) roundKline(kline *Kline) {
+	kline.Open = this.symbols.RoundPrice(kline.Symbol, kline.Open)
+	kline.Close = this.symbols.RoundPrice(kline.Symbol, kline.Close)
+	kline.High = this.symbols.RoundPrice(kline.Symbol, kline.High)
+	kline.Low = this.symbols.RoundPrice(kline.Symbol, kline.Low)
+}
+
+//常见计价资产，交易对元数据未加载时用于拆分交易所符号
+var binanceQuoteAssets = []string{"USDT", "BUSD", "USDC", "TUSD", "PAX", "BTC", "ETH", "BNB", "TRX", "XRP", "EUR", "GBP", "TRY", "RUB"}
+
+//币安交易对为小写的 base+quote，如 btcusdt
+type binanceSymbolMapper struct {
+	symbols *SymbolRegistry
+}
+
+func (this *binanceSymbolMapper) ToVenue(instrument Instrument) (string, error) {
+	if instrument.Type != "" && instrument.Type != INSTRUMENT_SPOT {
+		return "", fmt.Errorf("币安现货不支持的交易标的类型: %s", instrument.Type)
+	}
+	return strings.ToLower(instrument.Base + instrument.Quote), nil
+}
+
+func (this *binanceSymbolMapper) FromVenue(symbol string) (Instrument, error) {
+	if s, ok := this.symbols.Get(symbol); ok && s.BaseAsset != "" {
+		return NewInstrument(BINANCE, s.BaseAsset, s.QuoteAsset), nil
+	}
+
+	upper := strings.ToUpper(symbol)
+	for _, quote := range binanceQuoteAssets {
+		if strings.HasSuffix(upper, quote) && len(upper) > len(quote) {
+			return NewInstrument(BINANCE, strings.TrimSuffix(upper, quote), quote), nil
+		}
+	}
+	return Instrument{}, fmt.Errorf("无法识别的币安交易对: %s", symbol)
+}
+
+//交易所符号与统一交易标的映射
+func (this *binanceExchange) SymbolMapper() SymbolMapper {
+	return &binanceSymbolMapper{symbols: this.symbols}
+}
+
+//订阅参数支持交易所符号(btcusdt)及标准写法(BTC/USDT)，统一转换为交易所符号
+func (this *binanceExchange) venueSymbol(symbol string) (string, error) {
+	if !IsInstrument(symbol) {
+		return strings.ToLower(symbol), nil
+	}
+	instrument, err := ParseInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	if instrument.Venue != "" && instrument.Venue != BINANCE {
+		return "", fmt.Errorf("交易标的 %s 不属于币安", symbol)
+	}
+	return this.SymbolMapper().ToVenue(instrument)
+}
@@ -0,0 +1,95 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+	. "wisp/common"
+)
+
+func TestBinanceSymbolMapper(t *testing.T) {
+	binance := NewBinanceExchange()
+	binance.Symbols().Update([]SymbolInfo{{Symbol: "BTCUSDT", BaseAsset: "BTC", QuoteAsset: "USDT"}, {Symbol: "ETHBTC", BaseAsset: "ETH", QuoteAsset: "BTC"}})
+	mapper := binance.SymbolMapper()
+
+	tests := []struct {
+		symbol  string
+		want    Instrument
+		wantErr bool
+	}{
+		{"btcusdt", NewInstrument(BINANCE, "BTC", "USDT"), false},
+		{"ETHBTC", NewInstrument(BINANCE, "ETH", "BTC"), false},
+		//注册表中没有的交易对按报价资产后缀拆分
+		{"dogeusdt", NewInstrument(BINANCE, "DOGE", "USDT"), false},
+		{"bnbbusd", NewInstrument(BINANCE, "BNB", "BUSD"), false},
+		{"xrpeur", NewInstrument(BINANCE, "XRP", "EUR"), false},
+		{"usdt", Instrument{}, true},
+		{"abcxyz", Instrument{}, true},
+	}
+	for _, tt := range tests {
+		got, err := mapper.FromVenue(tt.symbol)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FromVenue(%q) err = %v, wantErr %v", tt.symbol, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FromVenue(%q) = %+v, want %+v", tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestBinanceVenueSymbol(t *testing.T) {
+	binance := NewBinanceExchange()
+	tests := []struct {
+		symbol  string
+		want    string
+		wantErr bool
+	}{
+		{"btcusdt", "btcusdt", false},
+		{"BTCUSDT", "btcusdt", false},
+		{"BTC/USDT", "btcusdt", false},
+		{"binance:eth/btc", "ethbtc", false},
+		{"okex:BTC/USDT", "", true},
+		{"BTC/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := binance.venueSymbol(tt.symbol)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("venueSymbol(%q) = %q, %v, want %q", tt.symbol, got, err, tt.want)
+		}
+	}
+}
+
+func TestBinanceDispatch(t *testing.T) {
+	binance := NewBinanceExchange()
+	var events []*MarketEvent
+	binance.SetEventCallback(func(ev *MarketEvent) {
+		events = append(events, ev)
+	})
+	receiveTime := time.Unix(1500000000, 123*int64(time.Millisecond))
+
+	binance.dispatch(NewTickerEvent(BINANCE, &Ticker{Symbol: "btcusdt"}), 1499999999999, receiveTime)
+	binance.dispatch(NewTickerEvent(BINANCE, &Ticker{Symbol: "btcusdt"}), 1500000000001, receiveTime)
+	//部分深度推送不含事件时间，ExchangeTime为0，序号按主题单独计数
+	binance.dispatch(NewDepthEvent(BINANCE, &Depth{Symbol: "btcusdt"}), 0, receiveTime)
+
+	want := []struct {
+		exchangeTime int64
+		sequence     uint64
+	}{
+		{1499999999999, 1},
+		{1500000000001, 2},
+		{0, 1},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("dispatched %d events, want %d", len(events), len(want))
+	}
+	for i, ev := range events {
+		if ev.ExchangeTime != want[i].exchangeTime || ev.Sequence != want[i].sequence || ev.ReceiveTime != 1500000000123 {
+			t.Errorf("event %d: exchange time %d, sequence %d, receive time %d, want %d, %d, 1500000000123",
+				i, ev.ExchangeTime, ev.Sequence, ev.ReceiveTime, want[i].exchangeTime, want[i].sequence)
+		}
+		if ev.Instrument != (Instrument{Base: "BTC", Quote: "USDT", Venue: BINANCE, Type: INSTRUMENT_SPOT}) {
+			t.Errorf("event %d: instrument = %+v", i, ev.Instrument)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package exchange
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	. "wisp/common"
+)
+
+//行情数据流测试桩，每个建立的连接发送到conns
+func newStreamStub() (*httptest.Server, chan *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conns <- conn
+		}
+	}))
+	return server, conns
+}
+
+func waitStreamConn(t *testing.T, conns chan *websocket.Conn) *websocket.Conn {
+	select {
+	case conn := <-conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not connected")
+		return nil
+	}
+}
+
+func TestBinanceReconnectConnection(t *testing.T) {
+	server, conns := newStreamStub()
+	defer server.Close()
+	binance := NewBinanceExchangeWithConfig(&APIConfig{})
+	binance.SetEventCallback(func(*MarketEvent) {})
+	binance.combinedBaseUrl = "ws" + strings.TrimPrefix(server.URL, "http") + "/stream?streams="
+	defer binance.Close()
+
+	if err := binance.SubTicker("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+	id := binance.Connections()[0].Id
+
+	//服务端断开后由异常回调重连同一连接
+	waitStreamConn(t, conns).Close()
+	waitStreamConn(t, conns).Close()
+	if state := binance.Connections()[0]; state.Id != id || state.Reconnects == 0 {
+		t.Errorf("after server close: %+v, want conn %d reconnected", state, id)
+	}
+
+	//强制重连，服务端不可用时返回错误
+	if err := binance.ReconnectConnection(id); err != nil {
+		t.Errorf("ReconnectConnection(%d) = %v", id, err)
+	}
+	waitStreamConn(t, conns)
+	if state := binance.Connections()[0]; state.Reconnects != 2 {
+		t.Errorf("reconnects = %d, want 2", state.Reconnects)
+	}
+	if err := binance.ReconnectConnection(id + 1); err == nil {
+		t.Errorf("ReconnectConnection(%d) of an unknown connection succeeded", id+1)
+	}
+	server.Close()
+	if err := binance.ReconnectConnection(id); err == nil || !strings.Contains(err.Error(), "重连失败") {
+		t.Errorf("ReconnectConnection(%d) with the server down = %v, want a reconnect error", id, err)
+	}
+}
@@ -0,0 +1,298 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	. "wisp/common"
+	. "wisp/utils"
+	"wisp/ws"
+)
+
+//listenKey有效期为60分钟，每30分钟延长一次
+const binanceListenKeyKeepAlive = 30 * time.Minute
+
+//用户数据流，维护listenKey的生命周期及对应连接
+type binanceUserStream struct {
+	sync.Mutex
+	listenKey     string
+	conn          *ws.WebsocketConnection
+	stopKeepAlive chan struct{}
+	closed        bool //已取消订阅，不再重连或重建listenKey
+}
+
+func (this *binanceExchange) SetUserCallbacks(executionReportCallback func(*ExecutionReport), accountPositionCallback func(*AccountPosition), balanceUpdateCallback func(*BalanceUpdate)) {
+	this.executionReportCallback = executionReportCallback
+	this.accountPositionCallback = accountPositionCallback
+	this.balanceUpdateCallback = balanceUpdateCallback
+}
+
+//订阅用户数据流: 订单回报、账户余额及余额变动
+func (this *binanceExchange) SubUserData() error {
+	if this.apiConfig.ApiKey == "" {
+		return errors.New("用户数据流订阅错误，未配置ApiKey")
+	}
+	if this.executionReportCallback == nil || this.accountPositionCallback == nil || this.balanceUpdateCallback == nil {
+		return errors.New("用户数据回调方法未初始化")
+	}
+	//建立连接期间不持锁，以userStreamPending阻止并发订阅创建多个listenKey
+	this.userStreamL.Lock()
+	if this.userStream != nil || this.userStreamPending {
+		this.userStreamL.Unlock()
+		return errors.New("用户数据流已订阅")
+	}
+	this.userStreamPending = true
+	this.userStreamL.Unlock()
+
+	stream, err := this.openUserStream()
+	this.userStreamL.Lock()
+	this.userStreamPending = false
+	if err == nil {
+		this.userStream = stream
+	}
+	this.userStreamL.Unlock()
+	if err != nil {
+		return err
+	}
+	stream.conn.RecvMsg()
+	go this.keepAliveLoop(stream)
+	return nil
+}
+
+//创建listenKey并建立连接，连接失败时删除listenKey
+func (this *binanceExchange) openUserStream() (*binanceUserStream, error) {
+	listenKey, err := this.createListenKey()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := this.newStreamBuilder(this.userStreamUrl(listenKey), this.userDataHandle).
+		SetErrorHandle(this.userStreamErrorHandle).
+		Build()
+	if err != nil {
+		if _, e := this.rest.userDataStream(http.MethodDelete, listenKey); e != nil {
+			binanceLog.Warn("listenKey删除失败: %v\n", e.Error())
+		}
+		return nil, fmt.Errorf("用户数据流连接失败: %v", err)
+	}
+	return &binanceUserStream{listenKey: listenKey, conn: conn, stopKeepAlive: make(chan struct{})}, nil
+}
+
+//取消用户数据流订阅，关闭连接并删除listenKey
+func (this *binanceExchange) UnsubUserData() error {
+	stream := this.takeUserStream()
+	if stream == nil {
+		return errors.New("用户数据流未订阅")
+	}
+	return this.closeUserStream(stream)
+}
+
+func (this *binanceExchange) currentUserStream() *binanceUserStream {
+	this.userStreamL.Lock()
+	defer this.userStreamL.Unlock()
+	return this.userStream
+}
+
+//取出并清空当前用户数据流，并发取消时只有一方取得
+func (this *binanceExchange) takeUserStream() *binanceUserStream {
+	this.userStreamL.Lock()
+	defer this.userStreamL.Unlock()
+	stream := this.userStream
+	this.userStream = nil
+	return stream
+}
+
+//持锁后再关闭连接，等待进行中的重建完成，关闭后不再重连
+func (this *binanceExchange) closeUserStream(stream *binanceUserStream) error {
+	stream.Lock()
+	defer stream.Unlock()
+	stream.closed = true
+	close(stream.stopKeepAlive)
+	stream.conn.Shutdown()
+	_, err := this.rest.userDataStream(http.MethodDelete, stream.listenKey)
+	return err
+}
+
+func (this *binanceExchange) userStreamUrl(listenKey string) string {
+	return fmt.Sprintf("%s/%s", this.baseUrl, listenKey)
+}
+
+func (this *binanceExchange) keepAliveLoop(stream *binanceUserStream) {
+	ticker := time.NewTicker(binanceListenKeyKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stream.Lock()
+			err := this.keepAliveListenKey(stream.listenKey)
+			stream.Unlock()
+			if err != nil {
+				binanceLog.Info("listenKey延期失败，重新创建: %v\n", err.Error())
+				this.renewUserStream(stream, true)
+			}
+		case <-stream.stopKeepAlive:
+			binanceLog.Info("取消用户数据流订阅,退出listenKey延期协程\n")
+			return
+		}
+	}
+}
+
+//恢复用户数据流连接；listenKey失效时重新创建并切换连接地址
+func (this *binanceExchange) renewUserStream(stream *binanceUserStream, expired bool) {
+	stream.Lock()
+	defer stream.Unlock()
+	if stream.closed {
+		return
+	}
+
+	if !expired && this.keepAliveListenKey(stream.listenKey) == nil {
+		if err := stream.conn.Reconnect(); err != nil {
+			binanceLog.Error("用户数据流重连失败: %v\n", err.Error())
+		}
+		return
+	}
+
+	listenKey, err := this.createListenKey()
+	if err != nil {
+		binanceLog.Error("listenKey创建失败: %v\n", err.Error())
+		return
+	}
+	stream.listenKey = listenKey
+	if err := stream.conn.ReconnectTo(this.userStreamUrl(listenKey)); err != nil {
+		binanceLog.Error("用户数据流重连失败: %v\n", err.Error())
+	}
+}
+
+func (this *binanceExchange) userStreamErrorHandle(err error) {
+	binanceLog.Info("币安用户数据流异常信息: %v\n", err.Error())
+	if stream := this.currentUserStream(); stream != nil {
+		this.renewUserStream(stream, false)
+	}
+}
+
+func (this *binanceExchange) createListenKey() (string, error) {
+	resp, err := this.rest.userDataStream(http.MethodPost, "")
+	if err != nil {
+		return "", err
+	}
+	res := struct {
+		ListenKey string `json:"listenKey"`
+	}{}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return "", err
+	}
+	if res.ListenKey == "" {
+		return "", errors.New("listenKey创建失败")
+	}
+	return res.ListenKey, nil
+}
+
+func (this *binanceExchange) keepAliveListenKey(listenKey string) error {
+	_, err := this.rest.userDataStream(http.MethodPut, listenKey)
+	return err
+}
+
+//用户数据同时以事件信封回调，与行情经同一管道发布到行情输出，主题为 user.binance.<频道>
+func (this *binanceExchange) userDataHandle(msg []byte) error {
+	receiveTime := time.Now()
+	data := make(map[string]interface{})
+	err := json.Unmarshal(msg, &data)
+	if err != nil {
+		return err
+	}
+	msgType, ok := data["e"].(string)
+	if !ok {
+		return errors.New("用户数据类型错误")
+	}
+
+	switch msgType {
+	case "executionReport":
+		report, err := this.parseExecutionReport(data)
+		if err != nil {
+			return err
+		}
+		this.executionReportCallback(report)
+		this.dispatch(NewExecutionReportEvent(BINANCE, report), int64(report.EventTime), receiveTime)
+	case "outboundAccountPosition":
+		position, err := this.parseAccountPosition(data)
+		if err != nil {
+			return err
+		}
+		this.accountPositionCallback(position)
+		this.dispatch(NewAccountPositionEvent(BINANCE, position), int64(position.EventTime), receiveTime)
+	case "balanceUpdate":
+		update, err := this.parseBalanceUpdate(data)
+		if err != nil {
+			return err
+		}
+		this.balanceUpdateCallback(update)
+		this.dispatch(NewBalanceUpdateEvent(BINANCE, update), int64(update.EventTime), receiveTime)
+	case "listenKeyExpired":
+		binanceLog.Info("listenKey已过期，重新创建\n")
+		if stream := this.currentUserStream(); stream != nil {
+			this.renewUserStream(stream, true)
+		}
+	default:
+		return errors.New("未知用户数据类型")
+	}
+	return nil
+}
+
+func (this *binanceExchange) parseExecutionReport(data map[string]interface{}) (*ExecutionReport, error) {
+	parser := new(DecimalParser)
+	report := &ExecutionReport{
+		Symbol:            ToString(data["s"]),
+		ClientOrderId:     ToString(data["c"]),
+		Side:              ToString(data["S"]),
+		OrderType:         ToString(data["o"]),
+		TimeInForce:       ToString(data["f"]),
+		ExecutionType:     ToString(data["x"]),
+		Status:            ToString(data["X"]),
+		OrderId:           parser.Int64(data["i"]),
+		TradeId:           parser.Int64(data["t"]),
+		Price:             parser.Parse(data["p"]),
+		Quantity:          parser.Parse(data["q"]),
+		LastExecutedQty:   parser.Parse(data["l"]),
+		CumulativeQty:     parser.Parse(data["z"]),
+		LastExecutedPrice: parser.Parse(data["L"]),
+		Commission:        parser.Parse(data["n"]),
+		CommissionAsset:   ToString(data["N"]),
+		EventTime:         parser.Uint64(data["E"]),
+		TransactTime:      parser.Uint64(data["T"]),
+	}
+	return report, parser.Err
+}
+
+func (this *binanceExchange) parseAccountPosition(data map[string]interface{}) (*AccountPosition, error) {
+	parser := new(DecimalParser)
+	position := &AccountPosition{
+		EventTime:      parser.Uint64(data["E"]),
+		LastUpdateTime: parser.Uint64(data["u"]),
+	}
+	balances, _ := data["B"].([]interface{})
+	for _, v := range balances {
+		b, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		position.Balances = append(position.Balances, AssetBalance{
+			Asset:  ToString(b["a"]),
+			Free:   parser.Parse(b["f"]),
+			Locked: parser.Parse(b["l"]),
+		})
+	}
+	return position, parser.Err
+}
+
+func (this *binanceExchange) parseBalanceUpdate(data map[string]interface{}) (*BalanceUpdate, error) {
+	parser := new(DecimalParser)
+	update := &BalanceUpdate{
+		Asset:     ToString(data["a"]),
+		Delta:     parser.Parse(data["d"]),
+		EventTime: parser.Uint64(data["E"]),
+		ClearTime: parser.Uint64(data["T"]),
+	}
+	return update, parser.Err
+}
@@ -0,0 +1,273 @@
+package exchange
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	. "wisp/common"
+)
+
+//用户数据流测试桩，/api/v3/userDataStream 模拟listenKey接口，其余地址升级为websocket
+type userStreamStub struct {
+	*httptest.Server
+	sync.Mutex
+	requests []string //listenKey接口请求，如 "POST "、"PUT key-1"
+	keys     int
+	failPut  bool
+}
+
+func newUserStreamStub() *userStreamStub {
+	stub := &userStreamStub{}
+	upgrader := websocket.Upgrader{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/userDataStream" {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+
+		stub.Lock()
+		defer stub.Unlock()
+		if r.Header.Get("X-MBX-APIKEY") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		stub.requests = append(stub.requests, r.Method+" "+r.URL.Query().Get("listenKey"))
+		switch {
+		case r.Method == http.MethodPost:
+			stub.keys++
+			fmt.Fprintf(w, `{"listenKey":"key-%d"}`, stub.keys)
+		case r.Method == http.MethodPut && stub.failPut:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1125,"msg":"This listenKey does not exist."}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	return stub
+}
+
+func (this *userStreamStub) takeRequests() []string {
+	this.Lock()
+	defer this.Unlock()
+	requests := this.requests
+	this.requests = nil
+	return requests
+}
+
+func newUserStreamExchange(stub *userStreamStub) *binanceExchange {
+	binance := NewBinanceExchangeWithConfig(&APIConfig{ApiKey: "key"})
+	binance.rest.SetBaseUrl(stub.URL)
+	binance.baseUrl = "ws" + strings.TrimPrefix(stub.URL, "http") + "/ws"
+	binance.SetUserCallbacks(func(*ExecutionReport) {}, func(*AccountPosition) {}, func(*BalanceUpdate) {})
+	return binance
+}
+
+func TestBinanceListenKey(t *testing.T) {
+	stub := newUserStreamStub()
+	defer stub.Close()
+	binance := newUserStreamExchange(stub)
+
+	listenKey, err := binance.createListenKey()
+	if err != nil || listenKey != "key-1" {
+		t.Fatalf("createListenKey() = %q, %v, want key-1", listenKey, err)
+	}
+	if err := binance.keepAliveListenKey(listenKey); err != nil {
+		t.Errorf("keepAliveListenKey() = %v", err)
+	}
+	stub.Lock()
+	stub.failPut = true
+	stub.Unlock()
+	if err := binance.keepAliveListenKey(listenKey); err == nil {
+		t.Error("keepAliveListenKey() of an expired key succeeded")
+	}
+	want := []string{"POST ", "PUT key-1", "PUT key-1"}
+	if got := stub.takeRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestBinanceRenewUserStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		expired  bool
+		failPut  bool
+		closed   bool
+		wantKey  string
+		requests []string
+	}{
+		{"reconnect", false, false, false, "key-1", []string{"PUT key-1"}},
+		{"keepalive failed", false, true, false, "key-2", []string{"PUT key-1", "POST "}},
+		{"expired", true, false, false, "key-2", []string{"POST "}},
+		{"closed", true, false, true, "key-1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newUserStreamStub()
+			defer stub.Close()
+			binance := newUserStreamExchange(stub)
+			if err := binance.SubUserData(); err != nil {
+				t.Fatal(err)
+			}
+			stream := binance.currentUserStream()
+			defer binance.Close()
+			stub.takeRequests()
+			stub.Lock()
+			stub.failPut = tt.failPut
+			stub.Unlock()
+			stream.closed = tt.closed
+
+			binance.renewUserStream(stream, tt.expired)
+			if stream.listenKey != tt.wantKey {
+				t.Errorf("listenKey = %q, want %q", stream.listenKey, tt.wantKey)
+			}
+			if got := stub.takeRequests(); !reflect.DeepEqual(got, tt.requests) {
+				t.Errorf("requests = %q, want %q", got, tt.requests)
+			}
+			if got := stream.conn.State().Url; !strings.HasSuffix(got, "/ws/"+tt.wantKey) {
+				t.Errorf("connected to %q, want listenKey %q", got, tt.wantKey)
+			}
+			stream.closed = false
+		})
+	}
+}
+
+func TestBinanceSubUserData(t *testing.T) {
+	stub := newUserStreamStub()
+	defer stub.Close()
+	binance := newUserStreamExchange(stub)
+
+	if err := binance.SubUserData(); err != nil {
+		t.Fatal(err)
+	}
+	if err := binance.SubUserData(); err == nil {
+		t.Error("second SubUserData() succeeded")
+	}
+	if err := binance.UnsubUserData(); err != nil {
+		t.Errorf("UnsubUserData() = %v", err)
+	}
+	if err := binance.UnsubUserData(); err == nil {
+		t.Error("second UnsubUserData() succeeded")
+	}
+	want := []string{"POST ", "DELETE key-1"}
+	if got := stub.takeRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+
+	//连接失败时返回错误并删除listenKey，之后可重新订阅
+	binance.baseUrl = "ws://127.0.0.1:1/ws"
+	if err := binance.SubUserData(); err == nil {
+		t.Fatal("SubUserData() with an unreachable stream succeeded")
+	}
+	want = []string{"POST ", "DELETE key-2"}
+	if got := stub.takeRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	binance.baseUrl = "ws" + strings.TrimPrefix(stub.URL, "http") + "/ws"
+	if err := binance.SubUserData(); err != nil {
+		t.Errorf("SubUserData() after a failed dial = %v", err)
+	}
+	binance.Close()
+}
+
+func TestBinanceParseUserData(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		parse func(binance *binanceExchange, data map[string]interface{}) (interface{}, error)
+		want  interface{}
+	}{
+		{"executionReport", `{"e":"executionReport","E":1499405658658,"s":"ETHBTC","c":"mUvoqJxFIILMdfAW5iGSOW","S":"BUY","o":"LIMIT","f":"GTC",
+			"q":"1.00000000","p":"0.10264410","x":"TRADE","X":"PARTIALLY_FILLED","i":4293153,"l":"0.50000000","z":"0.50000000",
+			"L":"0.10264400","n":"0.00050000","N":"BNB","T":1499405658657,"t":718}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseExecutionReport(data)
+			},
+			&ExecutionReport{
+				Symbol:            "ETHBTC",
+				ClientOrderId:     "mUvoqJxFIILMdfAW5iGSOW",
+				Side:              "BUY",
+				OrderType:         "LIMIT",
+				TimeInForce:       "GTC",
+				ExecutionType:     "TRADE",
+				Status:            "PARTIALLY_FILLED",
+				OrderId:           4293153,
+				TradeId:           718,
+				Price:             MustDecimal("0.10264410"),
+				Quantity:          MustDecimal("1.00000000"),
+				LastExecutedQty:   MustDecimal("0.50000000"),
+				CumulativeQty:     MustDecimal("0.50000000"),
+				LastExecutedPrice: MustDecimal("0.10264400"),
+				Commission:        MustDecimal("0.00050000"),
+				CommissionAsset:   "BNB",
+				EventTime:         1499405658658,
+				TransactTime:      1499405658657,
+			}},
+		{"outboundAccountPosition", `{"e":"outboundAccountPosition","E":1564034571105,"u":1564034571073,
+			"B":[{"a":"ETH","f":"10000.000000","l":"0.000000"},{"a":"BTC","f":"0.5","l":"0.25"}]}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseAccountPosition(data)
+			},
+			&AccountPosition{
+				EventTime:      1564034571105,
+				LastUpdateTime: 1564034571073,
+				Balances: []AssetBalance{
+					{Asset: "ETH", Free: MustDecimal("10000.000000"), Locked: MustDecimal("0.000000")},
+					{Asset: "BTC", Free: MustDecimal("0.5"), Locked: MustDecimal("0.25")},
+				},
+			}},
+		{"balanceUpdate", `{"e":"balanceUpdate","E":1573200697110,"a":"BTC","d":"100.00000000","T":1573200697068}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseBalanceUpdate(data)
+			},
+			&BalanceUpdate{Asset: "BTC", Delta: MustDecimal("100.00000000"), EventTime: 1573200697110, ClearTime: 1573200697068}},
+		{"invalid event time", `{"e":"outboundAccountPosition","E":"soon","u":1564034571073,"B":[]}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseAccountPosition(data)
+			},
+			nil},
+		{"invalid order id", `{"e":"executionReport","E":1499405658658,"s":"ETHBTC","i":4293153.5,"t":-1}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseExecutionReport(data)
+			},
+			nil},
+		{"invalid decimal", `{"e":"balanceUpdate","E":1573200697110,"a":"BTC","d":"1e","T":1573200697068}`,
+			func(binance *binanceExchange, data map[string]interface{}) (interface{}, error) {
+				return binance.parseBalanceUpdate(data)
+			},
+			nil},
+	}
+	binance := NewBinanceExchange()
+	for _, tt := range tests {
+		data := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(tt.msg), &data); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := tt.parse(binance, data)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: parsed %+v, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
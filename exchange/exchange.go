@@ -0,0 +1,38 @@
+package exchange
+
+import (
+	. "wisp/common"
+	"wisp/ws"
+)
+
+//行情交易所适配器，订阅参数支持交易所符号及标准写法 BASE/QUOTE
+type Exchange interface {
+	GetExchangeName() string
+	SymbolMapper() SymbolMapper
+	SetEventCallback(eventCallback func(*MarketEvent))
+	SetCallbacks(depthCallback func(*Depth), tickerCallback func(*Ticker), klineCallback func(*Kline, int))
+	SubDepths(symbol string, size int) error
+	SubTicker(symbol string) error
+	SubKline(symbol string, period int) error
+	SetTradeCallback(tradeCallback func(*Trade))
+	SubTrade(symbol string) error
+	UnsubDepths(symbol string, size int) error
+	UnsubTicker(symbol string) error
+	UnsubKline(symbol string, period int) error
+	UnsubTrade(symbol string) error
+}
+
+//可查看连接状态及强制重连的交易所
+type ConnectionManager interface {
+	Connections() []ws.ConnectionState
+	ReconnectConnection(id uint64) error
+}
+
+//提供交易对元数据的交易所
+type SymbolProvider interface {
+	Symbols() *SymbolRegistry
+}
+
+var _ Exchange = (*binanceExchange)(nil)
+var _ ConnectionManager = (*binanceExchange)(nil)
+var _ SymbolProvider = (*binanceExchange)(nil)
@@ -0,0 +1,256 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	. "wisp/common"
+	"wisp/ws"
+)
+
+//管理各交易所的行情订阅，按目标订阅集合只订阅及取消差异部分
+type Manager struct {
+	sync.Mutex
+	exchanges map[string]Exchange
+	subs      map[string]Subscription
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		exchanges: make(map[string]Exchange),
+		subs:      make(map[string]Subscription),
+	}
+}
+
+//注册交易所，订阅项按交易所名称路由
+func (this *Manager) Register(e Exchange) {
+	this.Lock()
+	defer this.Unlock()
+	this.exchanges[e.GetExchangeName()] = e
+}
+
+func (this *Manager) Exchange(name string) (Exchange, bool) {
+	this.Lock()
+	defer this.Unlock()
+	e, ok := this.exchanges[name]
+	return e, ok
+}
+
+//当前的订阅项，按标识排序
+func (this *Manager) Subscriptions() []Subscription {
+	this.Lock()
+	defer this.Unlock()
+	subs := make([]Subscription, 0, len(this.subs))
+	for _, sub := range this.subs {
+		subs = append(subs, sub)
+	}
+	SortSubscriptions(subs)
+	return subs
+}
+
+//各交易所的连接状态
+func (this *Manager) Connections() map[string][]ws.ConnectionState {
+	this.Lock()
+	exchanges := make(map[string]Exchange, len(this.exchanges))
+	for name, e := range this.exchanges {
+		exchanges[name] = e
+	}
+	this.Unlock()
+
+	states := make(map[string][]ws.ConnectionState, len(exchanges))
+	for name, e := range exchanges {
+		if cm, ok := e.(ConnectionManager); ok {
+			states[name] = cm.Connections()
+		}
+	}
+	return states
+}
+
+//强制交易所的指定连接重连
+func (this *Manager) Reconnect(exchange string, id uint64) error {
+	e, ok := this.Exchange(exchange)
+	if !ok {
+		return fmt.Errorf("交易所未启动: %s", exchange)
+	}
+	cm, ok := e.(ConnectionManager)
+	if !ok {
+		return fmt.Errorf("交易所 %s 不支持连接管理", exchange)
+	}
+	return cm.ReconnectConnection(id)
+}
+
+//交易所的交易对元数据
+func (this *Manager) Symbols(exchange string) (*SymbolRegistry, error) {
+	e, ok := this.Exchange(exchange)
+	if !ok {
+		return nil, fmt.Errorf("交易所未启动: %s", exchange)
+	}
+	sp, ok := e.(SymbolProvider)
+	if !ok {
+		return nil, fmt.Errorf("交易所 %s 不提供交易对信息", exchange)
+	}
+	return sp.Symbols(), nil
+}
+
+func (this *Manager) Subscribe(sub Subscription) error {
+	this.Lock()
+	defer this.Unlock()
+	return this.subscribe(this.normalize(sub))
+}
+
+func (this *Manager) Unsubscribe(sub Subscription) error {
+	this.Lock()
+	defer this.Unlock()
+	return this.unsubscribe(this.normalize(sub))
+}
+
+//将订阅集合变更为target，先取消再订阅，单项失败不影响其余项
+func (this *Manager) Apply(target []Subscription) (added, removed []Subscription, err error) {
+	this.Lock()
+	defer this.Unlock()
+
+	current := make([]Subscription, 0, len(this.subs))
+	for _, sub := range this.subs {
+		current = append(current, sub)
+	}
+	normalized := make([]Subscription, 0, len(target))
+	seen := make(map[string]bool, len(target))
+	for _, sub := range target {
+		sub = this.normalize(sub)
+		if !seen[sub.String()] {
+			seen[sub.String()] = true
+			normalized = append(normalized, sub)
+		}
+	}
+	toAdd, toRemove := DiffSubscriptions(current, normalized)
+	SortSubscriptions(toAdd)
+	SortSubscriptions(toRemove)
+
+	var problems []string
+	for _, sub := range toRemove {
+		if err := this.unsubscribe(sub); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", sub.String(), err))
+			continue
+		}
+		removed = append(removed, sub)
+	}
+	for _, sub := range toAdd {
+		if err := this.subscribe(sub); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", sub.String(), err))
+			continue
+		}
+		added = append(added, sub)
+	}
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+	}
+	return added, removed, err
+}
+
+//取消所有订阅并关闭交易所连接，用于进程退出
+func (this *Manager) Close() error {
+	_, _, err := this.Apply(nil)
+
+	this.Lock()
+	defer this.Unlock()
+	var problems []string
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for name, e := range this.exchanges {
+		if c, ok := e.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+//交易标的统一转换为交易所符号，BTC/USDT 与 btcusdt 视为同一订阅项
+//交易所未启动或无法识别的交易标的原样返回，由订阅时报错
+func (this *Manager) normalize(sub Subscription) Subscription {
+	e, ok := this.exchanges[sub.Exchange]
+	if !ok {
+		return sub
+	}
+	mapper := e.SymbolMapper()
+	if mapper == nil {
+		return sub
+	}
+
+	var instrument Instrument
+	var err error
+	if IsInstrument(sub.Symbol) {
+		instrument, err = ParseInstrument(sub.Symbol)
+	} else {
+		instrument, err = mapper.FromVenue(sub.Symbol)
+	}
+	if err != nil || (instrument.Venue != "" && instrument.Venue != sub.Exchange) {
+		return sub
+	}
+	if symbol, err := mapper.ToVenue(instrument); err == nil {
+		sub.Symbol = symbol
+	}
+	return sub
+}
+
+func (this *Manager) subscribe(sub Subscription) error {
+	if _, ok := this.subs[sub.String()]; ok {
+		return fmt.Errorf("重复订阅: %s", sub.String())
+	}
+	e, ok := this.exchanges[sub.Exchange]
+	if !ok {
+		return fmt.Errorf("交易所未启动: %s", sub.Exchange)
+	}
+
+	var err error
+	switch sub.Channel {
+	case CHANNEL_DEPTH:
+		err = e.SubDepths(sub.Symbol, sub.Param)
+	case CHANNEL_TICKER:
+		err = e.SubTicker(sub.Symbol)
+	case CHANNEL_KLINE:
+		err = e.SubKline(sub.Symbol, sub.Param)
+	case CHANNEL_TRADE:
+		err = e.SubTrade(sub.Symbol)
+	default:
+		err = fmt.Errorf("未知的频道: %s", sub.Channel)
+	}
+	if err != nil {
+		return err
+	}
+	this.subs[sub.String()] = sub
+	return nil
+}
+
+func (this *Manager) unsubscribe(sub Subscription) error {
+	if _, ok := this.subs[sub.String()]; !ok {
+		return fmt.Errorf("未订阅: %s", sub.String())
+	}
+	e, ok := this.exchanges[sub.Exchange]
+	if !ok {
+		return fmt.Errorf("交易所未启动: %s", sub.Exchange)
+	}
+
+	var err error
+	switch sub.Channel {
+	case CHANNEL_DEPTH:
+		err = e.UnsubDepths(sub.Symbol, sub.Param)
+	case CHANNEL_TICKER:
+		err = e.UnsubTicker(sub.Symbol)
+	case CHANNEL_KLINE:
+		err = e.UnsubKline(sub.Symbol, sub.Param)
+	case CHANNEL_TRADE:
+		err = e.UnsubTrade(sub.Symbol)
+	default:
+		err = fmt.Errorf("未知的频道: %s", sub.Channel)
+	}
+	delete(this.subs, sub.String())
+	return err
+}
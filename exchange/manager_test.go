@@ -0,0 +1,278 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	. "wisp/common"
+)
+
+//记录订阅调用的交易所，symbol在fail中时订阅及取消均返回错误
+type fakeExchange struct {
+	name   string
+	mapper SymbolMapper
+	fail   map[string]bool
+	calls  []string
+}
+
+func (this *fakeExchange) record(op, symbol string, param int) error {
+	this.calls = append(this.calls, fmt.Sprintf("%s %s %d", op, symbol, param))
+	if this.fail[symbol] {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func (this *fakeExchange) GetExchangeName() string {
+	return this.name
+}
+
+func (this *fakeExchange) SymbolMapper() SymbolMapper {
+	return this.mapper
+}
+
+func (this *fakeExchange) SetEventCallback(func(*MarketEvent)) {}
+
+func (this *fakeExchange) SetCallbacks(func(*Depth), func(*Ticker), func(*Kline, int)) {}
+
+func (this *fakeExchange) SetTradeCallback(func(*Trade)) {}
+
+func (this *fakeExchange) SubDepths(symbol string, size int) error {
+	return this.record("sub depth", symbol, size)
+}
+
+func (this *fakeExchange) SubTicker(symbol string) error {
+	return this.record("sub ticker", symbol, 0)
+}
+
+func (this *fakeExchange) SubKline(symbol string, period int) error {
+	return this.record("sub kline", symbol, period)
+}
+
+func (this *fakeExchange) SubTrade(symbol string) error {
+	return this.record("sub trade", symbol, 0)
+}
+
+func (this *fakeExchange) UnsubDepths(symbol string, size int) error {
+	return this.record("unsub depth", symbol, size)
+}
+
+func (this *fakeExchange) UnsubTicker(symbol string) error {
+	return this.record("unsub ticker", symbol, 0)
+}
+
+func (this *fakeExchange) UnsubKline(symbol string, period int) error {
+	return this.record("unsub kline", symbol, period)
+}
+
+func (this *fakeExchange) UnsubTrade(symbol string) error {
+	return this.record("unsub trade", symbol, 0)
+}
+
+func TestManagerApply(t *testing.T) {
+	ticker := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TICKER}
+	trade := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TRADE}
+	depth5 := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_DEPTH, Param: 5}
+	depth10 := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_DEPTH, Param: 10}
+	kline := Subscription{Exchange: BINANCE, Symbol: "ethusdt", Channel: CHANNEL_KLINE, Param: KLINE_PERIOD_1MIN}
+	broken := Subscription{Exchange: BINANCE, Symbol: "badusdt", Channel: CHANNEL_TICKER}
+	unknown := Subscription{Exchange: "okex", Symbol: "btcusdt", Channel: CHANNEL_TICKER}
+	orders := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: "orders"}
+
+	tests := []struct {
+		name        string
+		initial     []Subscription
+		target      []Subscription
+		wantAdded   []Subscription
+		wantRemoved []Subscription
+		wantCalls   []string
+		wantErr     string
+		wantSubs    []Subscription
+	}{
+		{
+			name:      "subscribe all",
+			target:    []Subscription{ticker, depth5, kline},
+			wantAdded: []Subscription{depth5, ticker, kline},
+			wantCalls: []string{"sub depth btcusdt 5", "sub ticker btcusdt 0", "sub kline ethusdt 1"},
+			wantSubs:  []Subscription{depth5, ticker, kline},
+		},
+		{
+			name:     "unchanged",
+			initial:  []Subscription{ticker, trade},
+			target:   []Subscription{trade, ticker},
+			wantSubs: []Subscription{ticker, trade},
+		},
+		{
+			name:        "unsubscribe before subscribe",
+			initial:     []Subscription{ticker, depth5},
+			target:      []Subscription{ticker, depth10, trade},
+			wantAdded:   []Subscription{depth10, trade},
+			wantRemoved: []Subscription{depth5},
+			wantCalls:   []string{"unsub depth btcusdt 5", "sub depth btcusdt 10", "sub trade btcusdt 0"},
+			wantSubs:    []Subscription{depth10, ticker, trade},
+		},
+		{
+			name:        "clear",
+			initial:     []Subscription{ticker, kline},
+			wantRemoved: []Subscription{ticker, kline},
+			wantCalls:   []string{"unsub ticker btcusdt 0", "unsub kline ethusdt 1"},
+			wantSubs:    []Subscription{},
+		},
+		{
+			name:      "failures don't stop the rest",
+			target:    []Subscription{broken, unknown, orders, ticker},
+			wantAdded: []Subscription{ticker},
+			wantCalls: []string{"sub ticker badusdt 0", "sub ticker btcusdt 0"},
+			wantErr:   "binance.badusdt.ticker: refused; binance.btcusdt.orders: 未知的频道: orders; okex.btcusdt.ticker: 交易所未启动: okex",
+			wantSubs:  []Subscription{ticker},
+		},
+		{
+			name:      "failed unsubscribe is dropped",
+			initial:   []Subscription{broken},
+			wantCalls: []string{"unsub ticker badusdt 0"},
+			wantErr:   "binance.badusdt.ticker: refused",
+			wantSubs:  []Subscription{},
+		},
+	}
+	for _, tt := range tests {
+		ex := &fakeExchange{name: BINANCE}
+		manager := NewManager()
+		manager.Register(ex)
+		for _, sub := range tt.initial {
+			if err := manager.Subscribe(sub); err != nil {
+				t.Fatalf("%s: Subscribe(%v) = %v", tt.name, sub, err)
+			}
+		}
+		ex.calls = nil
+		ex.fail = map[string]bool{"badusdt": true}
+
+		added, removed, err := manager.Apply(tt.target)
+		if !reflect.DeepEqual(added, tt.wantAdded) {
+			t.Errorf("%s: added = %v, want %v", tt.name, added, tt.wantAdded)
+		}
+		if !reflect.DeepEqual(removed, tt.wantRemoved) {
+			t.Errorf("%s: removed = %v, want %v", tt.name, removed, tt.wantRemoved)
+		}
+		if !reflect.DeepEqual(ex.calls, tt.wantCalls) {
+			t.Errorf("%s: calls = %q, want %q", tt.name, ex.calls, tt.wantCalls)
+		}
+		if (err == nil) != (tt.wantErr == "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if subs := manager.Subscriptions(); !reflect.DeepEqual(subs, tt.wantSubs) {
+			t.Errorf("%s: subscriptions = %v, want %v", tt.name, subs, tt.wantSubs)
+		}
+	}
+}
+
+func TestManagerSubscribe(t *testing.T) {
+	ticker := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TICKER}
+	okex := func(symbol string) Subscription {
+		return Subscription{Exchange: "okex", Symbol: symbol, Channel: CHANNEL_TICKER}
+	}
+	tests := []struct {
+		name    string
+		op      func(m *Manager) error
+		wantErr string
+	}{
+		{"subscribe", func(m *Manager) error { return m.Subscribe(ticker) }, ""},
+		{"duplicate", func(m *Manager) error {
+			m.Subscribe(ticker)
+			return m.Subscribe(ticker)
+		}, "重复订阅"},
+		{"unsubscribe", func(m *Manager) error {
+			m.Subscribe(ticker)
+			return m.Unsubscribe(ticker)
+		}, ""},
+		{"not subscribed", func(m *Manager) error { return m.Unsubscribe(ticker) }, "未订阅"},
+		{"instrument duplicates venue symbol", func(m *Manager) error {
+			m.Subscribe(okex("BTC/USDT"))
+			return m.Subscribe(okex("btc-usdt"))
+		}, "重复订阅: okex.BTC-USDT.ticker"},
+		{"unsubscribe by instrument", func(m *Manager) error {
+			m.Subscribe(okex("BTC-USDT"))
+			return m.Unsubscribe(okex("okex:btc/usdt"))
+		}, ""},
+		{"other venue", func(m *Manager) error {
+			m.Subscribe(okex("BTC-USDT"))
+			return m.Unsubscribe(okex("binance:BTC/USDT"))
+		}, "未订阅: okex.binance:BTC/USDT.ticker"},
+	}
+	for _, tt := range tests {
+		manager := NewManager()
+		manager.Register(&fakeExchange{name: BINANCE})
+		manager.Register(&fakeExchange{name: "okex", mapper: &DelimitedSymbolMapper{Venue: "okex", Separator: "-"}})
+		err := tt.op(manager)
+		if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestManagerApplyNormalize(t *testing.T) {
+	ex := &fakeExchange{name: "okex", mapper: &DelimitedSymbolMapper{Venue: "okex", Separator: "-"}}
+	manager := NewManager()
+	manager.Register(ex)
+	ticker := Subscription{Exchange: "okex", Symbol: "BTC-USDT", Channel: CHANNEL_TICKER}
+
+	tests := []struct {
+		name      string
+		target    []Subscription
+		wantAdded []Subscription
+		wantCalls []string
+	}{
+		{"instrument", []Subscription{
+			{Exchange: "okex", Symbol: "BTC/USDT", Channel: CHANNEL_TICKER},
+			{Exchange: "okex", Symbol: "btc-usdt", Channel: CHANNEL_TICKER},
+		}, []Subscription{ticker}, []string{"sub ticker BTC-USDT 0"}},
+		{"venue symbol unchanged", []Subscription{{Exchange: "okex", Symbol: "btc-usdt", Channel: CHANNEL_TICKER}}, nil, nil},
+	}
+	for _, tt := range tests {
+		ex.calls = nil
+		added, removed, err := manager.Apply(tt.target)
+		if err != nil || len(removed) > 0 {
+			t.Errorf("%s: removed = %v, err = %v", tt.name, removed, err)
+		}
+		if !reflect.DeepEqual(added, tt.wantAdded) {
+			t.Errorf("%s: added = %v, want %v", tt.name, added, tt.wantAdded)
+		}
+		if !reflect.DeepEqual(ex.calls, tt.wantCalls) {
+			t.Errorf("%s: calls = %q, want %q", tt.name, ex.calls, tt.wantCalls)
+		}
+	}
+}
+
+//连接失败的订阅项报告错误且不影响其余项，下次变更时重试
+func TestManagerApplyDialError(t *testing.T) {
+	stub := newUserStreamStub()
+	defer stub.Close()
+	binance := newUserStreamExchange(stub)
+	binance.SetEventCallback(func(*MarketEvent) {})
+	binance.combinedBaseUrl = "ws://127.0.0.1:1/stream?streams="
+	manager := NewManager()
+	manager.Register(binance)
+	manager.Register(&fakeExchange{name: "okex"})
+	defer manager.Close()
+
+	ticker := Subscription{Exchange: BINANCE, Symbol: "btcusdt", Channel: CHANNEL_TICKER}
+	okex := Subscription{Exchange: "okex", Symbol: "btc-usdt", Channel: CHANNEL_TICKER}
+	target := []Subscription{ticker, okex}
+	added, _, err := manager.Apply(target)
+	if err == nil || !strings.HasPrefix(err.Error(), "binance.btcusdt.ticker: 订阅 btcusdt@miniTicker 连接失败") {
+		t.Errorf("Apply() err = %v, want the failed binance subscription", err)
+	}
+	if want := []Subscription{okex}; !reflect.DeepEqual(added, want) || !reflect.DeepEqual(manager.Subscriptions(), want) {
+		t.Errorf("added = %v, subscriptions = %v, want %v", added, manager.Subscriptions(), want)
+	}
+
+	binance.combinedBaseUrl = "ws" + strings.TrimPrefix(stub.URL, "http") + "/stream?streams="
+	added, _, err = manager.Apply(target)
+	if want := []Subscription{ticker}; err != nil || !reflect.DeepEqual(added, want) {
+		t.Errorf("retry Apply() = %v, %v, want %v", added, err, want)
+	}
+	if streams := binance.Streams(); !reflect.DeepEqual(streams, []string{"btcusdt@miniTicker"}) {
+		t.Errorf("streams = %v", streams)
+	}
+}
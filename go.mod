@@ -3,8 +3,13 @@ module wisp
 go 1.13
 
 require (
+	github.com/go-redis/redis/v7 v7.4.0
 	github.com/gorilla/websocket v1.4.1
 	github.com/json-iterator/go v1.1.9
+	github.com/nats-io/nats.go v1.9.1
+	github.com/segmentio/kafka-go v0.3.5
 	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/yaml.v2 v2.2.7
 )
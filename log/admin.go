@@ -0,0 +1,35 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+//日志等级管理接口
+//GET 返回全局及各模块等级；POST ?module=ws&level=debug 设置模块等级，
+//module为空时设置全局等级，level=inherit 时模块恢复沿用全局等级
+func LevelHandler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			module := req.FormValue("module")
+			level := req.FormValue("level")
+			if level == "inherit" && module != "" {
+				Named(module).ResetLevel()
+			} else if l, ok := levelByName(level); ok {
+				SetLevel(module, l)
+			} else {
+				http.Error(res, fmt.Sprintf("未知的日志等级: %s", level), http.StatusBadRequest)
+				return
+			}
+			Warn("日志等级已修改: module=%s level=%s\n", module, level)
+		default:
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(Levels())
+	}
+}
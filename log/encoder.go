@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+//日志编码器，将日志条目编码为一行
+type Encoder interface {
+	Encode(e *Entry) []byte
+}
+
+func NewEncoder(format, prefix string) (Encoder, error) {
+	switch strings.ToLower(format) {
+	case "", FORMAT_TEXT:
+		return &TextEncoder{Prefix: prefix}, nil
+	case FORMAT_JSON:
+		return &JSONEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("未知的日志格式: %s", format)
+	}
+}
+
+//文本格式: 前缀 时间 [级别][模块]消息 key=value ...
+type TextEncoder struct {
+	Prefix string
+}
+
+func (this *TextEncoder) Encode(e *Entry) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(this.Prefix)
+	buf.WriteString(e.Time.Format("2006/01/02 15:04:05.000000 "))
+	buf.WriteString("[" + e.Level.String() + "]")
+	if e.Module != "" {
+		buf.WriteString("[" + e.Module + "]")
+	}
+	buf.WriteString(strings.TrimRight(e.Message, "\n"))
+	for _, k := range sortedFields(e.Fields) {
+		buf.WriteString(" " + k + "=" + textValue(e.Fields[k]))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+//包含空格、等号或引号的值加引号输出
+func textValue(v interface{}) string {
+	s := fieldString(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+//JSON格式，每行一个对象，time/level/module/msg与字段同级，同名字段加 fields. 前缀
+type JSONEncoder struct{}
+
+func (this *JSONEncoder) Encode(e *Entry) []byte {
+	data := make(map[string]interface{}, len(e.Fields)+3)
+	for k, v := range e.Fields {
+		if k == "time" || k == "level" || k == "module" || k == "msg" {
+			k = "fields." + k
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+	data["time"] = e.Time.Format("2006-01-02T15:04:05.000000Z07:00")
+	data["level"] = e.Level.String()
+	if e.Module != "" {
+		data["module"] = e.Module
+	}
+	data["msg"] = strings.TrimRight(e.Message, "\n")
+
+	line, err := json.Marshal(data)
+	if err != nil {
+		//字段无法编码时退化为字符串
+		for k, v := range data {
+			data[k] = fieldString(v)
+		}
+		line, _ = json.Marshal(data)
+	}
+	return append(line, '\n')
+}
+
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func sortedFields(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    Encoder
+		wantErr bool
+	}{
+		{"", &TextEncoder{Prefix: "[p] "}, false},
+		{"text", &TextEncoder{Prefix: "[p] "}, false},
+		{"JSON", &JSONEncoder{}, false},
+		{"xml", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := NewEncoder(tt.format, "[p] ")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewEncoder(%q) err = %v, wantErr %v", tt.format, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewEncoder(%q) = %#v, want %#v", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestTextEncoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"plain", Entry{Level: INFO, Message: "连接成功\n"}, "[p] 2020/01/02 03:04:05.000006 [INFO]连接成功\n"},
+		{"module", Entry{Level: WARN, Module: "ws", Message: "重连"}, "[p] 2020/01/02 03:04:05.000006 [WARN][ws]重连\n"},
+		{"sorted fields", Entry{Level: ERROR, Message: "失败", Fields: Fields{"symbol": "btcusdt", "conn_id": 3, "exchange": "binance"}},
+			"[p] 2020/01/02 03:04:05.000006 [ERROR]失败 conn_id=3 exchange=binance symbol=btcusdt\n"},
+		{"quoted values", Entry{Level: DEBUG, Message: "m", Fields: Fields{"a": "x y", "b": "k=v", "c": "", "d": `say "hi"`, "e": "l1\nl2"}},
+			`[p] 2020/01/02 03:04:05.000006 [DEBUG]m a="x y" b="k=v" c="" d="say \"hi\"" e="l1\nl2"` + "\n"},
+		{"error value", Entry{Level: ERROR, Message: "m", Fields: Fields{"err": errors.New("timeout")}}, "[p] 2020/01/02 03:04:05.000006 [ERROR]m err=timeout\n"},
+	}
+	encoder := &TextEncoder{Prefix: "[p] "}
+	for _, tt := range tests {
+		tt.entry.Time = testTime
+		if got := string(encoder.Encode(&tt.entry)); got != tt.want {
+			t.Errorf("%s: Encode = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  map[string]interface{}
+	}{
+		{"plain", Entry{Level: INFO, Message: "连接成功\n"}, map[string]interface{}{
+			"time": "2020-01-02T03:04:05.000006Z", "level": "INFO", "msg": "连接成功",
+		}},
+		{"module and fields", Entry{Level: WARN, Module: "ws", Message: "重连", Fields: Fields{"conn_id": 3, "err": errors.New("eof")}}, map[string]interface{}{
+			"time": "2020-01-02T03:04:05.000006Z", "level": "WARN", "module": "ws", "msg": "重连", "conn_id": float64(3), "err": "eof",
+		}},
+		{"reserved keys", Entry{Level: ERROR, Message: "m", Fields: Fields{"time": 1, "level": "x", "module": "y", "msg": "z"}}, map[string]interface{}{
+			"time": "2020-01-02T03:04:05.000006Z", "level": "ERROR", "msg": "m",
+			"fields.time": float64(1), "fields.level": "x", "fields.module": "y", "fields.msg": "z",
+		}},
+		{"unsupported value", Entry{Level: INFO, Message: "m", Fields: Fields{"ch": make(chan int), "n": 1}}, map[string]interface{}{
+			"time": "2020-01-02T03:04:05.000006Z", "level": "INFO", "msg": "m", "n": "1",
+		}},
+	}
+	encoder := &JSONEncoder{}
+	for _, tt := range tests {
+		tt.entry.Time = testTime
+		line := encoder.Encode(&tt.entry)
+		if line[len(line)-1] != '\n' {
+			t.Errorf("%s: missing newline", tt.name)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(line, &got); err != nil {
+			t.Errorf("%s: invalid json %q: %v", tt.name, line, err)
+			continue
+		}
+		//无法编码的字段退化为字符串，内容为指针地址，只检查存在
+		if _, ok := tt.entry.Fields["ch"]; ok {
+			if _, ok := got["ch"].(string); !ok {
+				t.Errorf("%s: ch = %v, want string", tt.name, got["ch"])
+			}
+			delete(got, "ch")
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Encode = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
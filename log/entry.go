@@ -0,0 +1,97 @@
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+//结构化日志字段，如 exchange、symbol、conn_id
+type Fields map[string]interface{}
+
+//日志条目，通过 WithFields 创建带字段的条目后调用 Info/Warn/Error/Debug 输出
+type Entry struct {
+	Time    time.Time
+	Level   LEVEL
+	Module  string //模块名称，全局日志为空
+	Message string
+	Fields  Fields
+	logger  *Logger
+	synced  chan error //Sync标记，写入线程写完之前的日志后通知
+
+	sampler   Sampler //采样器，为空时不采样
+	sampleKey string  //采样的key，如 binance.depth.btcusdt
+}
+
+func WithFields(fields Fields) *Entry {
+	return (&Entry{}).WithFields(fields)
+}
+
+func WithField(key string, value interface{}) *Entry {
+	return WithFields(Fields{key: value})
+}
+
+//返回合并了新字段的条目，原条目不变
+func (this *Entry) WithFields(fields Fields) *Entry {
+	merged := make(Fields, len(this.Fields)+len(fields))
+	for k, v := range this.Fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{Fields: merged, logger: this.logger, sampler: this.sampler, sampleKey: this.sampleKey}
+}
+
+func (this *Entry) WithField(key string, value interface{}) *Entry {
+	return this.WithFields(Fields{key: value})
+}
+
+func (this *Entry) Debug(format string, v ...interface{}) {
+	this.log(DEBUG, format, v...)
+}
+
+func (this *Entry) Info(format string, v ...interface{}) {
+	this.log(INFO, format, v...)
+}
+
+func (this *Entry) Warn(format string, v ...interface{}) {
+	this.log(WARN, format, v...)
+}
+
+func (this *Entry) Error(format string, v ...interface{}) {
+	this.log(ERROR, format, v...)
+}
+
+//生效的日志等级，模块日志按模块等级，否则按全局等级
+func (this *Entry) level() LEVEL {
+	if this.logger != nil {
+		return this.logger.Level()
+	}
+	return rootLevel()
+}
+
+func (this *Entry) log(level LEVEL, format string, v ...interface{}) {
+	if fileLogger == nil || this.level() > level {
+		return
+	}
+	fields := this.Fields
+	if this.sampler != nil {
+		ok, skipped := this.sampler.Sample(this.sampleKey)
+		if !ok {
+			return
+		}
+		if skipped > 0 {
+			fields = this.WithField(FIELD_SAMPLED_SKIPPED, skipped).Fields
+		}
+	}
+	e := &Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, v...),
+		Fields:  fields,
+	}
+	if this.logger != nil {
+		e.Module = this.logger.name
+	}
+	fileLogger.enqueue(e)
+}
@@ -0,0 +1,124 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+//日志钩子，在日志写入输出后调用，可将告警级别日志转发到外部
+type Hook interface {
+	Levels() []LEVEL
+	Fire(e *Entry) error
+}
+
+//添加日志钩子，钩子在写入协程中调用，耗时操作应自行异步处理
+func AddHook(hook Hook) {
+	fileLogger.outL.Lock()
+	defer fileLogger.outL.Unlock()
+	hooks := make([]Hook, 0, len(fileLogger.hooks)+1)
+	hooks = append(hooks, fileLogger.hooks...)
+	fileLogger.hooks = append(hooks, hook)
+}
+
+func (this *FileLogger) fireHooks(e *Entry) {
+	this.outL.RLock()
+	hooks := this.hooks
+	this.outL.RUnlock()
+
+	for _, hook := range hooks {
+		for _, level := range hook.Levels() {
+			if level != e.Level {
+				continue
+			}
+			if err := hook.Fire(e); err != nil {
+				fmt.Fprintf(os.Stderr, "Log hook error: %v\n", err)
+			}
+			break
+		}
+	}
+}
+
+//函数形式的钩子
+type FuncHook struct {
+	levels []LEVEL
+	fire   func(e *Entry) error
+}
+
+func NewFuncHook(fire func(e *Entry) error, levels ...LEVEL) *FuncHook {
+	if len(levels) == 0 {
+		levels = []LEVEL{ERROR}
+	}
+	return &FuncHook{levels: levels, fire: fire}
+}
+
+func (this *FuncHook) Levels() []LEVEL {
+	return this.levels
+}
+
+func (this *FuncHook) Fire(e *Entry) error {
+	return this.fire(e)
+}
+
+//告警钩子，将ERROR日志以JSON格式POST到告警地址
+//发送在独立协程中进行，队列写满时丢弃，不阻塞日志写入
+type AlertHook struct {
+	url     string
+	client  *http.Client
+	encoder Encoder
+	queue   chan *Entry
+	dropped uint64
+}
+
+func NewAlertHook(url string) *AlertHook {
+	hook := &AlertHook{
+		url:     url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		encoder: &JSONEncoder{},
+		queue:   make(chan *Entry, 100),
+	}
+	go hook.loop()
+	return hook
+}
+
+func (this *AlertHook) Levels() []LEVEL {
+	return []LEVEL{ERROR}
+}
+
+func (this *AlertHook) Fire(e *Entry) error {
+	select {
+	case this.queue <- e:
+		return nil
+	default:
+		atomic.AddUint64(&this.dropped, 1)
+		return fmt.Errorf("告警队列已满，丢弃日志: %s", e.Message)
+	}
+}
+
+//因队列写满而未发送的告警数
+func (this *AlertHook) Dropped() uint64 {
+	return atomic.LoadUint64(&this.dropped)
+}
+
+func (this *AlertHook) loop() {
+	for e := range this.queue {
+		if err := this.send(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Log alert error: %v\n", err)
+		}
+	}
+}
+
+func (this *AlertHook) send(e *Entry) error {
+	resp, err := this.client.Post(this.url, "application/json", bytes.NewReader(this.encoder.Encode(e)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("告警地址返回 %s", resp.Status)
+	}
+	return nil
+}
@@ -1,12 +1,10 @@
 package log
 
 import (
-	"fmt"
-	"log"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,17 +22,64 @@ const (
 	ERROR              //3
 )
 
+func (this LEVEL) String() string {
+	switch this {
+	case DEBUG:
+		return "DEBUG"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+//解析日志等级名称，未知名称按INFO处理
+func ParseLevel(level string) LEVEL {
+	l, _ := levelByName(level)
+	return l
+}
+
+func levelByName(level string) (LEVEL, bool) {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return DEBUG, true
+	case "INFO":
+		return INFO, true
+	case "WARN":
+		return WARN, true
+	case "ERROR":
+		return ERROR, true
+	default:
+		return INFO, false
+	}
+}
+
 type FileLogger struct {
 	fileDir        string        //日志存储路径
 	fileName       string        //日志文件名称
 	prefix         string        //日志消息前缀
-	logLevel       LEVEL         //日志等级
+	logLevel       int32         //全局日志等级，运行时可修改
+	initLevel      LEVEL         //初始化时的日志等级
 	logFile        *os.File      //日志文件
 	date           *time.Time    //日志当前时间
-	lg             *log.Logger   //系统日志对象
 	mu             *sync.RWMutex //读写锁，在进行日志分割和日志写入时需要锁住
-	logChan        chan string   //日志消息通道，以实现异步写日志
+	logChan        chan *Entry   //日志消息通道，以实现异步写日志
 	stopTickerChan chan bool     //停止定时器的通道
+	rotate         RotateOptions //切割及保留策略
+	size           int64         //当前日志文件大小
+
+	chanL       sync.RWMutex   //保护通道关闭状态及溢出策略
+	closed      bool           //通道是否已关闭
+	overflow    OverflowPolicy //通道写满时的处理策略
+	dropped     uint64         //丢弃的日志条数
+	writerDone  chan struct{}  //写入协程退出通知
+	lastDropped uint64         //上次报告时的丢弃条数
+
+	outL    sync.RWMutex //保护输出及钩子列表
+	outputs []*Output    //日志输出，默认仅输出到文件
+	hooks   []Hook       //日志钩子
 }
 
 //初始化系统日志
@@ -46,34 +91,27 @@ func Init(fileDir, fileName, prefix, level string) error {
 		fileDir:        fileDir,
 		fileName:       fileName,
 		prefix:         prefix,
+		logLevel:       int32(ParseLevel(level)),
+		initLevel:      ParseLevel(level),
 		mu:             new(sync.RWMutex),
-		logChan:        make(chan string, 5000),
+		logChan:        make(chan *Entry, 5000),
 		stopTickerChan: make(chan bool, 1),
-	}
-
-	//定义日志等级
-	switch strings.ToUpper(level) {
-	case "DEBUG":
-		f.logLevel = DEBUG
-	case "WARN":
-		f.logLevel = WARN
-	case "ERROR":
-		f.logLevel = ERROR
-	default:
-		f.logLevel = INFO
+		writerDone:     make(chan struct{}),
 	}
 
 	t, _ := time.Parse(DATE_FORMAT, time.Now().Format(DATE_FORMAT))
 	f.date = &t
 	f.isExistOrCreateFileDir()
 
-	fullFileName := filepath.Join(f.fileDir, f.fileName+".log")
-	file, err := os.OpenFile(fullFileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	file, err := os.OpenFile(f.currentFile(), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
 	f.logFile = file
-	f.lg = log.New(f.logFile, prefix, log.LstdFlags|log.Lmicroseconds)
+	if info, err := file.Stat(); err == nil {
+		f.size = info.Size()
+	}
+	f.outputs = []*Output{{Name: OUTPUT_FILE, Level: DEBUG, Encoder: &TextEncoder{Prefix: prefix}, Writer: f}}
 
 	go f.logWriter()
 	go f.fileMonitor()
@@ -85,14 +123,46 @@ func Init(fileDir, fileName, prefix, level string) error {
 // 关闭文件，关闭通道，为了停止一个不断循环的 goroutine
 // 由于初始化函数可以会被调用多次，以实现配置的变更，如果不先关闭结束旧的goroutine
 // 那同样功能的goroutine 将不止一个在同时运行
+// 关闭前等待通道中剩余的日志写入文件
 func CloseLogger() {
-	if fileLogger != nil {
-		fileLogger.stopTickerChan <- true
-		close(fileLogger.stopTickerChan)
-		close(fileLogger.logChan)
-		fileLogger.lg = nil
-		fileLogger.logFile.Close()
+	if fileLogger == nil {
+		return
+	}
+	fileLogger.chanL.Lock()
+	if fileLogger.closed {
+		fileLogger.chanL.Unlock()
+		return
 	}
+	fileLogger.closed = true
+	fileLogger.stopTickerChan <- true
+	close(fileLogger.stopTickerChan)
+	close(fileLogger.logChan)
+	fileLogger.chanL.Unlock()
+
+	<-fileLogger.writerDone
+	fileLogger.syncOutputs()
+	fileLogger.mu.Lock()
+	fileLogger.logFile.Close()
+	fileLogger.mu.Unlock()
+}
+
+//设置日志文件格式: text 或 json
+func SetFormat(format string) error {
+	encoder, err := NewEncoder(format, fileLogger.prefix)
+	if err != nil {
+		return err
+	}
+	fileLogger.outL.Lock()
+	defer fileLogger.outL.Unlock()
+	outputs := make([]*Output, len(fileLogger.outputs))
+	for i, o := range fileLogger.outputs {
+		if o.Name == OUTPUT_FILE {
+			o = &Output{Name: o.Name, Level: o.Level, Encoder: encoder, Writer: o.Writer}
+		}
+		outputs[i] = o
+	}
+	fileLogger.outputs = outputs
+	return nil
 }
 
 //判断日志目录是否存在，不存在则创建
@@ -103,18 +173,21 @@ func (this *FileLogger) isExistOrCreateFileDir() {
 	}
 }
 
-// 将日志消息写入文件
+// 将日志消息写入各输出
 func (this *FileLogger) logWriter() {
 	defer func() { recover() }()
+	defer close(this.writerDone)
 
 	for {
-		str, ok := <-this.logChan
+		e, ok := <-this.logChan
 		if !ok {
 			return
 		}
-		this.mu.RLock()
-		this.lg.Output(2, str)
-		this.mu.RUnlock()
+		if e.synced != nil {
+			e.synced <- this.syncOutputs()
+			continue
+		}
+		this.write(e)
 	}
 }
 
@@ -133,74 +206,79 @@ func (this *FileLogger) fileMonitor() {
 					Error("Log split error: %v\n", err.Error())
 				}
 			}
+			this.reportDropped()
+		case <-this.stopTickerChan:
+			return
 		}
 	}
 }
 
+//通道写满丢弃日志时定期记录丢弃条数
+func (this *FileLogger) reportDropped() {
+	dropped := atomic.LoadUint64(&this.dropped)
+	if dropped > this.lastDropped {
+		Warn("日志通道已满，%d 条日志被丢弃，累计 %d 条\n", dropped-this.lastDropped, dropped)
+		this.lastDropped = dropped
+	}
+}
+
 // 判断文件是否需要分割
 func (this *FileLogger) isMustSplit() bool {
 	t, _ := time.Parse(DATE_FORMAT, time.Now().Format(DATE_FORMAT))
 	return t.After(*this.date)
 }
 
-//日志分割
+//日志分割，按日期或大小切割后异步压缩及清理历史日志
 func (this *FileLogger) split() error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
-	logFile := filepath.Join(this.fileDir, this.fileName)
+	logFile := this.currentFile()
 	//日志备份
-	logFileBak := logFile + "-" + this.date.Format(DATE_FORMAT) + ".log"
+	logFileBak := this.backupFile()
 	if this.logFile != nil {
 		this.logFile.Close()
 	}
 
-	err := os.Rename(logFile, logFileBak)
-	if err != nil {
-		return err
-	}
+	renameErr := os.Rename(logFile, logFileBak)
 
 	t, _ := time.Parse(DATE_FORMAT, time.Now().Format(DATE_FORMAT))
 	this.date = &t
-	this.logFile, err = os.OpenFile(logFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	file, err := os.OpenFile(logFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
-	this.lg = log.New(this.logFile, this.prefix, log.LstdFlags|log.Lmicroseconds)
+	this.logFile = file
+	atomic.StoreInt64(&this.size, 0)
+	if info, err := file.Stat(); err == nil {
+		atomic.StoreInt64(&this.size, info.Size())
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	go this.archive()
 	return nil
 }
 
 func Info(format string, v ...interface{}) {
-	//_, file, line, _ := runtime.Caller(1)
-	if fileLogger.logLevel <= INFO {
-		//fileLogger.logChan <- fmt.Sprintf("[%v:%v]", filepath.Base(file), line) + fmt.Sprintf("[INFO]"+format, v...)
-		fileLogger.logChan <- fmt.Sprintf("[INFO]"+format, v...)
-		fmt.Println(fmt.Sprintf("[INFO]"+format, v...))
-	}
+	(&Entry{}).log(INFO, format, v...)
 }
 
 func Error(format string, v ...interface{}) {
-	//_, file, line, _ := runtime.Caller(1)
-	if fileLogger.logLevel <= ERROR {
-		//文件行号+日志级别
-		//fileLogger.logChan <- fmt.Sprintf("[%v:%v]", filepath.Base(file), line) + fmt.Sprintf("[INFO]"+format, v...)
-		fileLogger.logChan <- fmt.Sprintf("[INFO]"+format, v...)
-	}
+	(&Entry{}).log(ERROR, format, v...)
 }
 
 func Debug(format string, v ...interface{}) {
-	if fileLogger.logLevel <= DEBUG {
-		fmt.Printf("[DEBUG]"+format, v...)
-	}
+	(&Entry{}).log(DEBUG, format, v...)
 }
 
 func Warn(format string, v ...interface{}) {
-	if fileLogger.logLevel <= WARN {
-		fileLogger.logChan <- fmt.Sprintf("[WARN]"+format, v...)
-	}
+	(&Entry{}).log(WARN, format, v...)
 }
 
-//初始化日志
+//初始化日志，同时输出到文件及控制台
 func InitLog() {
 	Init("logs", "wisp", "[Wisp] –– ", "info")
+	AddOutput(&Output{Name: OUTPUT_STDOUT, Level: DEBUG, Encoder: &TextEncoder{Prefix: fileLogger.prefix}, Writer: os.Stdout})
 }
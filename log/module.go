@@ -0,0 +1,114 @@
+package log
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+//未单独设置等级的模块沿用全局等级
+const inheritLevel = -1
+
+//模块日志，各模块可独立设置日志等级，如 ws、exchange、server、middleware
+type Logger struct {
+	name  string
+	level int32
+}
+
+var (
+	loggers  = make(map[string]*Logger)
+	loggersL sync.Mutex
+)
+
+//获取模块日志，同名模块返回同一对象
+func Named(name string) *Logger {
+	loggersL.Lock()
+	defer loggersL.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := &Logger{name: name, level: inheritLevel}
+	loggers[name] = l
+	return l
+}
+
+func (this *Logger) Name() string {
+	return this.name
+}
+
+//模块当前生效的日志等级
+func (this *Logger) Level() LEVEL {
+	if level := atomic.LoadInt32(&this.level); level != inheritLevel {
+		return LEVEL(level)
+	}
+	return rootLevel()
+}
+
+func (this *Logger) SetLevel(level LEVEL) {
+	atomic.StoreInt32(&this.level, int32(level))
+}
+
+//恢复沿用全局等级
+func (this *Logger) ResetLevel() {
+	atomic.StoreInt32(&this.level, inheritLevel)
+}
+
+func (this *Logger) WithFields(fields Fields) *Entry {
+	return (&Entry{logger: this}).WithFields(fields)
+}
+
+func (this *Logger) WithField(key string, value interface{}) *Entry {
+	return this.WithFields(Fields{key: value})
+}
+
+func (this *Logger) Debug(format string, v ...interface{}) {
+	(&Entry{logger: this}).log(DEBUG, format, v...)
+}
+
+func (this *Logger) Info(format string, v ...interface{}) {
+	(&Entry{logger: this}).log(INFO, format, v...)
+}
+
+func (this *Logger) Warn(format string, v ...interface{}) {
+	(&Entry{logger: this}).log(WARN, format, v...)
+}
+
+func (this *Logger) Error(format string, v ...interface{}) {
+	(&Entry{logger: this}).log(ERROR, format, v...)
+}
+
+//全局日志等级
+func rootLevel() LEVEL {
+	if fileLogger == nil {
+		return INFO
+	}
+	return LEVEL(atomic.LoadInt32(&fileLogger.logLevel))
+}
+
+//设置日志等级，module为空时设置全局等级
+func SetLevel(module string, level LEVEL) {
+	if module != "" {
+		Named(module).SetLevel(level)
+		return
+	}
+	if fileLogger != nil {
+		atomic.StoreInt32(&fileLogger.logLevel, int32(level))
+	}
+}
+
+//全局及各模块当前生效的日志等级，全局等级的键为空字符串
+func Levels() map[string]string {
+	loggersL.Lock()
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	loggersL.Unlock()
+	sort.Strings(names)
+
+	levels := map[string]string{"": rootLevel().String()}
+	for _, name := range names {
+		levels[name] = Named(name).Level().String()
+	}
+	return levels
+}
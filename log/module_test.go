@@ -0,0 +1,78 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//替换全局日志为已关闭的日志，只用于读取等级，输出直接丢弃
+func withTestLogger(level LEVEL) func() {
+	old := fileLogger
+	fileLogger = &FileLogger{logLevel: int32(level), closed: true}
+	return func() { fileLogger = old }
+}
+
+func TestLoggerLevel(t *testing.T) {
+	defer withTestLogger(INFO)()
+
+	tests := []struct {
+		name  string
+		apply func(l *Logger)
+		root  LEVEL
+		want  LEVEL
+	}{
+		{"inherit", func(l *Logger) {}, INFO, INFO},
+		{"inherit root change", func(l *Logger) {}, ERROR, ERROR},
+		{"own level", func(l *Logger) { l.SetLevel(DEBUG) }, ERROR, DEBUG},
+		{"reset", func(l *Logger) { l.SetLevel(DEBUG); l.ResetLevel() }, WARN, WARN},
+		{"SetLevel by name", func(l *Logger) { SetLevel(l.Name(), WARN) }, DEBUG, WARN},
+	}
+	for _, tt := range tests {
+		l := Named("test." + tt.name)
+		tt.apply(l)
+		SetLevel("", tt.root)
+		if got := l.Level(); got != tt.want {
+			t.Errorf("%s: Level = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if Named("test.inherit") != Named("test.inherit") {
+		t.Error("Named returned a new logger for the same name")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	defer withTestLogger(INFO)()
+	Named("test.handler").SetLevel(ERROR)
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+		wantRoot   LEVEL
+		wantModule LEVEL
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, INFO, ERROR},
+		{"root", http.MethodPost, "level=warn", http.StatusOK, WARN, ERROR},
+		{"module", http.MethodPost, "module=test.handler&level=debug", http.StatusOK, WARN, DEBUG},
+		{"inherit", http.MethodPut, "module=test.handler&level=inherit", http.StatusOK, WARN, WARN},
+		{"root inherit", http.MethodPost, "level=inherit", http.StatusBadRequest, WARN, WARN},
+		{"unknown level", http.MethodPost, "module=test.handler&level=loud", http.StatusBadRequest, WARN, WARN},
+		{"method", http.MethodDelete, "level=debug", http.StatusMethodNotAllowed, WARN, WARN},
+	}
+	handler := LevelHandler()
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(tt.method, "/admin/log/level?"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+		if got := rootLevel(); got != tt.wantRoot {
+			t.Errorf("%s: root level = %v, want %v", tt.name, got, tt.wantRoot)
+		}
+		if got := Named("test.handler").Level(); got != tt.wantModule {
+			t.Errorf("%s: module level = %v, want %v", tt.name, got, tt.wantModule)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	OUTPUT_FILE   = "file"
+	OUTPUT_STDOUT = "stdout"
+	OUTPUT_STDERR = "stderr"
+	OUTPUT_SYSLOG = "syslog"
+)
+
+//日志输出目标，各输出有独立的等级及格式
+type Output struct {
+	Name    string    //输出名称，同名输出会被替换
+	Level   LEVEL     //输出的最低日志等级
+	Encoder Encoder   //日志编码器
+	Writer  io.Writer //写入目标
+}
+
+//需要日志等级的写入目标，如syslog按等级设置优先级
+type LevelWriter interface {
+	WriteLevel(level LEVEL, p []byte) (int, error)
+}
+
+//需要刷盘的写入目标，Sync 及关闭日志时调用
+type Syncer interface {
+	Sync() error
+}
+
+//添加或替换日志输出
+func AddOutput(out *Output) {
+	if out.Encoder == nil {
+		out.Encoder = &TextEncoder{Prefix: fileLogger.prefix}
+	}
+	fileLogger.outL.Lock()
+	defer fileLogger.outL.Unlock()
+	outputs := make([]*Output, 0, len(fileLogger.outputs)+1)
+	for _, o := range fileLogger.outputs {
+		if o.Name != out.Name {
+			outputs = append(outputs, o)
+		}
+	}
+	fileLogger.outputs = append(outputs, out)
+}
+
+//移除日志输出，写入目标实现 io.Closer 时一并关闭，文件输出除外
+func RemoveOutput(name string) {
+	fileLogger.outL.Lock()
+	defer fileLogger.outL.Unlock()
+	outputs := make([]*Output, 0, len(fileLogger.outputs))
+	for _, o := range fileLogger.outputs {
+		if o.Name != name {
+			outputs = append(outputs, o)
+			continue
+		}
+		if c, ok := o.Writer.(io.Closer); ok && o.Writer != io.Writer(fileLogger) {
+			c.Close()
+		}
+	}
+	fileLogger.outputs = outputs
+}
+
+//当前的日志输出名称
+func Outputs() []string {
+	fileLogger.outL.RLock()
+	defer fileLogger.outL.RUnlock()
+	names := make([]string, 0, len(fileLogger.outputs))
+	for _, o := range fileLogger.outputs {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+//按名称创建内置输出: file、stdout、stderr、syslog 或 syslog://网络地址，如 syslog://udp/127.0.0.1:514
+func NewOutput(name, level, format string) (*Output, error) {
+	lv, ok := levelByName(level)
+	if !ok && level != "" {
+		return nil, fmt.Errorf("未知的日志等级: %s", level)
+	}
+	if level == "" {
+		lv = DEBUG
+	}
+
+	prefix := fileLogger.prefix
+	var writer io.Writer
+	switch {
+	case name == OUTPUT_FILE:
+		writer = fileLogger
+	case name == OUTPUT_STDOUT:
+		writer = os.Stdout
+	case name == OUTPUT_STDERR:
+		writer = os.Stderr
+	case name == OUTPUT_SYSLOG || strings.HasPrefix(name, OUTPUT_SYSLOG+"://"):
+		network, addr := "", ""
+		if target := strings.TrimPrefix(name, OUTPUT_SYSLOG+"://"); target != name {
+			parts := strings.SplitN(target, "/", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("syslog地址格式错误: %s", name)
+			}
+			network, addr = parts[0], parts[1]
+		}
+		w, err := DialSyslog(network, addr, fileLogger.fileName)
+		if err != nil {
+			return nil, err
+		}
+		//syslog自带时间戳，文本格式不再输出前缀
+		writer, prefix = w, ""
+	default:
+		return nil, fmt.Errorf("未知的日志输出: %s", name)
+	}
+
+	encoder, err := NewEncoder(format, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{Name: name, Level: lv, Encoder: encoder, Writer: writer}, nil
+}
+
+//写入日志文件，超出大小时先切割
+func (this *FileLogger) Write(p []byte) (int, error) {
+	if this.isOverSize(len(p)) {
+		if err := this.split(); err != nil {
+			fmt.Fprintf(os.Stderr, "Log split error: %v\n", err)
+		}
+	}
+	this.mu.RLock()
+	n, err := this.logFile.Write(p)
+	this.mu.RUnlock()
+	atomic.AddInt64(&this.size, int64(n))
+	return n, err
+}
+
+func (this *FileLogger) Sync() error {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.logFile.Sync()
+}
+
+//将日志写入所有等级满足的输出，写入失败输出到标准错误
+func (this *FileLogger) write(e *Entry) {
+	this.outL.RLock()
+	outputs := this.outputs
+	this.outL.RUnlock()
+
+	for _, out := range outputs {
+		if e.Level < out.Level {
+			continue
+		}
+		line := out.Encoder.Encode(e)
+		var err error
+		if lw, ok := out.Writer.(LevelWriter); ok {
+			_, err = lw.WriteLevel(e.Level, line)
+		} else {
+			_, err = out.Writer.Write(line)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Log output %s error: %v\n", out.Name, err)
+		}
+	}
+	this.fireHooks(e)
+}
+
+//同步所有支持刷盘的输出，返回第一个错误
+func (this *FileLogger) syncOutputs() error {
+	this.outL.RLock()
+	outputs := this.outputs
+	this.outL.RUnlock()
+
+	var first error
+	for _, out := range outputs {
+		//终端不支持刷盘
+		if out.Writer == io.Writer(os.Stdout) || out.Writer == io.Writer(os.Stderr) {
+			continue
+		}
+		if s, ok := out.Writer.(Syncer); ok {
+			if err := s.Sync(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
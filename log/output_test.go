@@ -0,0 +1,147 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//记录写入等级的输出
+type levelBuffer struct {
+	bytes.Buffer
+	levels []LEVEL
+}
+
+func (this *levelBuffer) WriteLevel(level LEVEL, p []byte) (int, error) {
+	this.levels = append(this.levels, level)
+	return this.Write(p)
+}
+
+func TestWriteOutputs(t *testing.T) {
+	entries := []*Entry{
+		{Time: testTime, Level: DEBUG, Message: "d"},
+		{Time: testTime, Level: INFO, Message: "i"},
+		{Time: testTime, Level: WARN, Message: "w"},
+		{Time: testTime, Level: ERROR, Message: "e"},
+	}
+	tests := []struct {
+		name  string
+		level LEVEL
+		want  string
+	}{
+		{"debug", DEBUG, "[DEBUG]d [INFO]i [WARN]w [ERROR]e"},
+		{"warn", WARN, "[WARN]w [ERROR]e"},
+		{"error", ERROR, "[ERROR]e"},
+	}
+	for _, tt := range tests {
+		plain := new(bytes.Buffer)
+		leveled := new(levelBuffer)
+		f := &FileLogger{outputs: []*Output{
+			{Name: "plain", Level: tt.level, Encoder: &TextEncoder{}, Writer: plain},
+			{Name: "leveled", Level: tt.level, Encoder: &TextEncoder{}, Writer: leveled},
+		}}
+		for _, e := range entries {
+			f.write(e)
+		}
+		got := strings.Fields(strings.Replace(plain.String(), "2020/01/02 03:04:05.000006 ", "", -1))
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: written = %q, want %q", tt.name, got, tt.want)
+		}
+		if plain.String() != leveled.String() {
+			t.Errorf("%s: level writer got %q", tt.name, leveled.String())
+		}
+		if len(leveled.levels) != len(got) || leveled.levels[0] != tt.level {
+			t.Errorf("%s: levels = %v", tt.name, leveled.levels)
+		}
+	}
+}
+
+func TestNewOutput(t *testing.T) {
+	defer withTestLogger(INFO)()
+	fileLogger.prefix = "[p] "
+
+	tests := []struct {
+		name, level, format string
+		want                *Output
+		wantErr             bool
+	}{
+		{"stdout", "", "", &Output{Name: "stdout", Level: DEBUG, Encoder: &TextEncoder{Prefix: "[p] "}, Writer: os.Stdout}, false},
+		{"stderr", "warn", "json", &Output{Name: "stderr", Level: WARN, Encoder: &JSONEncoder{}, Writer: os.Stderr}, false},
+		{"file", "error", "text", &Output{Name: "file", Level: ERROR, Encoder: &TextEncoder{Prefix: "[p] "}, Writer: fileLogger}, false},
+		{"stdout", "loud", "", nil, true},
+		{"stdout", "", "xml", nil, true},
+		{"kafka", "", "", nil, true},
+		{"syslog://udp", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := NewOutput(tt.name, tt.level, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewOutput(%q, %q, %q) err = %v, wantErr %v", tt.name, tt.level, tt.format, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewOutput(%q, %q, %q) = %+v, want %+v", tt.name, tt.level, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []LEVEL
+		want   []string
+	}{
+		{"default error", nil, []string{"e"}},
+		{"warn and error", []LEVEL{WARN, ERROR}, []string{"w", "e"}},
+		{"debug only", []LEVEL{DEBUG}, []string{"d"}},
+	}
+	for _, tt := range tests {
+		var fired []string
+		hook := NewFuncHook(func(e *Entry) error {
+			fired = append(fired, e.Message)
+			return errors.New("ignored")
+		}, tt.levels...)
+		f := &FileLogger{hooks: []Hook{hook}}
+		for _, e := range []*Entry{{Level: DEBUG, Message: "d"}, {Level: INFO, Message: "i"}, {Level: WARN, Message: "w"}, {Level: ERROR, Message: "e"}} {
+			f.write(e)
+		}
+		if !reflect.DeepEqual(fired, tt.want) {
+			t.Errorf("%s: fired = %v, want %v", tt.name, fired, tt.want)
+		}
+	}
+}
+
+func TestAlertHook(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("alert body %q: %v", body, err)
+		}
+		received <- data
+	}))
+	defer srv.Close()
+
+	hook := NewAlertHook(srv.URL)
+	if err := hook.Fire(&Entry{Time: testTime, Level: ERROR, Module: "ws", Message: "断开", Fields: Fields{"conn_id": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if data["msg"] != "断开" || data["module"] != "ws" || data["level"] != "ERROR" || data["conn_id"] != float64(1) {
+			t.Errorf("alert = %v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("alert not sent")
+	}
+	close(hook.queue)
+}
@@ -0,0 +1,98 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+//日志通道写满时的处理策略
+type OverflowPolicy byte
+
+const (
+	OVERFLOW_BLOCK       OverflowPolicy = iota //阻塞调用方直至通道有空位
+	OVERFLOW_DROP_NEWEST                       //丢弃当前日志
+	OVERFLOW_DROP_OLDEST                       //丢弃通道中最早的日志
+)
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "", "block":
+		return OVERFLOW_BLOCK, nil
+	case "drop-newest":
+		return OVERFLOW_DROP_NEWEST, nil
+	case "drop-oldest":
+		return OVERFLOW_DROP_OLDEST, nil
+	default:
+		return OVERFLOW_BLOCK, fmt.Errorf("未知的日志通道溢出策略: %s", policy)
+	}
+}
+
+//设置日志通道写满时的处理策略，默认阻塞
+func SetOverflowPolicy(policy OverflowPolicy) {
+	fileLogger.chanL.Lock()
+	fileLogger.overflow = policy
+	fileLogger.chanL.Unlock()
+}
+
+//因通道写满而丢弃的日志条数
+func Dropped() uint64 {
+	if fileLogger == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&fileLogger.dropped)
+}
+
+//等待通道中已有的日志写入文件并同步到磁盘
+func Sync() error {
+	if fileLogger == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	fileLogger.chanL.RLock()
+	if fileLogger.closed {
+		fileLogger.chanL.RUnlock()
+		return nil
+	}
+	fileLogger.logChan <- &Entry{synced: done}
+	fileLogger.chanL.RUnlock()
+	return <-done
+}
+
+//按溢出策略将日志放入通道，日志关闭后直接丢弃
+func (this *FileLogger) enqueue(e *Entry) {
+	this.chanL.RLock()
+	defer this.chanL.RUnlock()
+	if this.closed {
+		return
+	}
+
+	switch this.overflow {
+	case OVERFLOW_DROP_NEWEST:
+		select {
+		case this.logChan <- e:
+		default:
+			atomic.AddUint64(&this.dropped, 1)
+		}
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case this.logChan <- e:
+				return
+			default:
+			}
+			select {
+			case old := <-this.logChan:
+				if old.synced != nil {
+					//同步标记不能丢弃，放回后重试
+					this.logChan <- old
+					continue
+				}
+				atomic.AddUint64(&this.dropped, 1)
+			default:
+			}
+		}
+	default:
+		this.logChan <- e
+	}
+}
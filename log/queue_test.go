@@ -0,0 +1,114 @@
+package log
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    OverflowPolicy
+		wantErr bool
+	}{
+		{"", OVERFLOW_BLOCK, false},
+		{"block", OVERFLOW_BLOCK, false},
+		{"drop-newest", OVERFLOW_DROP_NEWEST, false},
+		{"Drop-Oldest", OVERFLOW_DROP_OLDEST, false},
+		{"drop", OVERFLOW_BLOCK, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOverflowPolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseOverflowPolicy(%q) = %v, %v, want %v, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+//通道中的日志，同步标记记为 sync
+func drain(ch chan *Entry) []string {
+	var msgs []string
+	for {
+		select {
+		case e := <-ch:
+			if e.synced != nil {
+				msgs = append(msgs, "sync")
+			} else {
+				msgs = append(msgs, e.Message)
+			}
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestEnqueueOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      OverflowPolicy
+		queued      []string //通道中已有的日志
+		send        []string
+		want        []string
+		wantDropped uint64
+	}{
+		{"room left", OVERFLOW_DROP_NEWEST, nil, []string{"1", "2"}, []string{"1", "2"}, 0},
+		{"drop newest", OVERFLOW_DROP_NEWEST, nil, []string{"1", "2", "3", "4"}, []string{"1", "2"}, 2},
+		{"drop oldest", OVERFLOW_DROP_OLDEST, nil, []string{"1", "2", "3", "4"}, []string{"3", "4"}, 2},
+		{"keep sync marker", OVERFLOW_DROP_OLDEST, []string{"sync", "1"}, []string{"2"}, []string{"sync", "2"}, 1},
+		{"sync marker requeued", OVERFLOW_DROP_OLDEST, []string{"1", "sync"}, []string{"2", "3"}, []string{"sync", "3"}, 2},
+	}
+	for _, tt := range tests {
+		f := &FileLogger{logChan: make(chan *Entry, 2), overflow: tt.policy}
+		for _, msg := range tt.queued {
+			if msg == "sync" {
+				f.logChan <- &Entry{synced: make(chan error, 1)}
+			} else {
+				f.logChan <- &Entry{Message: msg}
+			}
+		}
+		for _, msg := range tt.send {
+			f.enqueue(&Entry{Message: msg})
+		}
+		if got := drain(f.logChan); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: queued = %v, want %v", tt.name, got, tt.want)
+		}
+		if f.dropped != tt.wantDropped {
+			t.Errorf("%s: dropped = %d, want %d", tt.name, f.dropped, tt.wantDropped)
+		}
+	}
+}
+
+func TestEnqueueBlock(t *testing.T) {
+	f := &FileLogger{logChan: make(chan *Entry, 1), overflow: OVERFLOW_BLOCK}
+	f.enqueue(&Entry{Message: "1"})
+	done := make(chan struct{})
+	go func() {
+		f.enqueue(&Entry{Message: "2"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("enqueue returned while the channel was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if e := <-f.logChan; e.Message != "1" {
+		t.Errorf("first = %q", e.Message)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue still blocked")
+	}
+	if got := drain(f.logChan); !reflect.DeepEqual(got, []string{"2"}) || f.dropped != 0 {
+		t.Errorf("queued = %v dropped = %d", got, f.dropped)
+	}
+}
+
+func TestEnqueueClosed(t *testing.T) {
+	f := &FileLogger{logChan: make(chan *Entry, 1), closed: true}
+	f.enqueue(&Entry{Message: "1"})
+	if got := drain(f.logChan); got != nil {
+		t.Errorf("queued = %v after close", got)
+	}
+}
@@ -0,0 +1,176 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//日志切割及保留策略，为0的项不生效
+type RotateOptions struct {
+	MaxSize    int64         //单个日志文件最大字节数，超出后切割
+	MaxBackups int           //最多保留的历史日志文件数
+	MaxAge     time.Duration //历史日志文件最长保留时间
+	Compress   bool          //是否gzip压缩历史日志文件
+}
+
+//设置日志切割及保留策略
+func SetRotate(opts RotateOptions) {
+	fileLogger.mu.Lock()
+	fileLogger.rotate = opts
+	fileLogger.mu.Unlock()
+}
+
+//当前日志文件路径
+func (this *FileLogger) currentFile() string {
+	return filepath.Join(this.fileDir, this.fileName+".log")
+}
+
+//写入后是否超出大小限制
+func (this *FileLogger) isOverSize(n int) bool {
+	this.mu.RLock()
+	maxSize := this.rotate.MaxSize
+	this.mu.RUnlock()
+	return maxSize > 0 && atomic.LoadInt64(&this.size)+int64(n) > maxSize
+}
+
+//历史日志文件名: wisp-2006-01-02.log，同一天多次切割时为 wisp-2006-01-02.1.log、wisp-2006-01-02.2.log ...
+func (this *FileLogger) backupFile() string {
+	base := filepath.Join(this.fileDir, this.fileName+"-"+this.date.Format(DATE_FORMAT))
+	for i := 0; ; i++ {
+		name := base + ".log"
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d.log", base, i)
+		}
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+//串行执行压缩及清理，避免清理删除正在压缩的文件
+var archiveL sync.Mutex
+
+type backup struct {
+	name    string
+	modTime time.Time
+}
+
+//压缩所有未压缩的历史日志，并清理超出保留策略的文件
+func (this *FileLogger) archive() {
+	archiveL.Lock()
+	defer archiveL.Unlock()
+
+	this.mu.RLock()
+	opts := this.rotate
+	this.mu.RUnlock()
+
+	if opts.Compress {
+		backups, err := this.backups()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "历史日志读取失败: %v\n", err)
+			return
+		}
+		for _, b := range backups {
+			if !strings.HasSuffix(b.name, ".log") {
+				continue
+			}
+			if err := gzipFile(b.name); err != nil {
+				fmt.Fprintf(os.Stderr, "日志压缩失败: %v\n", err)
+			}
+		}
+	}
+	if err := this.cleanBackups(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "历史日志清理失败: %v\n", err)
+	}
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	//保留原文件修改时间，保证按时间清理的顺序
+	if info, err := src.Stat(); err == nil {
+		os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+//历史日志文件，按修改时间从新到旧排序
+func (this *FileLogger) backups() ([]backup, error) {
+	matches, err := filepath.Glob(filepath.Join(this.fileDir, this.fileName+"-*"))
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, name := range matches {
+		if !strings.HasSuffix(name, ".log") && !strings.HasSuffix(name, ".log.gz") {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name, info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+//保留最新的 MaxBackups 个文件，并删除超过 MaxAge 的文件
+func (this *FileLogger) cleanBackups(opts RotateOptions) error {
+	if opts.MaxBackups <= 0 && opts.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := this.backups()
+	if err != nil {
+		return err
+	}
+	for i, b := range backups {
+		expired := opts.MaxAge > 0 && time.Since(b.modTime) > opts.MaxAge
+		if (opts.MaxBackups > 0 && i >= opts.MaxBackups) || expired {
+			if err := os.Remove(b.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//在临时目录中创建日志，日期与Init一致取当天，不启动写入协程
+func newTestFileLogger(t *testing.T, opts RotateOptions) (*FileLogger, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "wisp-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, _ := time.Parse(DATE_FORMAT, time.Now().Format(DATE_FORMAT))
+	f := &FileLogger{fileDir: dir, fileName: "wisp", date: &date, mu: new(sync.RWMutex), rotate: opts}
+	if f.logFile, err = os.OpenFile(f.currentFile(), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return f, dir
+}
+
+func touch(t *testing.T, dir, name string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBackupFile(t *testing.T) {
+	today := time.Now().Format(DATE_FORMAT)
+	yesterday := time.Now().AddDate(0, 0, -1).Format(DATE_FORMAT)
+	tests := []struct {
+		name     string
+		existing []string
+		want     string
+	}{
+		{"first", nil, "wisp-" + today + ".log"},
+		{"second", []string{"wisp-" + today + ".log"}, "wisp-" + today + ".1.log"},
+		{"compressed", []string{"wisp-" + today + ".log.gz", "wisp-" + today + ".1.log.gz"}, "wisp-" + today + ".2.log"},
+		{"gap", []string{"wisp-" + today + ".log", "wisp-" + today + ".2.log"}, "wisp-" + today + ".1.log"},
+		{"other day", []string{"wisp-" + yesterday + ".log", "wisp-" + yesterday + ".1.log"}, "wisp-" + today + ".log"},
+	}
+	for _, tt := range tests {
+		f, dir := newTestFileLogger(t, RotateOptions{})
+		for _, name := range tt.existing {
+			touch(t, dir, name, time.Now())
+		}
+		if got := filepath.Base(f.backupFile()); got != tt.want {
+			t.Errorf("%s: backupFile = %q, want %q", tt.name, got, tt.want)
+		}
+		f.logFile.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCleanBackups(t *testing.T) {
+	now := time.Now()
+	files := map[string]time.Time{
+		"wisp-2020-01-01.log.gz":   now.Add(-72 * time.Hour),
+		"wisp-2020-01-02.log.gz":   now.Add(-48 * time.Hour),
+		"wisp-2020-01-03.log":      now.Add(-2 * time.Hour),
+		"wisp-2020-01-03.1.log.gz": now.Add(-time.Hour),
+		"wisp-notes.txt":           now.Add(-96 * time.Hour),
+	}
+	tests := []struct {
+		name string
+		opts RotateOptions
+		want []string
+	}{
+		{"unlimited", RotateOptions{}, []string{"wisp-2020-01-01.log.gz", "wisp-2020-01-02.log.gz", "wisp-2020-01-03.1.log.gz", "wisp-2020-01-03.log", "wisp-notes.txt", "wisp.log"}},
+		{"max backups", RotateOptions{MaxBackups: 2}, []string{"wisp-2020-01-03.1.log.gz", "wisp-2020-01-03.log", "wisp-notes.txt", "wisp.log"}},
+		{"max age", RotateOptions{MaxAge: 24 * time.Hour}, []string{"wisp-2020-01-03.1.log.gz", "wisp-2020-01-03.log", "wisp-notes.txt", "wisp.log"}},
+		{"both", RotateOptions{MaxBackups: 3, MaxAge: 90 * time.Minute}, []string{"wisp-2020-01-03.1.log.gz", "wisp-notes.txt", "wisp.log"}},
+	}
+	for _, tt := range tests {
+		f, dir := newTestFileLogger(t, tt.opts)
+		for name, modTime := range files {
+			touch(t, dir, name, modTime)
+		}
+		if err := f.cleanBackups(tt.opts); err != nil {
+			t.Errorf("%s: cleanBackups = %v", tt.name, err)
+		}
+		if got := listDir(t, dir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: files = %v, want %v", tt.name, got, tt.want)
+		}
+		f.logFile.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	today := time.Now().Format(DATE_FORMAT)
+	tests := []struct {
+		name    string
+		maxSize int64
+		writes  int
+		want    []string
+	}{
+		{"unlimited", 0, 3, []string{"wisp.log"}},
+		{"fits", 18, 3, []string{"wisp.log"}},
+		{"one split", 12, 3, []string{"wisp-" + today + ".log", "wisp.log"}},
+		{"numbered", 6, 3, []string{"wisp-" + today + ".1.log", "wisp-" + today + ".log", "wisp.log"}},
+	}
+	for _, tt := range tests {
+		f, dir := newTestFileLogger(t, RotateOptions{MaxSize: tt.maxSize})
+		for i := 0; i < tt.writes; i++ {
+			if _, err := f.Write([]byte("12345\n")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := listDir(t, dir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: files = %v, want %v", tt.name, got, tt.want)
+		}
+		f.mu.Lock()
+		f.logFile.Close()
+		f.mu.Unlock()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisp-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	touch(t, dir, "wisp-2020-01-02.log", modTime)
+
+	name := filepath.Join(dir, "wisp-2020-01-02.log")
+	if err := gzipFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, []string{"wisp-2020-01-02.log.gz"}) {
+		t.Fatalf("files = %v", got)
+	}
+	file, err := os.Open(name + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil || string(data) != "wisp-2020-01-02.log" {
+		t.Errorf("content = %q, %v", data, err)
+	}
+	if info, _ := file.Stat(); !info.ModTime().Equal(modTime) {
+		t.Errorf("modTime = %v, want %v", info.ModTime(), modTime)
+	}
+}
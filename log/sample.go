@@ -0,0 +1,145 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+//日志采样器，按key判断本条日志是否输出，skipped为上次输出后被跳过的条数
+type Sampler interface {
+	Sample(key string) (ok bool, skipped uint64)
+}
+
+//跳过条数写入的字段名
+const FIELD_SAMPLED_SKIPPED = "sampled_skipped"
+
+//返回按采样器过滤的条目，被跳过的日志不进入通道
+func Sample(sampler Sampler, key string) *Entry {
+	return (&Entry{}).Sample(sampler, key)
+}
+
+func (this *Entry) Sample(sampler Sampler, key string) *Entry {
+	return &Entry{Fields: this.Fields, logger: this.logger, sampler: sampler, sampleKey: key}
+}
+
+func (this *Logger) Sample(sampler Sampler, key string) *Entry {
+	return (&Entry{logger: this}).Sample(sampler, key)
+}
+
+type sampleCounter struct {
+	window  time.Time //当前计数周期的开始时间，限速器为上次补充令牌的时间
+	count   uint64    //本周期内的日志条数
+	skipped uint64    //上次输出后跳过的条数
+	tokens  float64   //限速器剩余令牌
+	last    time.Time //最近一次使用的时间
+}
+
+//按key保存计数，长时间未使用的key定期清理
+type sampleCounters struct {
+	sync.Mutex
+	counters map[string]*sampleCounter
+	swept    time.Time
+}
+
+func (this *sampleCounters) get(key string, now time.Time, idle time.Duration) (*sampleCounter, bool) {
+	if this.counters == nil {
+		this.counters = make(map[string]*sampleCounter)
+		this.swept = now
+	}
+	if now.Sub(this.swept) > idle {
+		for k, c := range this.counters {
+			if now.Sub(c.last) > idle {
+				delete(this.counters, k)
+			}
+		}
+		this.swept = now
+	}
+	c, ok := this.counters[key]
+	if !ok {
+		c = &sampleCounter{window: now}
+		this.counters[key] = c
+	}
+	c.last = now
+	return c, !ok
+}
+
+//每个周期内每个key先输出前first条，之后每thereafter条输出一条
+//thereafter为0时周期内超出first的日志全部跳过
+type CountSampler struct {
+	first      uint64
+	thereafter uint64
+	interval   time.Duration
+	counters   sampleCounters
+}
+
+func NewCountSampler(first, thereafter int, interval time.Duration) *CountSampler {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &CountSampler{first: uint64(first), thereafter: uint64(thereafter), interval: interval}
+}
+
+func (this *CountSampler) Sample(key string) (bool, uint64) {
+	now := time.Now()
+	this.counters.Lock()
+	defer this.counters.Unlock()
+
+	c, _ := this.counters.get(key, now, 10*this.interval)
+	if now.Sub(c.window) >= this.interval {
+		c.window = now
+		c.count = 0
+	}
+	c.count++
+	if c.count <= this.first || (this.thereafter > 0 && (c.count-this.first)%this.thereafter == 0) {
+		skipped := c.skipped
+		c.skipped = 0
+		return true, skipped
+	}
+	c.skipped++
+	return false, 0
+}
+
+//令牌桶限速，每个key每秒最多输出rate条，允许突发burst条
+type RateSampler struct {
+	rate     float64
+	burst    float64
+	counters sampleCounters
+}
+
+func NewRateSampler(rate float64, burst int) *RateSampler {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateSampler{rate: rate, burst: float64(burst)}
+}
+
+func (this *RateSampler) Sample(key string) (bool, uint64) {
+	now := time.Now()
+	this.counters.Lock()
+	defer this.counters.Unlock()
+
+	idle := time.Minute
+	if this.rate > 0 {
+		if d := time.Duration(this.burst / this.rate * float64(time.Second)); d > idle {
+			idle = d
+		}
+	}
+	c, created := this.counters.get(key, now, idle)
+	if created {
+		c.tokens = this.burst
+	} else {
+		c.tokens += now.Sub(c.window).Seconds() * this.rate
+		if c.tokens > this.burst {
+			c.tokens = this.burst
+		}
+	}
+	c.window = now
+	if c.tokens < 1 {
+		c.skipped++
+		return false, 0
+	}
+	c.tokens--
+	skipped := c.skipped
+	c.skipped = 0
+	return true, skipped
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sampleResult struct {
+	ok      bool
+	skipped uint64
+}
+
+func sampleN(s Sampler, key string, n int) []sampleResult {
+	results := make([]sampleResult, n)
+	for i := range results {
+		results[i].ok, results[i].skipped = s.Sample(key)
+	}
+	return results
+}
+
+func TestCountSampler(t *testing.T) {
+	pass := func(skipped uint64) sampleResult { return sampleResult{true, skipped} }
+	skip := sampleResult{}
+	tests := []struct {
+		name              string
+		first, thereafter int
+		n                 int
+		want              []sampleResult
+	}{
+		{"first only", 2, 0, 5, []sampleResult{pass(0), pass(0), skip, skip, skip}},
+		{"thereafter", 2, 3, 9, []sampleResult{pass(0), pass(0), skip, skip, pass(2), skip, skip, pass(2), skip}},
+		{"every", 0, 1, 3, []sampleResult{pass(0), pass(0), pass(0)}},
+		{"none", 0, 0, 2, []sampleResult{skip, skip}},
+	}
+	for _, tt := range tests {
+		s := NewCountSampler(tt.first, tt.thereafter, time.Hour)
+		if got := sampleN(s, "binance.depth.btcusdt", tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCountSamplerKeysAndWindow(t *testing.T) {
+	s := NewCountSampler(1, 0, 50*time.Millisecond)
+	if got := sampleN(s, "a", 3); !reflect.DeepEqual(got, []sampleResult{{true, 0}, {}, {}}) {
+		t.Errorf("a = %v", got)
+	}
+	if ok, _ := s.Sample("b"); !ok {
+		t.Error("key b shares the count of key a")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ok, skipped := s.Sample("a"); !ok || skipped != 2 {
+		t.Errorf("new window = %v, %d, want true, 2", ok, skipped)
+	}
+}
+
+func TestRateSampler(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		wait  time.Duration //前n次之后等待的时间
+		n     int
+		want  []sampleResult
+	}{
+		{"burst", 0, 3, 0, 4, []sampleResult{{true, 0}, {true, 0}, {true, 0}, {}}},
+		{"min burst", 0, 0, 0, 2, []sampleResult{{true, 0}, {}}},
+		{"refill", 20, 1, 80 * time.Millisecond, 3, []sampleResult{{true, 0}, {}, {}}},
+	}
+	for _, tt := range tests {
+		s := NewRateSampler(tt.rate, tt.burst)
+		if got := sampleN(s, "publish", tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.wait > 0 {
+			time.Sleep(tt.wait)
+			if ok, skipped := s.Sample("publish"); !ok || skipped != 2 {
+				t.Errorf("%s: after refill = %v, %d, want true, 2", tt.name, ok, skipped)
+			}
+		}
+	}
+}
+
+func TestSampledEntry(t *testing.T) {
+	old := fileLogger
+	fileLogger = &FileLogger{logLevel: int32(DEBUG), logChan: make(chan *Entry, 10)}
+	defer func() { fileLogger = old }()
+
+	sampler := NewCountSampler(1, 2, time.Hour)
+	for i := 0; i < 5; i++ {
+		Sample(sampler, "binance.ticker.btcusdt").WithField("i", i).Info("ticker\n")
+	}
+	var got []Fields
+	for len(fileLogger.logChan) > 0 {
+		got = append(got, (<-fileLogger.logChan).Fields)
+	}
+	want := []Fields{{"i": 0}, {"i": 2, FIELD_SAMPLED_SKIPPED: uint64(1)}, {"i": 4, FIELD_SAMPLED_SKIPPED: uint64(1)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
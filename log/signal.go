@@ -0,0 +1,25 @@
+// +build !windows
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+//收到SIGUSR1时全局等级切换为DEBUG，收到SIGUSR2时恢复为初始化时的等级
+func HandleLevelSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			level := DEBUG
+			if sig == syscall.SIGUSR2 && fileLogger != nil {
+				level = fileLogger.initLevel
+			}
+			SetLevel("", level)
+			Warn("收到信号 %v，全局日志等级切换为 %s\n", sig, level)
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package log
+
+//windows不支持SIGUSR1/SIGUSR2，日志等级只能通过管理接口修改
+func HandleLevelSignals() {}
@@ -0,0 +1,122 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//syslog设施，wisp作为守护进程运行
+const SYSLOG_FACILITY_DAEMON = 3
+
+//本机syslog的常见套接字路径
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+//syslog输出，network为空时连接本机套接字，写入失败时重连一次
+type SyslogWriter struct {
+	sync.Mutex
+	network  string
+	addr     string
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func DialSyslog(network, addr, tag string) (*SyslogWriter, error) {
+	if tag == "" {
+		tag = "wisp"
+	}
+	hostname, _ := os.Hostname()
+	w := &SyslogWriter{network: network, addr: addr, tag: tag, hostname: hostname}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (this *SyslogWriter) connect() error {
+	if this.conn != nil {
+		this.conn.Close()
+		this.conn = nil
+	}
+	if this.network != "" {
+		conn, err := net.DialTimeout(this.network, this.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		this.conn = conn
+		return nil
+	}
+	for _, path := range syslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				this.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("未找到本机syslog服务")
+}
+
+func (this *SyslogWriter) Write(p []byte) (int, error) {
+	return this.WriteLevel(INFO, p)
+}
+
+//按日志等级设置syslog优先级
+func (this *SyslogWriter) WriteLevel(level LEVEL, p []byte) (int, error) {
+	this.Lock()
+	defer this.Unlock()
+	if this.conn != nil {
+		if n, err := this.send(level, p); err == nil {
+			return n, nil
+		}
+	}
+	if err := this.connect(); err != nil {
+		return 0, err
+	}
+	return this.send(level, p)
+}
+
+func (this *SyslogWriter) send(level LEVEL, p []byte) (int, error) {
+	pri := SYSLOG_FACILITY_DAEMON*8 + syslogSeverity(level)
+	msg := strings.TrimRight(string(p), "\n")
+	var line string
+	if this.network == "" {
+		//本机套接字不需要主机名
+		line = fmt.Sprintf("<%d>%s %s[%d]: %s\n", pri, time.Now().Format(time.Stamp), this.tag, os.Getpid(), msg)
+	} else {
+		line = fmt.Sprintf("<%d>%s %s %s[%d]: %s\n", pri, time.Now().Format(time.RFC3339), this.hostname, this.tag, os.Getpid(), msg)
+	}
+	if _, err := this.conn.Write([]byte(line)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (this *SyslogWriter) Close() error {
+	this.Lock()
+	defer this.Unlock()
+	if this.conn == nil {
+		return nil
+	}
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+func syslogSeverity(level LEVEL) int {
+	switch level {
+	case DEBUG:
+		return 7
+	case WARN:
+		return 4
+	case ERROR:
+		return 3
+	default:
+		return 6
+	}
+}
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"sort"
+	"strings"
+)
+
+// Arguments are the optional x-arguments of an exchange, queue or binding,
+// e.g. x-message-ttl, x-dead-letter-exchange, x-queue-type or x-match
+type Arguments map[string]interface{}
+
+// Table converts arguments decoded from yaml into an amqp.Table.
+// Nested maps become tables and integers are sent as 64-bit integers.
+// Arguments must be validated first, unsupported values are dropped.
+func (a Arguments) Table() amqp.Table {
+	if len(a) == 0 {
+		return nil
+	}
+	t := amqp.Table{}
+	for k, v := range a {
+		if fv, err := argValue(v); err == nil {
+			t[k] = fv
+		}
+	}
+	return t
+}
+
+func argValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, int64, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			fv, err := argValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			list[i] = fv
+		}
+		return list, nil
+	case map[interface{}]interface{}:
+		t := amqp.Table{}
+		for k, item := range v {
+			fv, err := argValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", k, err)
+			}
+			t[fmt.Sprint(k)] = fv
+		}
+		return t, nil
+	case map[string]interface{}:
+		t := amqp.Table{}
+		for k, item := range v {
+			fv, err := argValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			t[k] = fv
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v of type %T", v, v)
+	}
+}
+
+// SchemeError lists every invalid entry found in Settings
+type SchemeError struct {
+	Problems []string
+	// Warnings are entries that may be valid, e.g. bindings to exchanges
+	// declared outside of the Settings, they only fail with StrictBindings
+	Warnings []string
+}
+
+func (e *SchemeError) Error() string {
+	return "invalid scheme: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *SchemeError) add(format string, v ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, v...))
+}
+
+func (e *SchemeError) warn(format string, v ...interface{}) {
+	e.Warnings = append(e.Warnings, fmt.Sprintf(format, v...))
+}
+
+var (
+	exchangeTypes = []string{amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders}
+
+	// integer arguments that must not be negative
+	nonNegativeArgs = []string{"x-message-ttl", "x-expires", "x-max-length", "x-max-length-bytes", "x-max-priority", "x-delivery-limit"}
+
+	enumArgs = map[string][]string{
+		"x-queue-type": {"classic", "quorum", "stream"},
+		"x-queue-mode": {"default", "lazy"},
+		"x-overflow":   {"drop-head", "reject-publish", "reject-publish-dlx"},
+		"x-match":      {"all", "any"},
+	}
+
+	stringArgs = []string{"x-dead-letter-exchange", "x-dead-letter-routing-key", "alternate-exchange"}
+)
+
+// Validate checks exchange types, binding references and arguments and
+// reports every wrong entry by name. Bindings to exchanges not declared in
+// the Settings are logged as warnings, the exchange may be managed elsewhere,
+// unless StrictBindings is set.
+func (s Settings) Validate() error {
+	e := s.validate()
+	for _, w := range e.Warnings {
+		logger.Warn("消息队列配置: %s\n", w)
+	}
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (s Settings) validate() *SchemeError {
+	e := &SchemeError{}
+
+	for _, name := range sortedKeys(s.Exchanges) {
+		ex := s.Exchanges[name]
+		where := fmt.Sprintf("exchange %q", name)
+		if !contains(exchangeTypes, ex.Type) && !strings.HasPrefix(ex.Type, "x-") {
+			e.add("%s: unknown type %q", where, ex.Type)
+		}
+		validateArgs(e, where, ex.Args)
+		for i, b := range ex.Bindings {
+			s.validateBinding(e, fmt.Sprintf("%s binding %d", where, i), b)
+		}
+	}
+
+	for _, name := range sortedKeys(s.Queues) {
+		q := s.Queues[name]
+		where := fmt.Sprintf("queue %q", name)
+		validateArgs(e, where, q.Args)
+		if q.Args["x-queue-type"] == "quorum" && (!q.Durable || q.Exclusive || q.AutoDelete) {
+			e.add("%s: quorum queues must be durable, non-exclusive and not auto-deleted", where)
+		}
+		for i, b := range q.Bindings {
+			s.validateBinding(e, fmt.Sprintf("%s binding %d", where, i), b)
+		}
+	}
+	return e
+}
+
+func (s Settings) validateBinding(e *SchemeError, where string, b Binding) {
+	if b.Exchange == "" {
+		e.add("%s: exchange is not set", where)
+	} else if _, ok := s.Exchanges[b.Exchange]; !ok && !strings.HasPrefix(b.Exchange, "amq.") {
+		if s.StrictBindings {
+			e.add("%s: exchange %q is not declared", where, b.Exchange)
+		} else {
+			e.warn("%s: exchange %q is not declared, it must already exist", where, b.Exchange)
+		}
+	} else if ex, ok := s.Exchanges[b.Exchange]; ok && ex.Type == amqp.ExchangeHeaders && b.Args["x-match"] == nil {
+		e.add("%s: headers exchange %q binding requires x-match argument", where, b.Exchange)
+	}
+	validateArgs(e, where, b.Args)
+}
+
+func validateArgs(e *SchemeError, where string, args Arguments) {
+	for _, k := range sortedKeys(args) {
+		v := args[k]
+		if _, err := argValue(v); err != nil {
+			e.add("%s: args %s: %v", where, k, err)
+			continue
+		}
+		if contains(nonNegativeArgs, k) {
+			if n, ok := argInt(v); !ok || n < 0 {
+				e.add("%s: args %s must be a non-negative integer, got %v", where, k, v)
+			}
+		}
+		if contains(stringArgs, k) {
+			if _, ok := v.(string); !ok {
+				e.add("%s: args %s must be a string, got %v", where, k, v)
+			}
+		}
+		if allowed, ok := enumArgs[k]; ok {
+			if str, _ := v.(string); !contains(allowed, str) {
+				e.add("%s: args %s must be one of %s, got %v", where, k, strings.Join(allowed, "/"), v)
+			}
+		}
+	}
+}
+
+func argInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns map keys in order so problems are reported deterministically
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]Exchange:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]QueueSpec:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case Arguments:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
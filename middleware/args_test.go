@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"github.com/streadway/amqp"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgumentsTable(t *testing.T) {
+	tests := []struct {
+		name string
+		args Arguments
+		want amqp.Table
+	}{
+		{"empty", Arguments{}, nil},
+		{"nil", nil, nil},
+		{"scalars", Arguments{"x-message-ttl": 60000, "x-max-priority": int32(10), "ratio": float32(0.5), "x-queue-type": "quorum", "x-single-active-consumer": true},
+			amqp.Table{"x-message-ttl": int64(60000), "x-max-priority": int64(10), "ratio": float64(0.5), "x-queue-type": "quorum", "x-single-active-consumer": true}},
+		{"nested", Arguments{"x-match": "all", "tags": []interface{}{1, "a"}, "limits": map[interface{}]interface{}{"max": 5, 1: "one"}},
+			amqp.Table{"x-match": "all", "tags": []interface{}{int64(1), "a"}, "limits": amqp.Table{"max": int64(5), "1": "one"}}},
+		{"unsupported dropped", Arguments{"x-expires": 1000, "callback": func() {}, "list": []interface{}{struct{}{}}},
+			amqp.Table{"x-expires": int64(1000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.args.Table()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Table() = %#v, want %#v", got, tt.want)
+			}
+			if got != nil {
+				if err := got.Validate(); err != nil {
+					t.Errorf("Table() is not a valid amqp table: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		yaml         string
+		wantProblems []string
+		wantWarnings []string
+	}{
+		{"valid", `
+exchanges:
+  market: {type: topic, durable: true}
+  dead: {type: x-delayed-message, args: {x-delayed-type: direct}}
+  match: {type: headers}
+queues:
+  kline:
+    durable: true
+    args: {x-queue-type: quorum, x-message-ttl: 60000, x-dead-letter-exchange: dead}
+    bindings:
+      - {exchange: market, key: "*.*.kline.#"}
+      - {exchange: amq.topic, key: "#"}
+      - {exchange: match, args: {x-match: any, venue: binance}}
+`, nil, nil},
+		{"exchange problems", `
+exchanges:
+  market:
+    type: fanin
+    args: {alternate-exchange: 1}
+    bindings:
+      - {key: a}
+      - {exchange: match}
+  match: {type: headers}
+`, []string{
+			`exchange "market": unknown type "fanin"`,
+			`exchange "market": args alternate-exchange must be a string, got 1`,
+			`exchange "market" binding 0: exchange is not set`,
+			`exchange "market" binding 1: headers exchange "match" binding requires x-match argument`,
+		}, nil},
+		{"queue problems", `
+queues:
+  orders:
+    args: {x-queue-type: quorum, x-max-length: -1, x-overflow: drop-tail, x-expires: 1.5}
+`, []string{
+			`queue "orders": args x-expires must be a non-negative integer, got 1.5`,
+			`queue "orders": args x-max-length must be a non-negative integer, got -1`,
+			`queue "orders": args x-overflow must be one of drop-head/reject-publish/reject-publish-dlx, got drop-tail`,
+			`queue "orders": quorum queues must be durable, non-exclusive and not auto-deleted`,
+		}, nil},
+		{"undeclared exchange", `
+queues:
+  orders:
+    bindings:
+      - {exchange: orders.in, key: new}
+`, nil, []string{`queue "orders" binding 0: exchange "orders.in" is not declared, it must already exist`}},
+		{"undeclared exchange strict", `
+strict_bindings: true
+queues:
+  orders:
+    bindings:
+      - {exchange: orders.in, key: new}
+      - {exchange: amq.direct, key: new}
+`, []string{`queue "orders" binding 0: exchange "orders.in" is not declared`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := DecodeYaml(strings.NewReader(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := s.validate()
+			if !reflect.DeepEqual(e.Problems, tt.wantProblems) {
+				t.Errorf("problems = %q, want %q", e.Problems, tt.wantProblems)
+			}
+			if !reflect.DeepEqual(e.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", e.Warnings, tt.wantWarnings)
+			}
+			if err := s.Validate(); (err != nil) != (len(tt.wantProblems) > 0) {
+				t.Errorf("Validate() = %v, want %d problems", err, len(tt.wantProblems))
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/streadway/amqp"
+	"wisp/codec"
+	"wisp/common"
+)
+
+// BridgeOptions configures ConsumeMarket
+type BridgeOptions struct {
+	// Queue is the name of the transient queue, it should be unique per edge server
+	Queue string `yaml:"queue"`
+	// Keys are binding patterns on the publisher exchange, e.g. binance.*.ticker
+	Keys []string `yaml:"keys"`
+	// MaxLength caps the queue, the oldest events are dropped when a bridge falls behind
+	MaxLength int `yaml:"max_length"`
+	// Prefetch is the number of unacked events in flight
+	Prefetch int `yaml:"prefetch"`
+}
+
+// bridgeQueueExpires removes the queue of a bridge that is gone for good
+const bridgeQueueExpires = 60000
+
+// ConsumeMarket declares a transient queue bound to the publisher exchange of s
+// and passes every market event published there to f, in publishing order.
+// The queue is part of the remembered scheme, so it is declared again after
+// the connection recovers. It returns once ctx is cancelled or the connection is closed.
+func (c *Connection) ConsumeMarket(ctx context.Context, s Settings, opts BridgeOptions, f func(ev *common.MarketEvent)) error {
+	if s.Publisher.Exchange == "" {
+		return fmt.Errorf("bridge: publisher exchange is not set")
+	}
+	if opts.Queue == "" {
+		return fmt.Errorf("bridge: queue is not set")
+	}
+	if len(opts.Keys) == 0 {
+		opts.Keys = []string{"#"}
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = 10000
+	}
+
+	q := QueueSpec{
+		AutoDelete: true,
+		Args: Arguments{
+			"x-expires":    bridgeQueueExpires,
+			"x-max-length": opts.MaxLength,
+			"x-overflow":   "drop-head",
+		},
+	}
+	for _, key := range opts.Keys {
+		q.Bindings = append(q.Bindings, Binding{Exchange: s.Publisher.Exchange, Key: key})
+	}
+	scheme := Settings{
+		Exchanges: s.Exchanges,
+		Queues:    map[string]QueueSpec{opts.Queue: q},
+	}
+	if err := c.CreateScheme(scheme); err != nil {
+		return err
+	}
+
+	return c.Consume(ctx, ConsumerOptions{Queue: opts.Queue, Prefetch: opts.Prefetch, Workers: 1}, func(d amqp.Delivery) Decision {
+		ev, err := MarketEventFromDelivery(d)
+		if err != nil {
+			logger.Warn("行情消息解码失败: key=%s err=%v\n", d.RoutingKey, err.Error())
+			return Nack
+		}
+		f(ev)
+		return Ack
+	})
+}
+
+// MarketEventFromDelivery decodes an event published by MarketPublisher,
+// the codec is chosen by the content type of the delivery
+func MarketEventFromDelivery(d amqp.Delivery) (*common.MarketEvent, error) {
+	c, err := codec.ByContentType(d.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(d.Body)
+}
@@ -0,0 +1,347 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+// OutagePolicy decides what happens to messages published while the broker is unreachable
+type OutagePolicy string
+
+const (
+	// DropOnOutage discards messages published during an outage
+	DropOnOutage OutagePolicy = "drop"
+	// BufferOnOutage keeps up to Options.BufferSize messages and publishes them after reconnecting
+	BufferOnOutage OutagePolicy = "buffer"
+)
+
+var (
+	// ErrConnectionClosed is returned once Close has been called on the connection
+	ErrConnectionClosed = errors.New("middleware: connection closed")
+	// ErrNotConnected is returned while the connection is being recovered
+	ErrNotConnected = errors.New("middleware: not connected")
+	// ErrMessageDropped is returned when a message could not be published nor buffered during an outage
+	ErrMessageDropped = errors.New("middleware: broker unreachable, message dropped")
+)
+
+// Options configures connection recovery
+type Options struct {
+	OutagePolicy OutagePolicy  `yaml:"outage_policy"`
+	BufferSize   int           `yaml:"buffer_size"`
+	MinBackoff   time.Duration `yaml:"min_backoff"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+}
+
+// DefaultOptions drops messages during outages and redials between 1 and 30 seconds
+func DefaultOptions() Options {
+	return Options{
+		OutagePolicy: DropOnOutage,
+		BufferSize:   10000,
+		MinBackoff:   time.Second,
+		MaxBackoff:   30 * time.Second,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	def := DefaultOptions()
+	if o.OutagePolicy == "" {
+		o.OutagePolicy = def.OutagePolicy
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = def.BufferSize
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = def.MinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = def.MaxBackoff
+	}
+	return o
+}
+
+// amqpConnection is the part of *amqp.Connection the supervisor relies on
+type amqpConnection interface {
+	Channel() (*amqp.Channel, error)
+	IsClosed() bool
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// dialer opens a new broker connection, tests replace amqp.Dial with a fake
+type dialer func(url string) (amqpConnection, error)
+
+func dialAMQP(url string) (amqpConnection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+type pendingMessage struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// Connection is a supervised connection to RabbitMQ. When the broker closes the
+// connection it redials with exponential backoff, creates the remembered schemes
+// again and notifies registered listeners so they can recreate their channels.
+type Connection struct {
+	url        string
+	opts       Options
+	dial       dialer
+	mu         sync.RWMutex
+	c          amqpConnection
+	ready      chan struct{} // closed while c is usable
+	done       chan struct{} // closed by Close
+	closed     bool
+	schemes    []Settings
+	listeners  []func()
+	buffer     []pendingMessage
+	bufferLock sync.Mutex
+	publisher  *Publisher
+}
+
+// Connect dials RabbitMQ with default recovery options
+func Connect(url string) (*Connection, error) {
+	return ConnectWithOptions(url, DefaultOptions())
+}
+
+// ConnectWithOptions dials RabbitMQ and supervises the connection.
+// Only the first dial fails fast, later outages are recovered in background.
+func ConnectWithOptions(url string, opts Options) (*Connection, error) {
+	return connect(url, opts, dialAMQP)
+}
+
+func connect(url string, opts Options, dial dialer) (*Connection, error) {
+	conn, err := dial(url)
+	if err != nil {
+		logger.Info("消息队列连接失败:%v\n", err.Error())
+		return nil, err
+	}
+	c := &Connection{
+		url:   url,
+		opts:  opts.withDefaults(),
+		dial:  dial,
+		c:     conn,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	close(c.ready)
+	c.publisher = NewPublisher(c, DefaultPublisherOptions())
+	go c.supervise(conn)
+	return c, nil
+}
+
+// Close closes connection to RabbitMQ and stops recovery
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.c
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// NotifyReconnect registers a function called after every successful recovery
+func (c *Connection) NotifyReconnect(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, f)
+}
+
+// Channel opens a new channel on the current connection
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	conn, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Channel()
+}
+
+// openChannel opens a channel for the publisher, which only needs amqpChannel
+func (c *Connection) openChannel() (amqpChannel, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (c *Connection) current() (amqpConnection, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, ErrConnectionClosed
+	}
+	if c.c == nil {
+		return nil, ErrNotConnected
+	}
+	return c.c, nil
+}
+
+func (c *Connection) connected() bool {
+	conn, err := c.current()
+	return err == nil && !conn.IsClosed()
+}
+
+// waitChannel blocks until a channel can be opened, the connection is closed or ctx is done
+func (c *Connection) waitChannel(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		c.mu.RLock()
+		conn, ready, closed := c.c, c.ready, c.closed
+		c.mu.RUnlock()
+		if closed {
+			return nil, ErrConnectionClosed
+		}
+
+		var retry <-chan time.Time
+		if conn != nil {
+			ch, err := conn.Channel()
+			if err == nil {
+				return ch, nil
+			}
+			if !conn.IsClosed() {
+				return nil, err
+			}
+			// the supervisor has not noticed the closed connection yet
+			ready, retry = nil, time.After(100*time.Millisecond)
+		}
+
+		select {
+		case <-ready:
+		case <-retry:
+		case <-c.done:
+			return nil, ErrConnectionClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Connection) supervise(conn amqpConnection) {
+	for {
+		reason, ok := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		c.c = nil
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+		if ok {
+			logger.Info("消息队列连接断开: %v\n", reason.Error())
+		}
+
+		conn = c.redial()
+		if conn == nil {
+			return
+		}
+		c.recover(conn)
+	}
+}
+
+// redial retries with exponential backoff, returns nil if the connection gets closed meanwhile
+func (c *Connection) redial() amqpConnection {
+	backoff := c.opts.MinBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-c.done:
+			return nil
+		}
+
+		conn, err := c.dial(c.url)
+		if err == nil {
+			logger.Info("消息队列重新连接成功\n")
+			return conn
+		}
+		backoff *= 2
+		if backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+		logger.Info("消息队列重新连接失败，%v 后重试: %v\n", backoff, err.Error())
+	}
+}
+
+func (c *Connection) recover(conn amqpConnection) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.c = conn
+	schemes := append([]Settings(nil), c.schemes...)
+	listeners := append([]func(){}, c.listeners...)
+	c.mu.Unlock()
+
+	for _, s := range schemes {
+		if err := c.createScheme(s); err != nil {
+			logger.Error("消息队列重连后创建交换机、队列失败: %v\n", err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	close(c.ready)
+	c.mu.Unlock()
+
+	for _, f := range listeners {
+		f()
+	}
+	c.flushBuffer()
+}
+
+// handleOutage buffers or drops a message according to the outage policy
+func (c *Connection) handleOutage(ex, key string, msg amqp.Publishing) error {
+	if c.isClosed() {
+		return ErrConnectionClosed
+	}
+	if c.opts.OutagePolicy != BufferOnOutage {
+		return ErrMessageDropped
+	}
+
+	c.bufferLock.Lock()
+	defer c.bufferLock.Unlock()
+	if len(c.buffer) >= c.opts.BufferSize {
+		return ErrMessageDropped
+	}
+	c.buffer = append(c.buffer, pendingMessage{exchange: ex, key: key, msg: msg})
+	return nil
+}
+
+func (c *Connection) flushBuffer() {
+	c.bufferLock.Lock()
+	pending := c.buffer
+	c.buffer = nil
+	c.bufferLock.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	logger.Info("消息队列重连后补发缓存消息: %d 条\n", len(pending))
+	for _, p := range pending {
+		if err := c.publish(p.exchange, p.key, p.msg); err != nil {
+			logger.Error("缓存消息补发失败: %v\n", err.Error())
+		}
+	}
+}
+
+func (c *Connection) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errFakeChannel = errors.New("fake connection has no channels")
+
+// fakeConn stands in for a broker connection. It cannot open channels, it
+// only counts the attempts, and shutdown simulates the broker closing it.
+type fakeConn struct {
+	sync.Mutex
+	closed   bool
+	channels int
+	notify   []chan *amqp.Error
+}
+
+func (f *fakeConn) Channel() (*amqp.Channel, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.channels++
+	return nil, errFakeChannel
+}
+
+func (f *fakeConn) IsClosed() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.closed
+}
+
+func (f *fakeConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	f.Lock()
+	defer f.Unlock()
+	if f.closed {
+		close(receiver)
+	} else {
+		f.notify = append(f.notify, receiver)
+	}
+	return receiver
+}
+
+func (f *fakeConn) Close() error {
+	f.shutdown(nil)
+	return nil
+}
+
+func (f *fakeConn) shutdown(reason *amqp.Error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	for _, receiver := range f.notify {
+		if reason != nil {
+			receiver <- reason
+		}
+		close(receiver)
+	}
+}
+
+func (f *fakeConn) channelCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.channels
+}
+
+// fakeDialer hands out fakeConns. Every dial blocks until the test sends its
+// outcome on results, so the test controls when a redial succeeds.
+type fakeDialer struct {
+	sync.Mutex
+	results chan error
+	times   []time.Time
+	conns   []*fakeConn
+}
+
+func newFakeDialer() *fakeDialer {
+	return &fakeDialer{results: make(chan error)}
+}
+
+func (d *fakeDialer) dial(url string) (amqpConnection, error) {
+	d.Lock()
+	d.times = append(d.times, time.Now())
+	d.Unlock()
+	if err := <-d.results; err != nil {
+		return nil, err
+	}
+	conn := &fakeConn{}
+	d.Lock()
+	d.conns = append(d.conns, conn)
+	d.Unlock()
+	return conn, nil
+}
+
+func (d *fakeDialer) conn(i int) *fakeConn {
+	d.Lock()
+	defer d.Unlock()
+	return d.conns[i]
+}
+
+// connectFake connects through the fake dialer and returns a channel
+// receiving a value after every recovery
+func connectFake(t *testing.T, opts Options) (*Connection, *fakeDialer, chan struct{}) {
+	d := newFakeDialer()
+	go func() { d.results <- nil }()
+	c, err := connect("amqp://fake", opts, d.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := make(chan struct{}, 1)
+	c.NotifyReconnect(func() { recovered <- struct{}{} })
+	return c, d, recovered
+}
+
+func waitRecovered(t *testing.T, recovered chan struct{}) {
+	select {
+	case <-recovered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not recovered")
+	}
+}
+
+func TestConnectionRedialBackoff(t *testing.T) {
+	opts := Options{MinBackoff: 20 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+	c, d, recovered := connectFake(t, opts)
+	defer c.Close()
+
+	dropped := time.Now()
+	d.conn(0).shutdown(&amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restart"})
+	for i := 0; i < 5; i++ {
+		d.results <- errors.New("connection refused")
+	}
+	d.results <- nil
+	waitRecovered(t, recovered)
+
+	// the backoff doubles from MinBackoff and is capped at MaxBackoff
+	d.Lock()
+	times := append([]time.Time{dropped}, d.times[1:]...)
+	d.Unlock()
+	want := []time.Duration{20, 30, 30, 30, 30, 30}
+	if len(times) != len(want)+1 {
+		t.Fatalf("dialed %d times, want %d", len(times)-1, len(want))
+	}
+	for i, w := range want {
+		gap := times[i+1].Sub(times[i])
+		if gap < w*time.Millisecond {
+			t.Errorf("dial %d after %v, want at least %v", i+1, gap, w*time.Millisecond)
+		}
+	}
+	if gap := times[6].Sub(times[5]); gap > 250*time.Millisecond {
+		t.Errorf("last dial after %v, want the backoff capped at %v", gap, opts.MaxBackoff)
+	}
+	if conn, err := c.current(); err != nil || conn != d.conn(1) {
+		t.Errorf("current() = %v, %v, want the redialed connection", conn, err)
+	}
+}
+
+func TestConnectionCloseStopsRedial(t *testing.T) {
+	c, d, _ := connectFake(t, Options{MinBackoff: 50 * time.Millisecond})
+	d.conn(0).shutdown(nil)
+	d.results <- errors.New("connection refused")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// no further dial is attempted once the connection is closed
+	select {
+	case d.results <- nil:
+		t.Error("redialed after Close")
+	case <-time.After(300 * time.Millisecond):
+	}
+	if _, err := c.Channel(); err != ErrConnectionClosed {
+		t.Errorf("Channel() after Close = %v, want %v", err, ErrConnectionClosed)
+	}
+}
+
+func TestConnectionRecover(t *testing.T) {
+	c, d, recovered := connectFake(t, Options{MinBackoff: time.Millisecond})
+	defer c.Close()
+	c.schemes = []Settings{{}, {}}
+	var mu sync.Mutex
+	var calls []string
+	c.NotifyReconnect(func() {
+		mu.Lock()
+		calls = append(calls, "second")
+		mu.Unlock()
+	})
+	c.NotifyReconnect(func() {
+		mu.Lock()
+		calls = append(calls, "third")
+		mu.Unlock()
+	})
+
+	for i := 1; i <= 2; i++ {
+		d.conn(i - 1).shutdown(nil)
+		d.results <- nil
+		waitRecovered(t, recovered)
+
+		// every remembered scheme is declared again on the new connection
+		// before the listeners run
+		if got := d.conn(i).channelCount(); got != len(c.schemes) {
+			t.Errorf("recovery %d opened %d channels, want one per scheme", i, got)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"second", "third", "second", "third"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("listeners called %v, want %v", calls, want)
+	}
+}
+
+func TestConnectionOutagePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		wantErrs    []error
+		wantFlushed int
+	}{
+		{"drop", Options{OutagePolicy: DropOnOutage}, []error{ErrMessageDropped, ErrMessageDropped, ErrMessageDropped}, 0},
+		{"buffer", Options{OutagePolicy: BufferOnOutage, BufferSize: 2}, []error{nil, nil, ErrMessageDropped}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.MinBackoff = time.Millisecond
+			c, d, recovered := connectFake(t, tt.opts)
+			d.conn(0).shutdown(nil)
+
+			// the supervisor is redialing, so the connection is unavailable
+			var errs []error
+			go func() {
+				for _, key := range []string{"a", "b", "c"} {
+					errs = append(errs, c.Publish(Message{Exchange: "market", Key: key}))
+				}
+				d.results <- nil
+			}()
+			waitRecovered(t, recovered)
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("errors during outage = %v, want %v", errs, tt.wantErrs)
+			}
+
+			// buffered messages are published again after the listeners ran
+			deadline := time.Now().Add(5 * time.Second)
+			for d.conn(1).channelCount() < tt.wantFlushed && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := d.conn(1).channelCount(); got != tt.wantFlushed {
+				t.Errorf("flushed %d messages, want %d", got, tt.wantFlushed)
+			}
+			c.bufferLock.Lock()
+			if len(c.buffer) != 0 {
+				t.Errorf("%d messages left in the buffer", len(c.buffer))
+			}
+			c.bufferLock.Unlock()
+
+			c.Close()
+			if err := c.Publish(Message{Exchange: "market", Key: "d"}); err != ErrConnectionClosed {
+				t.Errorf("Publish after Close = %v, want %v", err, ErrConnectionClosed)
+			}
+		})
+	}
+}
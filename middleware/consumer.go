@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+// Decision tells the consumer what to do with a delivery once it has been handled
+type Decision int
+
+const (
+	// Ack acknowledges the message
+	Ack Decision = iota
+	// Nack rejects the message without requeueing, the broker dead-letters it
+	// if the queue has a dead-letter exchange
+	Nack
+	// Requeue puts the message back to the queue right away
+	Requeue
+	// Retry redelivers the message after ConsumerOptions.RetryDelay through a
+	// retry queue, once MaxRetries is exceeded the message is nacked
+	Retry
+)
+
+// RetryCountHeader counts how many times a message has been retried
+const RetryCountHeader = "x-retry-count"
+
+// Handler processes a single delivery and decides its fate
+type Handler func(d amqp.Delivery) Decision
+
+// ConsumerOptions configures Consume
+type ConsumerOptions struct {
+	Queue      string        `yaml:"queue"`
+	Prefetch   int           `yaml:"prefetch"`
+	Workers    int           `yaml:"workers"`
+	MaxRetries int           `yaml:"max_retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+func (o ConsumerOptions) withDefaults() ConsumerOptions {
+	if o.Workers <= 0 {
+		o.Workers = 1
+	}
+	if o.Prefetch <= 0 {
+		o.Prefetch = o.Workers
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 5 * time.Second
+	}
+	return o
+}
+
+// retryQueue holds retried messages until their TTL expires, then dead-letters
+// them back to the original queue through the default exchange. The TTL of a
+// queue can't change once declared, so the delay is part of the name and a
+// new RetryDelay declares a new queue, e.g. orders.retry.5s. A retry queue
+// left behind by an old delay still dead-letters its messages back and can
+// be deleted once empty.
+func (o ConsumerOptions) retryQueue() string {
+	return o.Queue + ".retry." + o.RetryDelay.String()
+}
+
+// Consume delivers messages from a queue to handler using manual acks and
+// opts.Workers concurrent workers. The consumer is recreated after the
+// connection is recovered. It returns nil when ctx is cancelled or the
+// connection is closed, after in-flight messages have been handled.
+func (c *Connection) Consume(ctx context.Context, opts ConsumerOptions, handler Handler) error {
+	opts = opts.withDefaults()
+	for {
+		ch, err := c.waitChannel(ctx)
+		if err == ErrConnectionClosed || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = c.consumeChannel(ctx, ch, opts, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && c.connected() {
+			return err
+		}
+		if c.isClosed() {
+			return nil
+		}
+		logger.Info("消息队列连接断开，等待重连后恢复消费: %s\n", opts.Queue)
+	}
+}
+
+func (c *Connection) consumeChannel(ctx context.Context, ch *amqp.Channel, opts ConsumerOptions, handler Handler) error {
+	defer ch.Close()
+
+	if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+		return err
+	}
+	if opts.MaxRetries > 0 {
+		_, err := ch.QueueDeclare(opts.retryQueue(), true, false, false, false, amqp.Table{
+			"x-message-ttl":             int64(opts.RetryDelay / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": opts.Queue,
+		})
+		if err != nil {
+			return fmt.Errorf("middleware: declare retry queue for %q: %w", opts.Queue, err)
+		}
+	}
+
+	tag := fmt.Sprintf("wisp-%s-%d", opts.Queue, time.Now().UnixNano())
+	deliveries, err := ch.Consume(opts.Queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// stop receiving, workers finish the deliveries already buffered
+			ch.Cancel(tag, false)
+		case <-stop:
+		}
+	}()
+	defer close(stop)
+
+	c.dispatch(ch, opts, deliveries, handler)
+	return nil
+}
+
+// dispatch hands deliveries to opts.Workers workers and returns once the
+// deliveries channel is closed and every delivery has been settled
+func (c *Connection) dispatch(ch amqpChannel, opts ConsumerOptions, deliveries <-chan amqp.Delivery, handler Handler) {
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				c.settle(ch, opts, d, c.handle(handler, d))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// handle calls the handler, a panicking handler nacks the message
+func (c *Connection) handle(handler Handler, d amqp.Delivery) (decision Decision) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("消息处理异常: key=%s err=%v\n", d.RoutingKey, r)
+			decision = Nack
+		}
+	}()
+	return handler(d)
+}
+
+func (c *Connection) settle(ch amqpChannel, opts ConsumerOptions, d amqp.Delivery, decision Decision) {
+	var err error
+	switch decision {
+	case Ack:
+		err = d.Ack(false)
+	case Requeue:
+		err = d.Nack(false, true)
+	case Retry:
+		err = c.retry(ch, opts, d)
+	default:
+		err = d.Nack(false, false)
+	}
+	if err != nil {
+		logger.Error("消息确认失败: queue=%s err=%v\n", opts.Queue, err.Error())
+	}
+}
+
+// retry republishes the message to the retry queue with an incremented
+// retry count and acks the original, or nacks it once retries are exhausted
+func (c *Connection) retry(ch amqpChannel, opts ConsumerOptions, d amqp.Delivery) error {
+	count := retryCount(d.Headers)
+	if count >= opts.MaxRetries {
+		logger.Warn("消息重试次数已达上限 %d: queue=%s\n", opts.MaxRetries, opts.Queue)
+		return d.Nack(false, false)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[RetryCountHeader] = int64(count + 1)
+	err := ch.Publish("", opts.retryQueue(), false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		Body:            d.Body,
+	})
+	if err != nil {
+		// keep the message rather than lose it
+		return d.Nack(false, true)
+	}
+	return d.Ack(false)
+}
+
+func retryCount(headers amqp.Table) int {
+	switch v := headers[RetryCountHeader].(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
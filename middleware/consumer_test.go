@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumerRetryQueue(t *testing.T) {
+	tests := []struct {
+		opts ConsumerOptions
+		want string
+	}{
+		{ConsumerOptions{Queue: "orders"}, "orders.retry.5s"},
+		{ConsumerOptions{Queue: "orders", RetryDelay: 30 * time.Second}, "orders.retry.30s"},
+		{ConsumerOptions{Queue: "orders", RetryDelay: 1500 * time.Millisecond}, "orders.retry.1.5s"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.withDefaults().retryQueue(); got != tt.want {
+			t.Errorf("retryQueue(%v) = %q, want %q", tt.opts.RetryDelay, got, tt.want)
+		}
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{RetryCountHeader: int64(2)}, 2},
+		{amqp.Table{RetryCountHeader: int32(3)}, 3},
+		{amqp.Table{RetryCountHeader: "4"}, 0},
+	}
+	for _, tt := range tests {
+		if got := retryCount(tt.headers); got != tt.want {
+			t.Errorf("retryCount(%v) = %d, want %d", tt.headers, got, tt.want)
+		}
+	}
+}
+
+// fakeAcknowledger records how every delivery tag was settled
+type fakeAcknowledger struct {
+	sync.Mutex
+	settled map[uint64]string
+}
+
+func newFakeAcknowledger() *fakeAcknowledger {
+	return &fakeAcknowledger{settled: make(map[uint64]string)}
+}
+
+func (f *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	return f.record(tag, "ack")
+}
+
+func (f *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return f.record(tag, "requeue")
+	}
+	return f.record(tag, "nack")
+}
+
+func (f *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.record(tag, "reject")
+}
+
+func (f *fakeAcknowledger) record(tag uint64, outcome string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.settled[tag] = outcome
+	return nil
+}
+
+func (f *fakeAcknowledger) outcome(tag uint64) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.settled[tag]
+}
+
+func TestConsumerSettle(t *testing.T) {
+	retry := func(amqp.Delivery) Decision { return Retry }
+	tests := []struct {
+		name          string
+		handler       Handler
+		headers       amqp.Table
+		channelClosed bool
+		want          string
+		wantRetried   int64 // retry count of the republished message, 0 if none
+	}{
+		{"ack", func(amqp.Delivery) Decision { return Ack }, nil, false, "ack", 0},
+		{"nack", func(amqp.Delivery) Decision { return Nack }, nil, false, "nack", 0},
+		{"requeue", func(amqp.Delivery) Decision { return Requeue }, nil, false, "requeue", 0},
+		{"panic", func(amqp.Delivery) Decision { panic("boom") }, nil, false, "nack", 0},
+		{"first retry", retry, amqp.Table{"trace": "t1"}, false, "ack", 1},
+		{"second retry", retry, amqp.Table{"trace": "t1", RetryCountHeader: int64(1)}, false, "ack", 2},
+		{"retries exhausted", retry, amqp.Table{RetryCountHeader: int64(2)}, false, "nack", 0},
+		{"retry publish failed", retry, nil, true, "requeue", 0},
+	}
+	opts := ConsumerOptions{Queue: "orders", MaxRetries: 2}.withDefaults()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connection{}
+			ack := newFakeAcknowledger()
+			ch := &fakeChannel{closed: tt.channelClosed}
+			d := amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Headers: tt.headers, Body: []byte("order"), MessageId: "m1"}
+			c.settle(ch, opts, d, c.handle(tt.handler, d))
+			if got := ack.outcome(1); got != tt.want {
+				t.Errorf("settled as %q, want %q", got, tt.want)
+			}
+
+			if tt.wantRetried == 0 {
+				if len(ch.msgs) != 0 {
+					t.Errorf("republished %d messages, want none", len(ch.msgs))
+				}
+				return
+			}
+			// the copy goes to the retry queue with an incremented count,
+			// the delivery's own headers are left untouched
+			if len(ch.msgs) != 1 || ch.keys[0] != "orders.retry.5s" {
+				t.Fatalf("republished to %v, want orders.retry.5s", ch.keys)
+			}
+			msg := ch.msgs[0]
+			if msg.Headers[RetryCountHeader] != tt.wantRetried || msg.Headers["trace"] != "t1" || string(msg.Body) != "order" || msg.MessageId != "m1" {
+				t.Errorf("republished %+v, want retry count %d", msg, tt.wantRetried)
+			}
+			if got := retryCount(tt.headers); got != int(tt.wantRetried-1) {
+				t.Errorf("delivery retry count changed to %d", got)
+			}
+		})
+	}
+}
+
+func TestConsumerDispatch(t *testing.T) {
+	const workers, messages = 3, 9
+	c := &Connection{}
+	ack := newFakeAcknowledger()
+	deliveries := make(chan amqp.Delivery, messages)
+	for i := 1; i <= messages; i++ {
+		deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: uint64(i)}
+	}
+	close(deliveries)
+
+	// each handler waits until all workers are busy, which only completes
+	// if the deliveries are handled concurrently
+	var mu sync.Mutex
+	busy, maxBusy := 0, 0
+	started := make(chan struct{}, messages)
+	release := make(chan struct{})
+	handler := func(d amqp.Delivery) Decision {
+		mu.Lock()
+		busy++
+		if busy > maxBusy {
+			maxBusy = busy
+		}
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		busy--
+		mu.Unlock()
+		if d.DeliveryTag%2 == 0 {
+			return Requeue
+		}
+		return Ack
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.dispatch(&fakeChannel{}, ConsumerOptions{Queue: "orders", Workers: workers}.withDefaults(), deliveries, handler)
+		close(done)
+	}()
+	for i := 0; i < workers; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d workers started", i, workers)
+		}
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch did not return after the deliveries channel was closed")
+	}
+
+	if maxBusy != workers {
+		t.Errorf("%d deliveries handled at once, want %d", maxBusy, workers)
+	}
+	for i := uint64(1); i <= messages; i++ {
+		want := "ack"
+		if i%2 == 0 {
+			want = "requeue"
+		}
+		if got := ack.outcome(i); got != want {
+			t.Errorf("delivery %d settled as %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestConsumeCancelWhileReconnecting(t *testing.T) {
+	c, d, _ := connectFake(t, Options{MinBackoff: time.Hour})
+	defer c.Close()
+	d.conn(0).shutdown(nil)
+
+	// the connection is down, so Consume waits for a channel until ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Consume(ctx, ConsumerOptions{Queue: "orders"}, func(amqp.Delivery) Decision { return Ack })
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Consume() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Consume ignored the cancelled context while reconnecting")
+	}
+}
@@ -0,0 +1,6 @@
+package middleware
+
+import "wisp/log"
+
+// logger is the module logger of the middleware package
+var logger = log.Named("middleware")
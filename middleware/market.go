@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"wisp/codec"
+	"wisp/common"
+)
+
+const (
+	// marketQueueSize is the number of encoded events waiting for the publish goroutine
+	marketQueueSize = 10000
+	// marketBatchSize caps the number of messages published before waiting for their confirms
+	marketBatchSize = 100
+)
+
+var (
+	// ErrQueueFull is returned by MarketPublisher.PublishEvent when the broker
+	// can't keep up and the event is dropped
+	ErrQueueFull = errors.New("middleware: publish queue full, event dropped")
+	// ErrPublisherClosed is returned when publishing to a closed MarketPublisher
+	ErrPublisherClosed = errors.New("middleware: publisher closed")
+)
+
+// messagePublisher is the part of Publisher used by MarketPublisher
+type messagePublisher interface {
+	PublishBatch(msgs []Message) error
+}
+
+// MarketPublisher routes market data events to a topic exchange.
+// Routing keys have the form <venue>.<symbol>.<channel>[.<period>],
+// e.g. binance.btcusdt.kline.1m, so consumers can bind with wildcards
+// such as binance.*.ticker or *.btcusdt.#.
+//
+// PublishEvent is called from the exchange read loop, so it only encodes and
+// queues the event. A publish goroutine sends whatever is queued as one batch
+// and waits for the confirms of the whole batch, so a slow broker or a confirm
+// timeout never blocks the read loop. When the queue is full new events are
+// dropped with ErrQueueFull; failed batches go to the error handler.
+type MarketPublisher struct {
+	sync.RWMutex
+	publisher  messagePublisher
+	codec      codec.Codec
+	exchange   string
+	persistent bool
+	queue      chan Message
+	done       chan struct{}
+	closed     bool
+	onError    func(err error, count int)
+	dropped    uint64
+}
+
+// NewMarketPublisher creates a publisher from the publisher section of settings.
+// The target exchange, if declared in settings, must be a topic exchange.
+func NewMarketPublisher(conn *Connection, s Settings) (*MarketPublisher, error) {
+	spec := s.Publisher
+	if spec.Exchange == "" {
+		return nil, fmt.Errorf("publisher: exchange is not set")
+	}
+	if e, ok := s.Exchanges[spec.Exchange]; ok && e.Type != amqp.ExchangeTopic {
+		return nil, fmt.Errorf("publisher: exchange %q must be of type %s, got %q", spec.Exchange, amqp.ExchangeTopic, e.Type)
+	}
+	c, err := codec.Get(spec.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("publisher: %w", err)
+	}
+
+	return newMarketPublisher(NewPublisher(conn, spec.Options), c, spec, marketQueueSize), nil
+}
+
+func newMarketPublisher(publisher messagePublisher, c codec.Codec, spec PublisherSpec, queueSize int) *MarketPublisher {
+	p := &MarketPublisher{
+		publisher:  publisher,
+		codec:      c,
+		exchange:   spec.Exchange,
+		persistent: spec.Persistent,
+		queue:      make(chan Message, queueSize),
+		done:       make(chan struct{}),
+		onError: func(err error, count int) {
+			logger.Error("行情发布失败，丢弃 %d 条消息: %v\n", count, err.Error())
+		},
+	}
+	go p.loop()
+	return p
+}
+
+// SetErrorHandler replaces the handler called with the error of a failed
+// batch and the number of messages in it, the default logs the error
+func (p *MarketPublisher) SetErrorHandler(f func(err error, count int)) {
+	p.Lock()
+	defer p.Unlock()
+	p.onError = f
+}
+
+// Dropped returns the number of events dropped because the queue was full
+func (p *MarketPublisher) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// RoutingKey builds the routing key for an event, parts are lower-cased
+// and dots inside parts are replaced so they don't create extra words.
+func RoutingKey(venue, symbol, channel string, args ...string) string {
+	ev := &common.MarketEvent{Venue: venue, Symbol: symbol, Channel: channel, Period: strings.Join(args, ".")}
+	return ev.Topic()
+}
+
+// PublishDepth publishes an order book snapshot
+func (p *MarketPublisher) PublishDepth(venue string, depth *common.Depth) error {
+	return p.PublishEvent(common.NewDepthEvent(venue, depth))
+}
+
+// PublishTicker publishes a ticker update
+func (p *MarketPublisher) PublishTicker(venue string, ticker *common.Ticker) error {
+	return p.PublishEvent(common.NewTickerEvent(venue, ticker))
+}
+
+// PublishKline publishes a kline update, period is one of common.KLINE_PERIOD_*
+func (p *MarketPublisher) PublishKline(venue string, kline *common.Kline, period int) error {
+	if _, ok := common.KLINE_PERIOD[period]; !ok {
+		return fmt.Errorf("publisher: unknown kline period %d", period)
+	}
+	return p.PublishEvent(common.NewKlineEvent(venue, kline, period))
+}
+
+// PublishTrade publishes a single trade
+func (p *MarketPublisher) PublishTrade(venue string, trade *common.Trade) error {
+	return p.PublishEvent(common.NewTradeEvent(venue, trade))
+}
+
+// PublishEvent encodes the event with the configured codec and queues it
+// with the event topic as routing key, the event coordinates are also set as
+// headers for consumers of headers exchanges. It doesn't wait for the broker,
+// see MarketPublisher for how failures are reported.
+func (p *MarketPublisher) PublishEvent(ev *common.MarketEvent) error {
+	m, err := p.message(ev)
+	if err != nil {
+		return err
+	}
+	p.RLock()
+	defer p.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	select {
+	case p.queue <- m:
+		return nil
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		return ErrQueueFull
+	}
+}
+
+func (p *MarketPublisher) message(ev *common.MarketEvent) (Message, error) {
+	body, err := p.codec.Encode(ev)
+	if err != nil {
+		return Message{}, err
+	}
+	headers := amqp.Table{"venue": ev.Venue, "symbol": ev.Symbol, "channel": ev.Channel, "seq": int64(ev.Sequence)}
+	if ev.Period != "" {
+		headers["period"] = ev.Period
+	}
+	return Message{
+		Exchange:    p.exchange,
+		Key:         ev.Topic(),
+		Body:        body,
+		ContentType: p.codec.ContentType(),
+		Headers:     headers,
+		Persistent:  p.persistent,
+	}, nil
+}
+
+// loop publishes queued messages in batches of whatever is waiting, up to marketBatchSize
+func (p *MarketPublisher) loop() {
+	defer close(p.done)
+	batch := make([]Message, 0, marketBatchSize)
+	for m := range p.queue {
+		batch = append(batch[:0], m)
+	fill:
+		for len(batch) < marketBatchSize {
+			select {
+			case m, ok := <-p.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, m)
+			default:
+				break fill
+			}
+		}
+		if err := p.publisher.PublishBatch(batch); err != nil {
+			p.RLock()
+			onError := p.onError
+			p.RUnlock()
+			onError(err, len(batch))
+		}
+	}
+}
+
+// Close stops accepting events and publishes the queued ones, the connection is left open
+func (p *MarketPublisher) Close() error {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return ErrPublisherClosed
+	}
+	p.closed = true
+	close(p.queue)
+	p.Unlock()
+
+	<-p.done
+	return nil
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"wisp/codec"
+	"wisp/common"
+)
+
+// fakeBatchPublisher records published batches. While block is set, every
+// PublishBatch call announces itself on started and waits for block to close.
+type fakeBatchPublisher struct {
+	sync.Mutex
+	batches [][]Message
+	err     error
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (f *fakeBatchPublisher) PublishBatch(msgs []Message) error {
+	if f.block != nil {
+		f.started <- struct{}{}
+		<-f.block
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.batches = append(f.batches, append([]Message(nil), msgs...))
+	return f.err
+}
+
+func (f *fakeBatchPublisher) messages() []Message {
+	f.Lock()
+	defer f.Unlock()
+	var msgs []Message
+	for _, b := range f.batches {
+		msgs = append(msgs, b...)
+	}
+	return msgs
+}
+
+func newTestMarketPublisher(f *fakeBatchPublisher, queueSize int) *MarketPublisher {
+	c, _ := codec.Get("json")
+	return newMarketPublisher(f, c, PublisherSpec{Exchange: "market", Persistent: true}, queueSize)
+}
+
+func TestMarketPublisherRouting(t *testing.T) {
+	kline := common.NewKlineEvent(common.BINANCE, &common.Kline{Symbol: "btcusdt"}, common.KLINE_PERIOD_1MIN)
+	kline.Sequence = 7
+	tests := []struct {
+		name        string
+		ev          *common.MarketEvent
+		wantKey     string
+		wantHeaders amqp.Table
+	}{
+		{"ticker", common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt"}), "binance.btcusdt.ticker",
+			amqp.Table{"venue": "binance", "symbol": "btcusdt", "channel": "ticker", "seq": int64(0)}},
+		{"kline", kline, "binance.btcusdt.kline.1m",
+			amqp.Table{"venue": "binance", "symbol": "btcusdt", "channel": "kline", "period": "1m", "seq": int64(7)}},
+		{"dotted symbol", common.NewTradeEvent("Venue", &common.Trade{Symbol: "BTC.USDT"}), "venue.btc_usdt.trade",
+			amqp.Table{"venue": "Venue", "symbol": "BTC.USDT", "channel": "trade", "seq": int64(0)}},
+		{"user data", common.NewBalanceUpdateEvent(common.BINANCE, &common.BalanceUpdate{Asset: "BTC"}), "user.binance.balance_update",
+			amqp.Table{"venue": "binance", "symbol": "", "channel": common.CHANNEL_BALANCE_UPDATE, "seq": int64(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeBatchPublisher{}
+			p := newTestMarketPublisher(f, 10)
+			if err := p.PublishEvent(tt.ev); err != nil {
+				t.Fatal(err)
+			}
+			p.Close()
+
+			msgs := f.messages()
+			if len(msgs) != 1 {
+				t.Fatalf("published %d messages, want 1", len(msgs))
+			}
+			m := msgs[0]
+			if m.Exchange != "market" || m.Key != tt.wantKey || m.ContentType != "application/json" || !m.Persistent {
+				t.Errorf("published to %s with key %s (%s, persistent %v), want market with key %s", m.Exchange, m.Key, m.ContentType, m.Persistent, tt.wantKey)
+			}
+			if !reflect.DeepEqual(m.Headers, tt.wantHeaders) {
+				t.Errorf("headers = %v, want %v", m.Headers, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func TestMarketPublisherBackPressure(t *testing.T) {
+	f := &fakeBatchPublisher{started: make(chan struct{}), block: make(chan struct{})}
+	p := newTestMarketPublisher(f, 2)
+	publish := func(symbol string) error {
+		return p.PublishEvent(common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: symbol}))
+	}
+
+	// the first message is taken by the publish goroutine, which then blocks
+	// waiting for confirms; two more fit the queue and the rest are dropped
+	// without blocking the caller
+	if err := publish("a"); err != nil {
+		t.Fatal(err)
+	}
+	<-f.started
+	start := time.Now()
+	errs := []error{publish("b"), publish("c"), publish("d"), publish("e")}
+	if want := []error{nil, nil, ErrQueueFull, ErrQueueFull}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %v, want %v", errs, want)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("PublishEvent blocked for %v", elapsed)
+	}
+	if got := p.Dropped(); got != 2 {
+		t.Errorf("Dropped() = %d, want 2", got)
+	}
+
+	// the queued messages go out as one batch and Close waits for them
+	go func() {
+		for range f.started {
+		}
+	}()
+	close(f.block)
+	p.Close()
+	close(f.started)
+	var keys []string
+	for _, m := range f.messages() {
+		keys = append(keys, m.Key)
+	}
+	if want := []string{"binance.a.ticker", "binance.b.ticker", "binance.c.ticker"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("published %v, want %v", keys, want)
+	}
+	if len(f.batches) != 2 || len(f.batches[1]) != 2 {
+		t.Errorf("batches = %d, want the queued messages in one batch", len(f.batches))
+	}
+	if err := publish("f"); err != ErrPublisherClosed {
+		t.Errorf("PublishEvent after Close = %v, want %v", err, ErrPublisherClosed)
+	}
+	if err := p.Close(); err != ErrPublisherClosed {
+		t.Errorf("second Close = %v, want %v", err, ErrPublisherClosed)
+	}
+}
+
+func TestMarketPublisherErrorHandler(t *testing.T) {
+	nacked := errors.New("nacked")
+	f := &fakeBatchPublisher{err: nacked}
+	p := newTestMarketPublisher(f, 10)
+	var gotErr error
+	var gotCount int
+	p.SetErrorHandler(func(err error, count int) {
+		gotErr, gotCount = err, gotCount+count
+	})
+	for _, symbol := range []string{"a", "b", "c"} {
+		if err := p.PublishEvent(common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: symbol})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+	if gotErr != nacked || gotCount != 3 {
+		t.Errorf("error handler got %v for %d messages, want %v for 3", gotErr, gotCount, nacked)
+	}
+}
@@ -1,10 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"github.com/streadway/amqp"
 	"gopkg.in/yaml.v2"
 	"io"
-	"wisp/log"
 )
 
 type (
@@ -14,13 +14,15 @@ type (
 		Internal   bool      `yaml:"internal"`
 		Nowait     bool      `yaml:"nowait"`
 		Type       string    `yaml:"type"`
+		Args       Arguments `yaml:"args"`
 		Bindings   []Binding `yaml:"bindings"`
 	}
 
 	Binding struct {
-		Exchange string `yaml:"exchange"`
-		Key      string `yaml:"key"`
-		Nowait   bool   `yaml:"nowait"`
+		Exchange string    `yaml:"exchange"`
+		Key      string    `yaml:"key"`
+		Nowait   bool      `yaml:"nowait"`
+		Args     Arguments `yaml:"args"`
 	}
 
 	QueueSpec struct {
@@ -28,27 +30,28 @@ type (
 		AutoDelete bool      `yaml:"autodelete"`
 		Nowait     bool      `yaml:"nowait"`
 		Exclusive  bool      `yaml:"exclusive"`
+		Args       Arguments `yaml:"args"`
 		Bindings   []Binding `yaml:"bindings"`
 	}
 
-	Settings struct {
-		Exchanges map[string]Exchange  `yaml:"exchanges"`
-		Queues    map[string]QueueSpec `yaml:"queues"`
+	// PublisherSpec configures where market data events are published.
+	// Encoding is one of json, protobuf or msgpack, json if empty.
+	PublisherSpec struct {
+		Exchange   string           `yaml:"exchange"`
+		Persistent bool             `yaml:"persistent"`
+		Encoding   string           `yaml:"encoding"`
+		Options    PublisherOptions `yaml:",inline"`
 	}
-)
-
-type Connection struct {
-	c *amqp.Connection
-}
 
-func Connect(url string) (*Connection, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		log.Info("消息队列连接失败:%v\n", err.Error())
-		return nil, err
+	Settings struct {
+		Connection Options              `yaml:"connection"`
+		Exchanges  map[string]Exchange  `yaml:"exchanges"`
+		Queues     map[string]QueueSpec `yaml:"queues"`
+		Publisher  PublisherSpec        `yaml:"publisher"`
+		// StrictBindings rejects bindings to exchanges not declared above
+		StrictBindings bool `yaml:"strict_bindings"`
 	}
-	return &Connection{conn}, nil
-}
+)
 
 func DecodeYaml(r io.Reader) (Settings, error) {
 	s := Settings{}
@@ -60,25 +63,43 @@ func DecodeYaml(r io.Reader) (Settings, error) {
 	return s, nil
 }
 
-// CreateScheme creates all exchanges, queues and bindinges between them as specified in yaml string
+// CreateScheme creates all exchanges, queues and bindinges between them as specified in yaml string.
+// The scheme is remembered and created again every time the connection is recovered.
 func (c *Connection) CreateScheme(s Settings) error {
-	ch, err := c.c.Channel()
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if err := c.createScheme(s); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.schemes = append(c.schemes, s)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Connection) createScheme(s Settings) error {
+	conn, err := c.current()
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 
 	// Create exchanges according to settings
 	for name, e := range s.Exchanges {
-		err = ch.ExchangeDeclarePassive(name, e.Type, e.Durable, e.AutoDelete, e.Internal, e.Nowait, nil)
+		err = ch.ExchangeDeclarePassive(name, e.Type, e.Durable, e.AutoDelete, e.Internal, e.Nowait, e.Args.Table())
 		if err == nil {
 			continue
 		}
-		ch, err = c.c.Channel()
+		ch, err = conn.Channel()
 		if err != nil {
 			return err
 		}
 
-		err = ch.ExchangeDeclare(name, e.Type, e.Durable, e.AutoDelete, e.Internal, e.Nowait, nil)
+		err = ch.ExchangeDeclare(name, e.Type, e.Durable, e.AutoDelete, e.Internal, e.Nowait, e.Args.Table())
 		if err != nil {
 			return err
 		}
@@ -86,17 +107,17 @@ func (c *Connection) CreateScheme(s Settings) error {
 
 	// Create queues according to settings
 	for name, q := range s.Queues {
-		_, err := ch.QueueDeclarePassive(name, q.Durable, q.AutoDelete, q.Exclusive, q.Nowait, nil)
+		_, err := ch.QueueDeclarePassive(name, q.Durable, q.AutoDelete, q.Exclusive, q.Nowait, q.Args.Table())
 		if err == nil {
 			continue
 		}
 
-		ch, err = c.c.Channel()
+		ch, err = conn.Channel()
 		if err != nil {
 			return err
 		}
 
-		_, err = ch.QueueDeclare(name, q.Durable, q.AutoDelete, q.Exclusive, q.Nowait, nil)
+		_, err = ch.QueueDeclare(name, q.Durable, q.AutoDelete, q.Exclusive, q.Nowait, q.Args.Table())
 		if err != nil {
 			return err
 		}
@@ -108,7 +129,7 @@ func (c *Connection) CreateScheme(s Settings) error {
 	// This way it's still possible but now is an error on the user side)
 	for name, e := range s.Exchanges {
 		for _, b := range e.Bindings {
-			err = ch.ExchangeBind(name, b.Key, b.Exchange, b.Nowait, nil)
+			err = ch.ExchangeBind(name, b.Key, b.Exchange, b.Nowait, b.Args.Table())
 			if err != nil {
 				return err
 			}
@@ -117,7 +138,7 @@ func (c *Connection) CreateScheme(s Settings) error {
 
 	for name, q := range s.Queues {
 		for _, b := range q.Bindings {
-			err = ch.QueueBind(name, b.Key, b.Exchange, b.Nowait, nil)
+			err = ch.QueueBind(name, b.Key, b.Exchange, b.Nowait, b.Args.Table())
 			if err != nil {
 				return err
 			}
@@ -128,12 +149,36 @@ func (c *Connection) CreateScheme(s Settings) error {
 	return nil
 }
 
+// DeleteScheme removes the bindings, exchanges and queues specified in settings.
+// Bindings are removed with their arguments first, so bindings to exchanges
+// that are not part of the settings don't survive.
 func (c *Connection) DeleteScheme(s Settings) error {
-	ch, err := c.c.Channel()
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	ch, err := c.Channel()
 	if err != nil {
 		return err
 	}
 
+	for name, e := range s.Exchanges {
+		for _, b := range e.Bindings {
+			err = ch.ExchangeUnbind(name, b.Key, b.Exchange, b.Nowait, b.Args.Table())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, q := range s.Queues {
+		for _, b := range q.Bindings {
+			err = ch.QueueUnbind(name, b.Key, b.Exchange, b.Args.Table())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	for name := range s.Exchanges {
 		err = ch.ExchangeDelete(name, false, false)
 		if err != nil {
@@ -151,61 +196,43 @@ func (c *Connection) DeleteScheme(s Settings) error {
 	return nil
 }
 
-// Close closes connection to RabbitMQ
-func (c *Connection) Close() error {
-	return c.c.Close()
-}
-
 // SendMessage publishes plain text message to an exchange with specific routing key
 func (c *Connection) SendMessage(ex, key, msg string) error {
-	ch, err := c.c.Channel()
-	if err != nil {
-		return err
-	}
-
-	err = ch.Publish(ex, key, false, false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/plain",
-			Body:         []byte(msg),
-		})
-	if err != nil {
-		return err
-	}
-	return ch.Close()
+	return c.publisher.Publish(Message{
+		Exchange:    ex,
+		Key:         key,
+		Body:        []byte(msg),
+		ContentType: "text/plain",
+		Persistent:  true,
+	})
 }
 
 // SendBlob publishes byte blob message to an exchange with specific routing key
 func (c *Connection) SendBlob(ex, key string, msg []byte) error {
-	ch, err := c.c.Channel()
-	if err != nil {
-		return err
-	}
+	return c.publisher.Publish(Message{
+		Exchange:    ex,
+		Key:         key,
+		Body:        msg,
+		ContentType: "application/octet-stream",
+		Persistent:  true,
+	})
+}
 
-	err = ch.Publish(ex, key, false, false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/octet-stream",
-			Body:         msg,
-		})
-	if err != nil {
-		return err
-	}
-	return ch.Close()
+// Publish sends a message over the connection's pooled confirm-mode publisher
+func (c *Connection) Publish(m Message) error {
+	return c.publisher.Publish(m)
+}
+
+func (c *Connection) publish(ex, key string, msg amqp.Publishing) error {
+	return c.publisher.publish(ex, key, false, msg)
 }
 
-// ProcessQueue calls handler function on each message delivered to a queue
+// ProcessQueue calls handler function on each message delivered to a queue.
+// Messages are acked once the handler returns. If the connection is lost the
+// consumer is recreated after reconnecting, it returns once the connection is closed.
 func (c *Connection) ProcessQueue(name string, f func([]byte)) error {
-	ch, err := c.c.Channel()
-	if err != nil {
-		return err
-	}
-	msgs, err := ch.Consume(name, "", true, false, false, false, nil)
-	if err != nil {
-		return err
-	}
-	for d := range msgs {
+	return c.Consume(context.Background(), ConsumerOptions{Queue: name}, func(d amqp.Delivery) Decision {
 		f(d.Body)
-	}
-	return nil
+		return Ack
+	})
 }
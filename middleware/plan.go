@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/streadway/amqp"
+	"sort"
+	"strings"
+)
+
+// Action is the kind of change a plan applies to an entity
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionDelete Action = "delete"
+	// ActionRecreate deletes and declares an entity again because its properties
+	// can't be changed in place, a recreated queue loses its messages
+	ActionRecreate Action = "recreate"
+)
+
+// Change is a single step of a Plan
+type Change struct {
+	Action Action
+	Kind   string
+	Name   string
+	Reason string
+	apply  func(ch *amqp.Channel) error
+}
+
+func (c Change) String() string {
+	symbol := map[Action]string{ActionCreate: "+", ActionDelete: "-", ActionRecreate: "~"}[c.Action]
+	s := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	if c.Reason != "" {
+		s += " (" + c.Reason + ")"
+	}
+	return s
+}
+
+// Plan is the ordered list of changes needed to bring the broker in line with Settings
+type Plan struct {
+	Changes []Change
+}
+
+// Empty reports whether the broker already matches the settings
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "no changes, broker matches the scheme\n"
+	}
+	var b strings.Builder
+	for _, c := range p.Changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// bindingRef identifies a binding, arguments are part of the identity
+type bindingRef struct {
+	source   string
+	dest     string
+	destType string
+	key      string
+	args     string
+	table    amqp.Table
+	nowait   bool
+}
+
+func (b bindingRef) String() string {
+	s := fmt.Sprintf("%s -> %s %s [%s]", b.source, b.destType, b.dest, b.key)
+	if b.args != "{}" {
+		s += " " + b.args
+	}
+	return s
+}
+
+// Plan compares the settings with the broker and returns the changes needed.
+// Entities that exist on the broker but not in settings are left alone, but
+// bindings whose destination is declared in settings and that are not listed
+// there are considered stale and removed. Recreating an exchange or queue
+// drops all of its bindings, those not in settings are listed as deletions
+// too, even when their other end is not declared in settings.
+func (m *Management) Plan(s Settings) (*Plan, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	exchanges, err := m.exchanges()
+	if err != nil {
+		return nil, err
+	}
+	queues, err := m.queues()
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := m.bindings()
+	if err != nil {
+		return nil, err
+	}
+
+	currentExchanges := map[string]brokerExchange{}
+	for _, e := range exchanges {
+		currentExchanges[e.Name] = e
+	}
+	currentQueues := map[string]brokerQueue{}
+	for _, q := range queues {
+		currentQueues[q.Name] = q
+	}
+
+	var entities []Change
+	// bindings of recreated entities are dropped by the broker
+	recreated := map[string]bool{}
+
+	for _, name := range sortedKeys(s.Exchanges) {
+		name, e := name, s.Exchanges[name]
+		declare := func(ch *amqp.Channel) error {
+			return ch.ExchangeDeclare(name, e.Type, e.Durable, e.AutoDelete, e.Internal, e.Nowait, e.Args.Table())
+		}
+		cur, ok := currentExchanges[name]
+		if !ok {
+			entities = append(entities, Change{Action: ActionCreate, Kind: "exchange", Name: name, Reason: e.Type, apply: declare})
+			continue
+		}
+		if diff := exchangeDiff(e, cur); diff != "" {
+			recreated["exchange:"+name] = true
+			entities = append(entities, Change{Action: ActionRecreate, Kind: "exchange", Name: name, Reason: diff, apply: func(ch *amqp.Channel) error {
+				if err := ch.ExchangeDelete(name, false, false); err != nil {
+					return err
+				}
+				return declare(ch)
+			}})
+		}
+	}
+
+	for _, name := range sortedKeys(s.Queues) {
+		name, q := name, s.Queues[name]
+		declare := func(ch *amqp.Channel) error {
+			_, err := ch.QueueDeclare(name, q.Durable, q.AutoDelete, q.Exclusive, q.Nowait, q.Args.Table())
+			return err
+		}
+		cur, ok := currentQueues[name]
+		if !ok {
+			entities = append(entities, Change{Action: ActionCreate, Kind: "queue", Name: name, apply: declare})
+			continue
+		}
+		if diff := queueDiff(q, cur); diff != "" {
+			recreated["queue:"+name] = true
+			entities = append(entities, Change{Action: ActionRecreate, Kind: "queue", Name: name, Reason: diff + ", messages will be lost", apply: func(ch *amqp.Channel) error {
+				if _, err := ch.QueueDelete(name, false, false, false); err != nil {
+					return err
+				}
+				return declare(ch)
+			}})
+		}
+	}
+
+	desired := map[string]bindingRef{}
+	for name, e := range s.Exchanges {
+		for _, b := range e.Bindings {
+			ref := newBindingRef(b.Exchange, name, "exchange", b.Key, b.Args.Table())
+			ref.nowait = b.Nowait
+			desired[ref.String()] = ref
+		}
+	}
+	for name, q := range s.Queues {
+		for _, b := range q.Bindings {
+			ref := newBindingRef(b.Exchange, name, "queue", b.Key, b.Args.Table())
+			ref.nowait = b.Nowait
+			desired[ref.String()] = ref
+		}
+	}
+
+	existing := map[string]bindingRef{}
+	deletions := map[string]Change{}
+	for _, b := range bindings {
+		if b.Source == "" {
+			continue
+		}
+		ref := newBindingRef(b.Source, b.Destination, b.DestinationType, b.RoutingKey, b.Arguments)
+		if by := recreatedBy(recreated, b); by != "" {
+			if _, ok := desired[ref.String()]; !ok {
+				deletions[ref.String()] = Change{Action: ActionDelete, Kind: "binding", Name: ref.String(), Reason: "dropped by recreating " + by, apply: unbind(ref)}
+			}
+			continue
+		}
+		if _, ok := s.Exchanges[b.Destination]; b.DestinationType == "exchange" && !ok {
+			continue
+		}
+		if _, ok := s.Queues[b.Destination]; b.DestinationType == "queue" && !ok {
+			continue
+		}
+		existing[ref.String()] = ref
+		if _, ok := desired[ref.String()]; !ok {
+			deletions[ref.String()] = Change{Action: ActionDelete, Kind: "binding", Name: ref.String(), Reason: "not in scheme", apply: unbind(ref)}
+		}
+	}
+
+	plan := &Plan{}
+	keys := make([]string, 0, len(deletions))
+	for key := range deletions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		plan.Changes = append(plan.Changes, deletions[key])
+	}
+	plan.Changes = append(plan.Changes, entities...)
+	for _, key := range sortedRefs(desired) {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		ref := desired[key]
+		plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Kind: "binding", Name: key, apply: func(ch *amqp.Channel) error {
+			if ref.destType == "exchange" {
+				return ch.ExchangeBind(ref.dest, ref.key, ref.source, ref.nowait, ref.table)
+			}
+			return ch.QueueBind(ref.dest, ref.key, ref.source, ref.nowait, ref.table)
+		}})
+	}
+	return plan, nil
+}
+
+// recreatedBy names the recreated entity a broker binding belongs to, if any
+func recreatedBy(recreated map[string]bool, b brokerBinding) string {
+	if recreated["exchange:"+b.Source] {
+		return "exchange " + b.Source
+	}
+	if recreated[b.DestinationType+":"+b.Destination] {
+		return b.DestinationType + " " + b.Destination
+	}
+	return ""
+}
+
+func unbind(ref bindingRef) func(ch *amqp.Channel) error {
+	return func(ch *amqp.Channel) error {
+		if ref.destType == "exchange" {
+			return ch.ExchangeUnbind(ref.dest, ref.key, ref.source, false, ref.table)
+		}
+		return ch.QueueUnbind(ref.dest, ref.key, ref.source, ref.table)
+	}
+}
+
+// ApplyPlan executes the changes of a plan in order and stops at the first failure
+func (c *Connection) ApplyPlan(p *Plan) error {
+	for _, change := range p.Changes {
+		ch, err := c.Channel()
+		if err != nil {
+			return err
+		}
+		err = change.apply(ch)
+		ch.Close()
+		if err != nil {
+			return fmt.Errorf("apply %q: %w", change.String(), err)
+		}
+	}
+	return nil
+}
+
+func newBindingRef(source, dest, destType, key string, args map[string]interface{}) bindingRef {
+	return bindingRef{
+		source:   source,
+		dest:     dest,
+		destType: destType,
+		key:      key,
+		args:     canonicalArgs(args),
+		table:    amqp.Table(args),
+	}
+}
+
+func exchangeDiff(e Exchange, cur brokerExchange) string {
+	var diffs []string
+	diffs = appendDiff(diffs, "type", cur.Type, e.Type)
+	diffs = appendDiff(diffs, "durable", cur.Durable, e.Durable)
+	diffs = appendDiff(diffs, "autodelete", cur.AutoDelete, e.AutoDelete)
+	diffs = appendDiff(diffs, "internal", cur.Internal, e.Internal)
+	diffs = appendDiff(diffs, "args", canonicalArgs(cur.Arguments), canonicalArgs(e.Args.Table()))
+	return strings.Join(diffs, ", ")
+}
+
+func queueDiff(q QueueSpec, cur brokerQueue) string {
+	var diffs []string
+	diffs = appendDiff(diffs, "durable", cur.Durable, q.Durable)
+	diffs = appendDiff(diffs, "autodelete", cur.AutoDelete, q.AutoDelete)
+	diffs = appendDiff(diffs, "exclusive", cur.Exclusive, q.Exclusive)
+	diffs = appendDiff(diffs, "args", canonicalArgs(cur.Arguments), canonicalArgs(q.Args.Table()))
+	return strings.Join(diffs, ", ")
+}
+
+func appendDiff(diffs []string, field string, current, desired interface{}) []string {
+	if current == desired {
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("%s %v -> %v", field, current, desired))
+}
+
+// canonicalArgs renders arguments with sorted keys and numbers as floats,
+// so values decoded from yaml and from the management API compare equal
+func canonicalArgs(args map[string]interface{}) string {
+	b, err := json.Marshal(normalizeArg(map[string]interface{}(args)))
+	if err != nil || string(b) == "null" {
+		return "{}"
+	}
+	return string(b)
+}
+
+func normalizeArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeArg(item)
+		}
+		return list
+	case amqp.Table:
+		return normalizeArg(map[string]interface{}(v))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = normalizeArg(item)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+func sortedRefs(m map[string]bindingRef) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
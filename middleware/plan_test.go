@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const planScheme = `
+exchanges:
+  wisp.market:
+    type: topic
+    durable: true
+queues:
+  market.kline:
+    durable: true
+    args:
+      x-message-ttl: 60000
+    bindings:
+      - exchange: wisp.market
+        key: "*.*.kline.#"
+`
+
+const (
+	stubMarket      = `{"name":"wisp.market","type":"topic","durable":true,"arguments":{}}`
+	stubKline       = `{"name":"market.kline","durable":true,"arguments":{"x-message-ttl":60000}}`
+	stubBinding     = `{"source":"wisp.market","destination":"market.kline","destination_type":"queue","routing_key":"*.*.kline.#","arguments":{}}`
+	stubDefault     = `{"source":"","destination":"market.kline","destination_type":"queue","routing_key":"market.kline","arguments":{}}`
+	klineBindingRef = "wisp.market -> queue market.kline [*.*.kline.#]"
+)
+
+// newManagementStub serves fixed JSON per resource of the management API
+func newManagementStub(t *testing.T, status int, resources map[string]string) (*httptest.Server, *Management) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "guest" || password != "secret" {
+			t.Errorf("basic auth = %s:%s", user, password)
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		for resource, body := range resources {
+			if r.URL.EscapedPath() == "/api/"+resource+"/%2F" {
+				w.Write([]byte(body))
+				return
+			}
+		}
+		w.Write([]byte("[]"))
+	}))
+	m, err := NewManagement(strings.Replace(srv.URL, "http://", "http://guest:secret@", 1), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, m
+}
+
+func TestManagementPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		resources map[string]string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:   "empty broker",
+			status: http.StatusOK,
+			want: []string{
+				"+ exchange wisp.market (topic)",
+				"+ queue market.kline",
+				"+ binding " + klineBindingRef,
+			},
+		},
+		{
+			name:   "in sync",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": "[" + stubMarket + "]",
+				"queues":    "[" + stubKline + "]",
+				"bindings":  "[" + stubBinding + "," + stubDefault + "]",
+			},
+		},
+		{
+			name:   "queue args changed",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": "[" + stubMarket + "]",
+				"queues":    `[{"name":"market.kline","durable":true,"arguments":{"x-message-ttl":1000}}]`,
+				"bindings":  "[" + stubBinding + "]",
+			},
+			want: []string{
+				`~ queue market.kline (args {"x-message-ttl":1000} -> {"x-message-ttl":60000}, messages will be lost)`,
+				"+ binding " + klineBindingRef,
+			},
+		},
+		{
+			name:   "exchange type changed",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": `[{"name":"wisp.market","type":"fanout","durable":true,"arguments":{}}]`,
+				"queues":    "[" + stubKline + "]",
+				"bindings":  "[" + stubBinding + "]",
+			},
+			want: []string{
+				"~ exchange wisp.market (type fanout -> topic)",
+				"+ binding " + klineBindingRef,
+			},
+		},
+		{
+			name:   "exchange recreated drops undeclared bindings",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": `[{"name":"wisp.market","type":"fanout","durable":true,"arguments":{}}]`,
+				"queues":    "[" + stubKline + `,{"name":"other","durable":true}]`,
+				"bindings":  "[" + stubBinding + `,{"source":"wisp.market","destination":"other","destination_type":"queue","routing_key":"#","arguments":{}}]`,
+			},
+			want: []string{
+				"- binding wisp.market -> queue other [#] (dropped by recreating exchange wisp.market)",
+				"~ exchange wisp.market (type fanout -> topic)",
+				"+ binding " + klineBindingRef,
+			},
+		},
+		{
+			name:   "queue recreated drops bindings from undeclared exchanges",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": "[" + stubMarket + "]",
+				"queues":    `[{"name":"market.kline","durable":false,"arguments":{"x-message-ttl":60000}}]`,
+				"bindings":  "[" + stubBinding + "," + stubDefault + `,{"source":"amq.topic","destination":"market.kline","destination_type":"queue","routing_key":"#","arguments":{}}]`,
+			},
+			want: []string{
+				"- binding amq.topic -> queue market.kline [#] (dropped by recreating queue market.kline)",
+				"~ queue market.kline (durable false -> true, messages will be lost)",
+				"+ binding " + klineBindingRef,
+			},
+		},
+		{
+			name:   "stale binding",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": "[" + stubMarket + "]",
+				"queues":    "[" + stubKline + "]",
+				"bindings":  "[" + stubBinding + `,{"source":"wisp.market","destination":"market.kline","destination_type":"queue","routing_key":"#","arguments":{}}]`,
+			},
+			want: []string{"- binding wisp.market -> queue market.kline [#] (not in scheme)"},
+		},
+		{
+			name:   "undeclared queue left alone",
+			status: http.StatusOK,
+			resources: map[string]string{
+				"exchanges": "[" + stubMarket + "]",
+				"queues":    "[" + stubKline + `,{"name":"other","durable":true}]`,
+				"bindings":  "[" + stubBinding + `,{"source":"wisp.market","destination":"other","destination_type":"queue","routing_key":"#","arguments":{}}]`,
+			},
+		},
+		{
+			name:    "management error",
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+	}
+
+	settings, err := DecodeYaml(strings.NewReader(planScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, m := newManagementStub(t, tt.status, tt.resources)
+			defer srv.Close()
+
+			plan, err := m.Plan(settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, c := range plan.Changes {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if plan.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v", plan.Empty())
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNacked is returned when the broker negatively acknowledges a message
+	ErrNacked = errors.New("middleware: message nacked by broker")
+	// ErrConfirmTimeout is returned when no confirmation arrives within PublisherOptions.ConfirmTimeout
+	ErrConfirmTimeout = errors.New("middleware: publish confirm timed out")
+)
+
+// confirmations are read after a whole batch has been published,
+// buffer them so the connection reader isn't blocked meanwhile
+const confirmBufferSize = 1024
+
+// PublisherOptions configures a Publisher
+type PublisherOptions struct {
+	PoolSize int `yaml:"pool_size"`
+	// Confirm enables confirm mode, nil keeps the default so a yaml section
+	// without confirm doesn't silently turn it off
+	Confirm        *bool         `yaml:"confirm"`
+	ConfirmTimeout time.Duration `yaml:"confirm_timeout"`
+}
+
+// DefaultPublisherOptions keeps 4 channels in confirm mode
+func DefaultPublisherOptions() PublisherOptions {
+	return PublisherOptions{
+		PoolSize:       4,
+		Confirm:        Bool(true),
+		ConfirmTimeout: 5 * time.Second,
+	}
+}
+
+func (o PublisherOptions) withDefaults() PublisherOptions {
+	def := DefaultPublisherOptions()
+	if o.PoolSize <= 0 {
+		o.PoolSize = def.PoolSize
+	}
+	if o.Confirm == nil {
+		o.Confirm = def.Confirm
+	}
+	if o.ConfirmTimeout <= 0 {
+		o.ConfirmTimeout = def.ConfirmTimeout
+	}
+	return o
+}
+
+func (o PublisherOptions) confirm() bool {
+	return o.Confirm == nil || *o.Confirm
+}
+
+// Bool returns a pointer to b, for optional settings such as PublisherOptions.Confirm
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Message is a single message to publish
+type Message struct {
+	Exchange    string
+	Key         string
+	Body        []byte
+	ContentType string
+	Headers     amqp.Table
+	Persistent  bool
+	// Mandatory messages that can't be routed to any queue are handed to the return handler
+	Mandatory bool
+}
+
+func (m Message) publishing() amqp.Publishing {
+	p := amqp.Publishing{
+		ContentType:  m.ContentType,
+		Headers:      m.Headers,
+		DeliveryMode: amqp.Transient,
+		Timestamp:    time.Now(),
+		Body:         m.Body,
+	}
+	if m.Persistent {
+		p.DeliveryMode = amqp.Persistent
+	}
+	return p
+}
+
+// Publisher publishes over a pool of long-lived channels, optionally in confirm mode
+type Publisher struct {
+	conn     *Connection
+	opts     PublisherOptions
+	pool     chan *pubChannel
+	channel  func() (amqpChannel, error)
+	mu       sync.RWMutex
+	onReturn func(amqp.Return)
+}
+
+// amqpChannel is the part of *amqp.Channel the publisher relies on
+type amqpChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+type pubChannel struct {
+	ch       amqpChannel
+	confirms chan amqp.Confirmation
+	closed   chan *amqp.Error
+}
+
+// NewPublisher creates a publisher on the connection, pooled channels are
+// dropped and lazily reopened after the connection is recovered
+func NewPublisher(conn *Connection, opts PublisherOptions) *Publisher {
+	opts = opts.withDefaults()
+	p := &Publisher{
+		conn:    conn,
+		opts:    opts,
+		pool:    make(chan *pubChannel, opts.PoolSize),
+		channel: conn.openChannel,
+		onReturn: func(r amqp.Return) {
+			logger.Warn("消息无法路由被退回: exchange=%s key=%s reply=%s\n", r.Exchange, r.RoutingKey, r.ReplyText)
+		},
+	}
+	conn.NotifyReconnect(p.drain)
+	return p
+}
+
+// SetReturnHandler sets the function receiving unroutable mandatory messages
+func (p *Publisher) SetReturnHandler(f func(amqp.Return)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onReturn = f
+}
+
+func (p *Publisher) returnHandler() func(amqp.Return) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.onReturn
+}
+
+// Publish sends a message and, in confirm mode, waits for the broker confirmation
+func (p *Publisher) Publish(m Message) error {
+	return p.publish(m.Exchange, m.Key, m.Mandatory, m.publishing())
+}
+
+// PublishBatch sends all messages on one channel and waits for all confirmations at once
+func (p *Publisher) PublishBatch(msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	pc, err := p.acquire()
+	if err == ErrNotConnected {
+		for _, m := range msgs {
+			if err := p.conn.handleOutage(m.Exchange, m.Key, m.publishing()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, m := range msgs {
+		if err := pc.ch.Publish(m.Exchange, m.Key, m.Mandatory, false, m.publishing()); err != nil {
+			pc.ch.Close()
+			return fmt.Errorf("middleware: batch publish failed at message %d: %v", i, err)
+		}
+	}
+	if !p.opts.confirm() {
+		p.release(pc)
+		return nil
+	}
+
+	nacked := 0
+	for range msgs {
+		ok, err := p.waitConfirm(pc)
+		if err != nil {
+			pc.ch.Close()
+			return err
+		}
+		if !ok {
+			nacked++
+		}
+	}
+	p.release(pc)
+	if nacked > 0 {
+		return fmt.Errorf("%w: %d of %d messages", ErrNacked, nacked, len(msgs))
+	}
+	return nil
+}
+
+func (p *Publisher) publish(ex, key string, mandatory bool, msg amqp.Publishing) error {
+	pc, err := p.acquire()
+	if err == ErrNotConnected {
+		return p.conn.handleOutage(ex, key, msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := pc.ch.Publish(ex, key, mandatory, false, msg); err != nil {
+		pc.ch.Close()
+		if !p.conn.connected() {
+			return p.conn.handleOutage(ex, key, msg)
+		}
+		return err
+	}
+	if !p.opts.confirm() {
+		p.release(pc)
+		return nil
+	}
+
+	ok, err := p.waitConfirm(pc)
+	if err != nil {
+		// confirmations on this channel can no longer be matched to messages
+		pc.ch.Close()
+		return err
+	}
+	p.release(pc)
+	if !ok {
+		return ErrNacked
+	}
+	return nil
+}
+
+func (p *Publisher) waitConfirm(pc *pubChannel) (bool, error) {
+	select {
+	case c, ok := <-pc.confirms:
+		if !ok {
+			return false, ErrNotConnected
+		}
+		return c.Ack, nil
+	case <-time.After(p.opts.ConfirmTimeout):
+		return false, ErrConfirmTimeout
+	}
+}
+
+// acquire takes an idle channel from the pool or opens a new one
+func (p *Publisher) acquire() (*pubChannel, error) {
+	for {
+		select {
+		case pc := <-p.pool:
+			select {
+			case <-pc.closed:
+				continue
+			default:
+				return pc, nil
+			}
+		default:
+			return p.open()
+		}
+	}
+}
+
+// release returns a channel to the pool, closing it if the pool is full
+func (p *Publisher) release(pc *pubChannel) {
+	select {
+	case p.pool <- pc:
+	default:
+		pc.ch.Close()
+	}
+}
+
+// drain closes all idle channels, they belong to a connection that is gone
+func (p *Publisher) drain() {
+	for {
+		select {
+		case pc := <-p.pool:
+			pc.ch.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (p *Publisher) open() (*pubChannel, error) {
+	ch, err := p.channel()
+	if err != nil {
+		if err != ErrConnectionClosed && !p.conn.connected() {
+			return nil, ErrNotConnected
+		}
+		return nil, err
+	}
+	pc := &pubChannel{
+		ch:     ch,
+		closed: ch.NotifyClose(make(chan *amqp.Error, 1)),
+	}
+	if p.opts.confirm() {
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		pc.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, confirmBufferSize))
+	}
+
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	go func() {
+		for r := range returns {
+			if f := p.returnHandler(); f != nil {
+				f(r)
+			}
+		}
+	}()
+	return pc, nil
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublisherConfirmDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{"no publisher section", "connection:\n  outage_policy: drop\n", true},
+		{"confirm omitted", "publisher:\n  pool_size: 2\n", true},
+		{"confirm true", "publisher:\n  confirm: true\n", true},
+		{"confirm false", "publisher:\n  confirm: false\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := DecodeYaml(strings.NewReader(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Publisher.Options.withDefaults().confirm(); got != tt.want {
+				t.Errorf("confirm = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeChannel confirms every publish right away unless the routing key is
+// listed in nack or silent, and returns mandatory messages keyed "unroutable"
+type fakeChannel struct {
+	sync.Mutex
+	confirm  bool
+	nack     map[string]bool
+	silent   map[string]bool
+	keys     []string
+	msgs     []amqp.Publishing
+	seq      uint64
+	closed   bool
+	confirms []chan amqp.Confirmation
+	returns  []chan amqp.Return
+	notify   []chan *amqp.Error
+}
+
+func (f *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.closed {
+		return amqp.ErrClosed
+	}
+	if key == "broken" {
+		return errors.New("frame too large")
+	}
+	f.keys = append(f.keys, key)
+	f.msgs = append(f.msgs, msg)
+	f.seq++
+	if f.confirm && !f.silent[key] {
+		for _, c := range f.confirms {
+			c <- amqp.Confirmation{DeliveryTag: f.seq, Ack: !f.nack[key]}
+		}
+	}
+	if mandatory && key == "unroutable" {
+		for _, c := range f.returns {
+			c <- amqp.Return{Exchange: exchange, RoutingKey: key, ReplyText: "NO_ROUTE"}
+		}
+	}
+	return nil
+}
+
+func (f *fakeChannel) Confirm(noWait bool) error {
+	f.Lock()
+	defer f.Unlock()
+	f.confirm = true
+	return nil
+}
+
+func (f *fakeChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	f.Lock()
+	defer f.Unlock()
+	f.confirms = append(f.confirms, confirm)
+	return confirm
+}
+
+func (f *fakeChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	f.Lock()
+	defer f.Unlock()
+	f.returns = append(f.returns, c)
+	return c
+}
+
+func (f *fakeChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	f.Lock()
+	defer f.Unlock()
+	f.notify = append(f.notify, c)
+	return c
+}
+
+func (f *fakeChannel) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.closed {
+		return amqp.ErrClosed
+	}
+	f.closed = true
+	for _, c := range f.confirms {
+		close(c)
+	}
+	for _, c := range f.returns {
+		close(c)
+	}
+	for _, c := range f.notify {
+		close(c)
+	}
+	return nil
+}
+
+func (f *fakeChannel) isClosed() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.closed
+}
+
+func (f *fakeChannel) published() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.keys...)
+}
+
+// fakeChannels opens fakeChannels for a publisher and remembers them
+type fakeChannels struct {
+	sync.Mutex
+	opened []*fakeChannel
+}
+
+func (f *fakeChannels) open() (amqpChannel, error) {
+	f.Lock()
+	defer f.Unlock()
+	ch := &fakeChannel{
+		nack:   map[string]bool{"nacked": true},
+		silent: map[string]bool{"silent": true},
+	}
+	f.opened = append(f.opened, ch)
+	return ch, nil
+}
+
+func (f *fakeChannels) channels() []*fakeChannel {
+	f.Lock()
+	defer f.Unlock()
+	return append([]*fakeChannel(nil), f.opened...)
+}
+
+func newTestPublisher(t *testing.T, opts PublisherOptions) (*Publisher, *fakeChannels, *Connection) {
+	c, _, _ := connectFake(t, Options{})
+	p := NewPublisher(c, opts)
+	channels := &fakeChannels{}
+	p.channel = channels.open
+	return p, channels, c
+}
+
+func TestPublisherConfirm(t *testing.T) {
+	tests := []struct {
+		name       string
+		confirm    bool
+		key        string
+		wantErr    error
+		wantPooled bool
+	}{
+		{"ack", true, "a", nil, true},
+		{"nack", true, "nacked", ErrNacked, true},
+		{"timeout", true, "silent", ErrConfirmTimeout, false},
+		{"no confirm mode", false, "nacked", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, channels, c := newTestPublisher(t, PublisherOptions{Confirm: Bool(tt.confirm), ConfirmTimeout: 50 * time.Millisecond})
+			defer c.Close()
+
+			if err := p.Publish(Message{Exchange: "market", Key: tt.key}); err != tt.wantErr {
+				t.Errorf("Publish() = %v, want %v", err, tt.wantErr)
+			}
+			opened := channels.channels()
+			if len(opened) != 1 || opened[0].confirm != tt.confirm {
+				t.Fatalf("opened %d channels, want 1 with confirm mode %v", len(opened), tt.confirm)
+			}
+			// after a timeout the confirmations can no longer be matched, so
+			// the channel is closed instead of going back to the pool
+			if pooled := len(p.pool) == 1; pooled != tt.wantPooled || opened[0].isClosed() == tt.wantPooled {
+				t.Errorf("channel pooled %v, closed %v, want pooled %v", pooled, opened[0].isClosed(), tt.wantPooled)
+			}
+		})
+	}
+}
+
+func TestPublisherBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []string
+		wantErr    string
+		wantClosed bool
+	}{
+		{"all acked", []string{"a", "b", "c"}, "", false},
+		{"nacked", []string{"a", "nacked", "c", "nacked"}, "2 of 4 messages", false},
+		{"publish failed", []string{"a", "broken", "c"}, "failed at message 1", true},
+		{"timeout", []string{"a", "silent"}, ErrConfirmTimeout.Error(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, channels, c := newTestPublisher(t, PublisherOptions{ConfirmTimeout: 50 * time.Millisecond})
+			defer c.Close()
+
+			var msgs []Message
+			for _, key := range tt.keys {
+				msgs = append(msgs, Message{Exchange: "market", Key: key})
+			}
+			err := p.PublishBatch(msgs)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("PublishBatch() = %v, want %q", err, tt.wantErr)
+			}
+			if tt.name == "nacked" && !errors.Is(err, ErrNacked) {
+				t.Errorf("PublishBatch() = %v, want it to wrap %v", err, ErrNacked)
+			}
+
+			// the whole batch goes out on one channel
+			opened := channels.channels()
+			if len(opened) != 1 {
+				t.Fatalf("opened %d channels, want 1", len(opened))
+			}
+			if got := opened[0].published(); !tt.wantClosed && !reflect.DeepEqual(got, tt.keys) {
+				t.Errorf("published %v, want %v", got, tt.keys)
+			}
+			if opened[0].isClosed() != tt.wantClosed {
+				t.Errorf("channel closed %v, want %v", opened[0].isClosed(), tt.wantClosed)
+			}
+		})
+	}
+
+	p, channels, c := newTestPublisher(t, PublisherOptions{})
+	defer c.Close()
+	if err := p.PublishBatch(nil); err != nil || len(channels.channels()) != 0 {
+		t.Errorf("PublishBatch(nil) = %v and opened %d channels, want no channel", err, len(channels.channels()))
+	}
+}
+
+func TestPublisherPool(t *testing.T) {
+	p, channels, c := newTestPublisher(t, PublisherOptions{PoolSize: 2})
+	defer c.Close()
+
+	var acquired []*pubChannel
+	for i := 0; i < 3; i++ {
+		pc, err := p.acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		acquired = append(acquired, pc)
+	}
+	for _, pc := range acquired {
+		p.release(pc)
+	}
+	opened := channels.channels()
+	if len(opened) != 3 || len(p.pool) != 2 || !opened[2].isClosed() {
+		t.Fatalf("opened %d channels, pooled %d, want 3 opened and the one beyond PoolSize closed", len(opened), len(p.pool))
+	}
+
+	// idle channels are reused, a channel closed by the broker is skipped
+	opened[0].Close()
+	pc, err := p.acquire()
+	if err != nil || pc.ch != opened[1] {
+		t.Fatalf("acquire() = %v, %v, want the open pooled channel", pc, err)
+	}
+	p.release(pc)
+
+	// after a reconnect the idle channels belong to the old connection
+	p.drain()
+	if len(p.pool) != 0 || !opened[1].isClosed() {
+		t.Errorf("drain left %d channels in the pool", len(p.pool))
+	}
+	if _, err := p.acquire(); err != nil || len(channels.channels()) != 4 {
+		t.Errorf("acquire() after drain = %v, opened %d channels, want a new one", err, len(channels.channels()))
+	}
+}
+
+func TestPublisherReturnHandler(t *testing.T) {
+	p, _, c := newTestPublisher(t, PublisherOptions{})
+	defer c.Close()
+	returned := make(chan amqp.Return, 2)
+	unroutable := Message{Exchange: "market", Key: "unroutable", Mandatory: true}
+
+	// the handler is replaced while the channel's goroutine delivers a return
+	published := make(chan error, 1)
+	go func() { published <- p.Publish(unroutable) }()
+	p.SetReturnHandler(func(r amqp.Return) { returned <- r })
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(unroutable); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-returned:
+		if r.RoutingKey != "unroutable" || r.ReplyText != "NO_ROUTE" {
+			t.Errorf("returned %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("return handler not called")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+	"wisp/config"
+	"wisp/log"
+)
+
+var (
+	currentConfig *config.Config
+	reloadL       sync.Mutex
+)
+
+//收到SIGHUP时重新加载配置
+func handleReloadSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			log.Info("收到SIGHUP，重新加载配置\n")
+			reloadConfig()
+		}
+	}()
+}
+
+//定期检查配置文件的修改时间及大小，变化后重新加载
+func watchConfig(path string, interval time.Duration) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	modTime, size := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t, n := stat()
+		if n < 0 || (t.Equal(modTime) && n == size) {
+			continue
+		}
+		modTime, size = t, n
+		log.Info("配置文件 %s 已修改，重新加载配置\n", path)
+		reloadConfig()
+	}
+}
+
+//重新加载配置，行情订阅按差异变更，日志等级即时生效，其余配置变更需重启
+//新配置校验失败时沿用当前配置
+func reloadConfig() {
+	reloadL.Lock()
+	defer reloadL.Unlock()
+
+	cfg, err := config.Load(*confFile)
+	if err != nil {
+		log.Error("配置重新加载失败，沿用当前配置: %v\n", err.Error())
+		return
+	}
+	old := currentConfig
+
+	for _, ex := range cfg.Exchanges {
+		if _, ok := subscriptions.Exchange(ex.Name); !ok {
+			startExchange(cfg, ex)
+		} else if prev, ok := old.Exchange(ex.Name); ok && !sameConnection(old, prev, cfg, ex) {
+			log.Warn("交易所 %s 的代理、密钥或交易对刷新配置已变更，重启后生效\n", ex.Name)
+		}
+	}
+	added, removed, err := subscriptions.Apply(cfg.Subscriptions())
+	for _, sub := range added {
+		log.Info("新增订阅: %s\n", sub.String())
+	}
+	for _, sub := range removed {
+		log.Info("取消订阅: %s\n", sub.String())
+	}
+	if err != nil {
+		log.Error("部分订阅变更失败: %v\n", err.Error())
+	}
+
+	reloadLogLevels(old.Log, cfg.Log)
+	if old.Server != cfg.Server {
+		log.Warn("server 配置已变更，重启后生效\n")
+	}
+	if !reflect.DeepEqual(old.Sinks, cfg.Sinks) {
+		log.Warn("sinks 配置已变更，重启后生效\n")
+	}
+	if !sameLogSettings(old.Log, cfg.Log) {
+		log.Warn("log 中等级以外的配置已变更，重启后生效\n")
+	}
+	currentConfig = cfg
+	log.Info("配置重新加载完成，新增订阅 %d 项，取消订阅 %d 项\n", len(added), len(removed))
+}
+
+//全局及模块日志等级即时生效，新配置中移除的模块恢复沿用全局等级
+func reloadLogLevels(old, cfg config.LogConfig) {
+	log.SetLevel("", log.ParseLevel(cfg.Level))
+	for module := range old.Modules {
+		if _, ok := cfg.Modules[module]; !ok {
+			log.Named(module).ResetLevel()
+		}
+	}
+	for module, level := range cfg.Modules {
+		log.SetLevel(module, log.ParseLevel(level))
+	}
+}
+
+func sameLogSettings(old, cfg config.LogConfig) bool {
+	old.Level, old.Modules = "", nil
+	cfg.Level, cfg.Modules = "", nil
+	return reflect.DeepEqual(old, cfg)
+}
+
+//交易所连接相关的配置是否相同，订阅以外的变更需要重建连接
+func sameConnection(oldCfg *config.Config, old config.ExchangeConfig, cfg *config.Config, ex config.ExchangeConfig) bool {
+	return oldCfg.ProxyUrl(old) == cfg.ProxyUrl(ex) && old.ApiKey == ex.ApiKey && old.SecretKey == ex.SecretKey && old.SymbolRefresh == ex.SymbolRefresh
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"wisp/common"
+	"wisp/exchange"
+	"wisp/log"
+)
+
+var adminLog = log.Named("admin")
+
+//管理接口鉴权，token不为空时要求请求携带 Authorization: Bearer <token>
+func AdminAuth(token string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if token != "" && !checkToken(bearerToken(req), token) {
+			adminLog.Warn("管理接口鉴权失败: %s %s %s\n", req.RemoteAddr, req.Method, req.URL.Path)
+			res.Header().Set("WWW-Authenticate", `Bearer realm="wisp"`)
+			http.Error(res, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
+
+func bearerToken(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+//按固定时间比较，避免通过响应时间猜测令牌
+func checkToken(got, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+//行情订阅管理接口
+//GET 返回当前订阅；POST 新增订阅，DELETE 取消订阅，参数为
+//exchange、symbol、channel，深度可指定 size(默认5)，K线可指定 period(默认1m)
+//运行时的变更不写回配置文件，重新加载配置时以配置文件为准
+func SubscriptionsHandler(manager *exchange.Manager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+			sub, err := parseSubscription(req)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Method == http.MethodDelete {
+				err = manager.Unsubscribe(sub)
+			} else {
+				err = manager.Subscribe(sub)
+			}
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusConflict)
+				return
+			}
+			adminLog.Warn("订阅已变更: %s %s\n", req.Method, sub.String())
+		default:
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(manager.Subscriptions())
+	}
+}
+
+func parseSubscription(req *http.Request) (common.Subscription, error) {
+	sub := common.Subscription{
+		Exchange: req.FormValue("exchange"),
+		Symbol:   req.FormValue("symbol"),
+		Channel:  req.FormValue("channel"),
+	}
+	if sub.Exchange == "" || sub.Symbol == "" || sub.Channel == "" {
+		return sub, fmt.Errorf("exchange、symbol 及 channel 不能为空")
+	}
+	switch sub.Channel {
+	case common.CHANNEL_DEPTH:
+		sub.Param = 5
+		if size := req.FormValue("size"); size != "" {
+			n, err := strconv.Atoi(size)
+			if err != nil {
+				return sub, fmt.Errorf("深度档数错误: %s", size)
+			}
+			sub.Param = n
+		}
+	case common.CHANNEL_KLINE:
+		sub.Param = common.KLINE_PERIOD_1MIN
+		if period := req.FormValue("period"); period != "" {
+			p, ok := common.ParseKlinePeriod(period)
+			if !ok {
+				return sub, fmt.Errorf("未知的K线周期: %s", period)
+			}
+			sub.Param = p
+		}
+	case common.CHANNEL_TICKER, common.CHANNEL_TRADE:
+	default:
+		return sub, fmt.Errorf("未知的频道: %s", sub.Channel)
+	}
+	return sub, nil
+}
+
+//交易所连接状态接口，GET 返回各交易所的连接: 建立时间、最近消息时间、重连次数及数据流
+func ConnectionsHandler(manager *exchange.Manager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(manager.Connections())
+	}
+}
+
+//强制重连接口，POST ?exchange=binance&id=3
+func ReconnectHandler(manager *exchange.Manager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(req.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(res, "连接编号错误: "+req.FormValue("id"), http.StatusBadRequest)
+			return
+		}
+		if err := manager.Reconnect(req.FormValue("exchange"), id); err != nil {
+			http.Error(res, err.Error(), http.StatusBadGateway)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(manager.Connections())
+	}
+}
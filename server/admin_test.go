@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wisp/common"
+)
+
+func TestParseSubscription(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    common.Subscription
+		wantErr bool
+	}{
+		{"exchange=binance&symbol=btcusdt&channel=ticker", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_TICKER}, false},
+		{"exchange=binance&symbol=btcusdt&channel=trade", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_TRADE}, false},
+		{"exchange=binance&symbol=btcusdt&channel=depth", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_DEPTH, Param: 5}, false},
+		{"exchange=binance&symbol=btcusdt&channel=depth&size=20", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_DEPTH, Param: 20}, false},
+		{"exchange=binance&symbol=btcusdt&channel=depth&size=x", common.Subscription{}, true},
+		{"exchange=binance&symbol=btcusdt&channel=kline", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_KLINE, Param: common.KLINE_PERIOD_1MIN}, false},
+		{"exchange=binance&symbol=btcusdt&channel=kline&period=5m", common.Subscription{Exchange: "binance", Symbol: "btcusdt", Channel: common.CHANNEL_KLINE, Param: common.KLINE_PERIOD_5MIN}, false},
+		{"exchange=binance&symbol=btcusdt&channel=kline&period=7m", common.Subscription{}, true},
+		{"exchange=binance&symbol=btcusdt&channel=orders", common.Subscription{}, true},
+		{"exchange=binance&symbol=btcusdt", common.Subscription{}, true},
+		{"exchange=binance&channel=ticker", common.Subscription{}, true},
+		{"symbol=btcusdt&channel=ticker", common.Subscription{}, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/admin/subscriptions?"+tt.query, nil)
+		got, err := parseSubscription(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSubscription(%q) err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseSubscription(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"token prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+		{"basic scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"bare token", "secret", "secret", http.StatusUnauthorized},
+	}
+	ok := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin/connections", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		AdminAuth(tt.token, ok).ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: missing WWW-Authenticate", tt.name)
+		}
+	}
+}
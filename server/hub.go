@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"wisp/codec"
+	"wisp/common"
+	"wisp/log"
+)
+
+const (
+	clientSendSize  = 256              //客户端发送队列长度，写满时断开慢客户端
+	maxClientTopics = 100              //每个客户端最多订阅的主题模式数
+	maxTopicWords   = 16               //主题模式最多的单词数
+	writeWait       = 10 * time.Second //单条消息写超时
+	pongWait        = 60 * time.Second //等待pong的超时时间
+	pingPeriod      = pongWait * 9 / 10
+)
+
+var serverLog = log.Named("server")
+
+//客户端请求，topics为主题模式，*匹配一个单词，#匹配零或多个单词，如 binance.*.ticker、*.btcusdt.#
+type clientRequest struct {
+	Op       string   `json:"op"` //subscribe、unsubscribe 或 encoding
+	Topics   []string `json:"topics"`
+	Encoding string   `json:"encoding"` //行情编码: json、protobuf 或 msgpack
+}
+
+//待发送的消息，binary为true时以二进制帧发送
+type frame struct {
+	binary bool
+	data   []byte
+}
+
+//websocket客户端
+type client struct {
+	hub        *Hub
+	conn       *websocket.Conn
+	send       chan frame
+	codec      codec.Codec
+	topics     map[string]bool
+	authorized bool //携带用户数据令牌，可接收用户数据事件
+	closed     bool
+}
+
+//websocket推送中心，按客户端订阅的主题分发行情
+type Hub struct {
+	sync.RWMutex
+	clients   map[*client]bool
+	closing   bool           //关闭后拒绝新的客户端
+	writers   sync.WaitGroup //客户端发送协程，关闭时等待关闭帧发出
+	userToken string         //接收用户数据所需的令牌，为空时不向任何客户端推送用户数据
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*client]bool)}
+}
+
+//设置用户数据令牌，客户端通过 Authorization: Bearer <token> 请求头或 ?token= 参数提供
+func (this *Hub) SetUserToken(token string) {
+	this.Lock()
+	defer this.Unlock()
+	this.userToken = token
+}
+
+func (this *Hub) authorize(req *http.Request) bool {
+	this.RLock()
+	token := this.userToken
+	this.RUnlock()
+	got := bearerToken(req)
+	if got == "" {
+		got = req.URL.Query().Get("token")
+	}
+	return checkToken(got, token)
+}
+
+//websocket接入，客户端连接后发送 {"op":"subscribe","topics":["binance.btcusdt.ticker"]} 订阅主题，
+//行情编码可通过 ?encoding=msgpack 或 {"op":"encoding","encoding":"protobuf"} 指定，默认为json
+//用户数据主题 user.# 仅推送给携带用户数据令牌的客户端
+func (this *Hub) ServeWs(res http.ResponseWriter, req *http.Request) {
+	c := &client{hub: this, send: make(chan frame, clientSendSize), topics: make(map[string]bool)}
+	c.authorized = this.authorize(req)
+	var err error
+	if c.codec, err = codec.Get(req.URL.Query().Get("encoding")); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		serverLog.Error("websocket升级失败: %v\n", err.Error())
+		return
+	}
+	c.conn = conn
+	this.Lock()
+	if this.closing {
+		this.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	this.clients[c] = true
+	this.writers.Add(1)
+	this.Unlock()
+
+	go c.writeLoop()
+	c.readLoop()
+}
+
+//客户端数量
+func (this *Hub) Len() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.clients)
+}
+
+func (this *Hub) Name() string {
+	return "websocket"
+}
+
+//推送行情事件，按客户端选择的编码各编码一次，可作为行情输出使用
+//用户数据事件只推送给携带用户数据令牌的客户端
+//编码在锁外进行，避免编码期间阻塞客户端接入、订阅及其他事件的推送
+func (this *Hub) Publish(ev *common.MarketEvent) error {
+	topic := ev.Topic()
+	userData := ev.IsUserData()
+
+	type target struct {
+		client *client
+		codec  codec.Codec
+	}
+	var targets []target
+	this.RLock()
+	for c := range this.clients {
+		if userData && !c.authorized || !c.subscribed(topic) {
+			continue
+		}
+		targets = append(targets, target{c, c.codec})
+	}
+	this.RUnlock()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	frames := make(map[string]frame)
+	for _, t := range targets {
+		if _, ok := frames[t.codec.Name()]; ok {
+			continue
+		}
+		data, err := t.codec.Encode(ev)
+		if err != nil {
+			return err
+		}
+		frames[t.codec.Name()] = frame{binary: t.codec.Binary(), data: data}
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	for _, t := range targets {
+		//编码期间已断开的客户端跳过
+		if t.client.closed {
+			continue
+		}
+		this.push(t.client, frames[t.codec.Name()])
+	}
+	return nil
+}
+
+//断开所有客户端并等待关闭帧发出
+func (this *Hub) Close() error {
+	return this.Shutdown(context.Background())
+}
+
+//停止接入新客户端，向已有客户端发出队列中剩余的消息及关闭帧，ctx到期时返回错误
+func (this *Hub) Shutdown(ctx context.Context) error {
+	this.Lock()
+	this.closing = true
+	for c := range this.clients {
+		this.remove(c)
+	}
+	this.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		this.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//发送队列已满的慢客户端直接断开，避免阻塞其他客户端，需持有写锁
+func (this *Hub) push(c *client, f frame) {
+	select {
+	case c.send <- f:
+	default:
+		serverLog.Warn("websocket客户端发送队列已满，断开连接: %v\n", c.conn.RemoteAddr())
+		this.remove(c)
+	}
+}
+
+//需持有写锁
+func (this *Hub) remove(c *client) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	delete(this.clients, c)
+	close(c.send)
+}
+
+func (this *client) subscribed(topic string) bool {
+	for pattern := range this.topics {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *client) readLoop() {
+	defer func() {
+		this.hub.Lock()
+		this.hub.remove(this)
+		this.hub.Unlock()
+		this.conn.Close()
+	}()
+	this.conn.SetReadDeadline(time.Now().Add(pongWait))
+	this.conn.SetPongHandler(func(string) error {
+		return this.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := this.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		req := clientRequest{}
+		if err := json.Unmarshal(message, &req); err != nil {
+			serverLog.Warn("websocket客户端请求格式错误: %v\n", string(message))
+			continue
+		}
+
+		if req.Op == "encoding" {
+			c, err := codec.Get(req.Encoding)
+			if err != nil {
+				serverLog.Warn("websocket客户端编码错误: %v\n", err.Error())
+				continue
+			}
+			this.hub.Lock()
+			this.codec = c
+			this.hub.Unlock()
+			continue
+		}
+
+		this.hub.Lock()
+		for _, topic := range req.Topics {
+			pattern, err := ParseTopicPattern(topic)
+			if err != nil {
+				serverLog.Warn("websocket客户端订阅主题错误: %v\n", err.Error())
+				continue
+			}
+			switch req.Op {
+			case "subscribe":
+				if !this.topics[pattern] && len(this.topics) >= maxClientTopics {
+					serverLog.Warn("websocket客户端订阅主题数超过上限 %d，忽略: %s\n", maxClientTopics, pattern)
+					continue
+				}
+				this.topics[pattern] = true
+			case "unsubscribe":
+				delete(this.topics, pattern)
+			}
+		}
+		this.hub.Unlock()
+	}
+}
+
+func (this *client) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		this.conn.Close()
+		this.hub.writers.Done()
+	}()
+
+	for {
+		select {
+		case f, ok := <-this.send:
+			this.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				this.conn.WriteMessage(websocket.CloseMessage, this.hub.closeMessage())
+				return
+			}
+			messageType := websocket.TextMessage
+			if f.binary {
+				messageType = websocket.BinaryMessage
+			}
+			if err := this.conn.WriteMessage(messageType, f.data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			this.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := this.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//服务关闭时告知客户端 1001 going away，以便客户端重连到其他实例
+func (this *Hub) closeMessage() []byte {
+	this.RLock()
+	defer this.RUnlock()
+	if this.closing {
+		return websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	}
+	return []byte{}
+}
+
+//校验并规范化客户端的主题模式: 转为小写，单词不能为空，单词数不超过maxTopicWords，
+//连续的#与单个#等价，合并为一个
+func ParseTopicPattern(pattern string) (string, error) {
+	words := strings.Split(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	if len(words) > maxTopicWords {
+		return "", fmt.Errorf("主题 %q 超过 %d 个单词", pattern, maxTopicWords)
+	}
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		if w == "" {
+			return "", fmt.Errorf("主题 %q 含有空单词", pattern)
+		}
+		if w == "#" && len(res) > 0 && res[len(res)-1] == "#" {
+			continue
+		}
+		res = append(res, w)
+	}
+	return strings.Join(res, "."), nil
+}
+
+//按RabbitMQ主题交换机规则匹配，*匹配一个单词，#匹配零或多个单词
+func MatchTopic(pattern, topic string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(topic, "."))
+}
+
+//逐个模式单词推进，match[j]表示已处理的模式单词能否匹配主题的前j个单词，
+//耗时为两者单词数之积，不会因多个#回溯
+func matchWords(pattern, words []string) bool {
+	match := make([]bool, len(words)+1)
+	match[0] = true
+	for _, p := range pattern {
+		if p == "#" {
+			for j := 1; j <= len(words); j++ {
+				match[j] = match[j] || match[j-1]
+			}
+			continue
+		}
+		for j := len(words); j > 0; j-- {
+			match[j] = match[j-1] && (p == "*" || p == words[j-1])
+		}
+		match[0] = false
+	}
+	return match[len(words)]
+}
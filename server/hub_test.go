@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wisp/codec"
+	"wisp/common"
+	"wisp/utils"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"binance.btcusdt.ticker", "binance.btcusdt.ticker", true},
+		{"binance.btcusdt.ticker", "binance.ethusdt.ticker", false},
+		{"binance.*.ticker", "binance.btcusdt.ticker", true},
+		{"binance.*.ticker", "binance.btcusdt.kline.1m", false},
+		{"*.btcusdt.#", "binance.btcusdt.kline.1m", true},
+		{"*.btcusdt.#", "binance.btcusdt", true},
+		{"#", "binance.btcusdt.depth", true},
+		{"#", "user.binance.execution_report", true},
+		{"binance.#", "user.binance.execution_report", false},
+		{"#.kline.#", "binance.btcusdt.kline.1m", true},
+		{"#.kline", "binance.btcusdt.kline.1m", false},
+		{"#.1m", "binance.btcusdt.kline.1m", true},
+		{"binance.#.#.1m", "binance.btcusdt.kline.1m", true},
+		{"binance.*", "binance", false},
+		{"binance.#", "binance", true},
+		{"*", "binance", true},
+		{"binance.btcusdt.ticker.#", "binance.btcusdt.ticker", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+//回溯实现下该模式的匹配耗时随#的个数指数增长
+func TestMatchTopicManyWildcards(t *testing.T) {
+	pattern := strings.Repeat("#.", 30) + "x"
+	topic := strings.Repeat("a.", 30) + "b"
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		if MatchTopic(pattern, topic) {
+			t.Fatal("unexpected match")
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("1000 matches took %v", d)
+	}
+}
+
+func TestParseTopicPattern(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"Binance.BTCUSDT.Ticker", "binance.btcusdt.ticker", false},
+		{" binance.*.ticker ", "binance.*.ticker", false},
+		{"#.#.#.#.x", "#.x", false},
+		{"binance.#.#", "binance.#", false},
+		{"#.*.#", "#.*.#", false},
+		{strings.TrimSuffix(strings.Repeat("a.", maxTopicWords), "."), strings.TrimSuffix(strings.Repeat("a.", maxTopicWords), "."), false},
+		{strings.TrimSuffix(strings.Repeat("#.", maxTopicWords+1), "."), "", true},
+		{"", "", true},
+		{"binance..ticker", "", true},
+		{"binance.", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTopicPattern(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTopicPattern(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTopicPattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+//连接测试服务并订阅topics，等待订阅生效
+func dialHub(t *testing.T, hub *Hub, url string, header http.Header, topics ...string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := hubTopics(hub)
+	req, _ := json.Marshal(clientRequest{Op: "subscribe", Topics: topics})
+	if err := conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); hubTopics(hub) == before; {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return conn
+}
+
+func hubTopics(hub *Hub) int {
+	hub.RLock()
+	defer hub.RUnlock()
+	n := 0
+	for c := range hub.clients {
+		n += len(c.topics)
+	}
+	return n
+}
+
+//读取下一条消息并按编码解出主题
+func readTopic(t *testing.T, conn *websocket.Conn, encoding string) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := codec.Get(encoding)
+	if c.Binary() != (messageType == websocket.BinaryMessage) {
+		t.Errorf("%s frame type = %d", encoding, messageType)
+	}
+	ev, err := c.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev.Topic()
+}
+
+func TestHubUserData(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		query    string
+		header   http.Header
+		encoding string
+		want     []string
+	}{
+		{"anonymous", "secret", "", nil, "json", []string{"binance.btcusdt.ticker"}},
+		{"query token", "secret", "&token=secret", nil, "protobuf", []string{"user.binance.balance_update", "binance.btcusdt.ticker"}},
+		{"bearer token", "secret", "", http.Header{"Authorization": {"Bearer secret"}}, "msgpack", []string{"user.binance.balance_update", "binance.btcusdt.ticker"}},
+		{"wrong token", "secret", "&token=guess", nil, "json", []string{"binance.btcusdt.ticker"}},
+		{"no token configured", "", "&token=", nil, "json", []string{"binance.btcusdt.ticker"}},
+	}
+	p := new(utils.DecimalParser)
+	user := common.NewBalanceUpdateEvent(common.BINANCE, &common.BalanceUpdate{Asset: "USDT", Delta: p.Parse("-1.5")})
+	market := common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt", Last: p.Parse("9500")})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			hub.SetUserToken(tt.token)
+			srv := httptest.NewServer(http.HandlerFunc(hub.ServeWs))
+			defer srv.Close()
+			defer hub.Close()
+
+			url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?encoding=" + tt.encoding + tt.query
+			conn := dialHub(t, hub, url, tt.header, "#")
+			defer conn.Close()
+
+			for _, ev := range []*common.MarketEvent{user, market} {
+				if err := hub.Publish(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, want := range tt.want {
+				if got := readTopic(t, conn, tt.encoding); got != want {
+					t.Errorf("received %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHubTopicLimit(t *testing.T) {
+	hub := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(hub.ServeWs))
+	defer srv.Close()
+	defer hub.Close()
+
+	topics := make([]string, 0, maxClientTopics+10)
+	for i := 0; i < cap(topics); i++ {
+		topics = append(topics, "binance.sym"+strings.Repeat("x", i)+".ticker")
+	}
+	topics = append(topics, "binance..ticker")
+	conn := dialHub(t, hub, "ws"+strings.TrimPrefix(srv.URL, "http"), nil, topics...)
+	defer conn.Close()
+	if got := hubTopics(hub); got != maxClientTopics {
+		t.Errorf("client has %d topics, want %d", got, maxClientTopics)
+	}
+}
+
+func TestHubShutdown(t *testing.T) {
+	hub := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(hub.ServeWs))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	connected := dialHub(t, hub, url, nil, "#")
+	defer connected.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	late, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer late.Close()
+
+	tests := []struct {
+		name string
+		conn *websocket.Conn
+	}{
+		{"connected", connected},
+		{"after shutdown", late},
+	}
+	for _, tt := range tests {
+		tt.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := tt.conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("%s: read err = %v, want close 1001", tt.name, err)
+		}
+	}
+	//关闭后发布行情不再写入已关闭的客户端
+	ticker := common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt"})
+	if err := hub.Publish(ticker); err != nil {
+		t.Error(err)
+	}
+}
+
+//测试编码，统计编码次数，block不为nil时开始编码后等待其关闭
+type countingCodec struct {
+	codec.Codec
+	name    string
+	encodes int32
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (this *countingCodec) Name() string {
+	return this.name
+}
+
+func (this *countingCodec) Encode(ev *common.MarketEvent) ([]byte, error) {
+	atomic.AddInt32(&this.encodes, 1)
+	if this.block != nil {
+		this.started <- struct{}{}
+		<-this.block
+	}
+	return this.Codec.Encode(ev)
+}
+
+//不经过websocket连接直接加入推送中心的客户端
+func addClient(hub *Hub, c codec.Codec, topics ...string) *client {
+	cl := &client{hub: hub, send: make(chan frame, clientSendSize), codec: c, topics: make(map[string]bool)}
+	for _, topic := range topics {
+		cl.topics[topic] = true
+	}
+	hub.Lock()
+	hub.clients[cl] = true
+	hub.Unlock()
+	return cl
+}
+
+func TestHubPublishEncodeOnce(t *testing.T) {
+	jsonCodec, _ := codec.Get(codec.JSON)
+	msgpackCodec, _ := codec.Get(codec.MsgPack)
+	jsonCount := &countingCodec{Codec: jsonCodec, name: codec.JSON}
+	msgpackCount := &countingCodec{Codec: msgpackCodec, name: codec.MsgPack}
+	hub := NewHub()
+	var subscribed []*client
+	for i := 0; i < 3; i++ {
+		subscribed = append(subscribed, addClient(hub, jsonCount, "binance.*.ticker"))
+	}
+	subscribed = append(subscribed, addClient(hub, msgpackCount, "#"), addClient(hub, msgpackCount, "*.btcusdt.#"))
+	other := addClient(hub, jsonCount, "binance.ethusdt.#")
+
+	ticker := common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt"})
+	if err := hub.Publish(ticker); err != nil {
+		t.Fatal(err)
+	}
+	//每种编码只编码一次
+	if jsonCount.encodes != 1 || msgpackCount.encodes != 1 {
+		t.Errorf("encoded %d times as json and %d times as msgpack, want once each", jsonCount.encodes, msgpackCount.encodes)
+	}
+	for i, c := range subscribed {
+		if len(c.send) != 1 {
+			t.Fatalf("client %d received %d frames, want 1", i, len(c.send))
+		}
+		f := <-c.send
+		ev, err := c.codec.Decode(f.data)
+		if err != nil || ev.Topic() != ticker.Topic() || f.binary != c.codec.Binary() {
+			t.Errorf("client %d received %v (binary %v), %v", i, ev, f.binary, err)
+		}
+	}
+	if len(other.send) != 0 {
+		t.Errorf("unsubscribed client received %d frames", len(other.send))
+	}
+}
+
+func TestHubPublishEncodeOutsideLock(t *testing.T) {
+	jsonCodec, _ := codec.Get(codec.JSON)
+	slow := &countingCodec{Codec: jsonCodec, name: "slow", started: make(chan struct{}), block: make(chan struct{})}
+	hub := NewHub()
+	leaving := addClient(hub, slow, "#")
+	staying := addClient(hub, slow, "#")
+
+	published := make(chan error, 1)
+	go func() {
+		published <- hub.Publish(common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt"}))
+	}()
+	<-slow.started
+
+	//编码期间仍可修改推送中心，断开的客户端不再推送
+	locked := make(chan struct{})
+	go func() {
+		hub.SetUserToken("secret")
+		hub.Lock()
+		hub.remove(leaving)
+		hub.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("hub locked while encoding")
+	}
+	close(slow.block)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-leaving.send; ok {
+		t.Error("removed client received a frame")
+	}
+	if len(staying.send) != 1 {
+		t.Errorf("client received %d frames, want 1", len(staying.send))
+	}
+}
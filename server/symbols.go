@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"wisp/common"
+	"wisp/exchange"
+)
+
+//交易对元数据查询接口，?exchange=binance 指定交易所(默认binance)，?symbol=btcusdt 查询单个交易对，否则返回全部
+//按请求时已启动的交易所查询，热加载新增的交易所无需重新注册
+func SymbolsHandler(manager *exchange.Manager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("exchange")
+		if name == "" {
+			name = common.BINANCE
+		}
+		registry, err := manager.Symbols(name)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		symbol := req.URL.Query().Get("symbol")
+		if symbol == "" {
+			json.NewEncoder(res).Encode(registry.List())
+			return
+		}
+
+		info, ok := registry.Get(symbol)
+		if !ok {
+			http.Error(res, "unknown symbol: "+symbol, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(res).Encode(info)
+	}
+}
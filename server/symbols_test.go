@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wisp/common"
+	"wisp/exchange"
+)
+
+func TestSymbolsHandler(t *testing.T) {
+	manager := exchange.NewManager()
+	binance := exchange.NewBinanceExchange()
+	binance.Symbols().Update([]common.SymbolInfo{{Symbol: "BTCUSDT"}, {Symbol: "ETHUSDT"}})
+	handler := SymbolsHandler(manager)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"", http.StatusNotFound, "交易所未启动"},
+		{"exchange=binance", http.StatusOK, `"symbol":"ETHUSDT"`},
+		{"", http.StatusOK, `"symbol":"BTCUSDT"`},
+		{"symbol=btcusdt", http.StatusOK, `{"symbol":"BTCUSDT"`},
+		{"symbol=ltcusdt", http.StatusNotFound, "unknown symbol"},
+		{"exchange=okex", http.StatusNotFound, "交易所未启动: okex"},
+	}
+	for i, tt := range tests {
+		//首个请求时交易所尚未启动，启动后无需重新注册接口
+		if i == 1 {
+			manager.Register(binance)
+		}
+		res := httptest.NewRecorder()
+		handler(res, httptest.NewRequest(http.MethodGet, "/symbols?"+tt.query, nil))
+		if res.Code != tt.wantStatus || !strings.Contains(res.Body.String(), tt.wantBody) {
+			t.Errorf("GET /symbols?%s = %d %q, want %d containing %q", tt.query, res.Code, res.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"wisp/log"
+)
+
+//退出时依次执行的关闭步骤
+type shutdownStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+//启动http服务，收到SIGINT或SIGTERM后先停止接入新请求，再依次执行关闭步骤
+//全部步骤须在timeout内完成，超时或再次收到信号时返回错误，由调用方强制退出
+func serve(servers []*http.Server, timeout time.Duration, steps ...shutdownStep) error {
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errCh <- fmt.Errorf("%s: %v", srv.Addr, srv.ListenAndServe())
+		}(srv)
+	}
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errCh:
+		return err
+	case s := <-sig:
+		log.Warn("收到信号 %v，开始关闭，最长等待 %v\n", s, timeout)
+	}
+
+	var first []shutdownStep
+	for _, srv := range servers {
+		first = append(first, shutdownStep{"http服务 " + srv.Addr, srv.Shutdown})
+	}
+	return shutdown(sig, timeout, append(first, steps...)...)
+}
+
+//依次执行关闭步骤，单个步骤失败不影响后续步骤
+//全部步骤须在timeout内完成，超时或从sig再次收到信号时返回错误
+func shutdown(sig <-chan os.Signal, timeout time.Duration, steps ...shutdownStep) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, step := range steps {
+			start := time.Now()
+			if err := step.fn(ctx); err != nil {
+				log.Error("关闭%s失败: %v\n", step.name, err.Error())
+				continue
+			}
+			log.Info("已关闭%s，耗时 %v\n", step.name, time.Since(start))
+		}
+	}()
+
+	select {
+	case <-done:
+		log.Info("已退出\n")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("关闭超时(%v)，强制退出", timeout)
+	case s := <-sig:
+		return fmt.Errorf("关闭过程中再次收到信号 %v，强制退出", s)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"wisp/config"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   string //阻塞直至超时的步骤
+		fail    string //返回错误的步骤
+		signal  bool   //关闭过程中再次收到信号
+		want    []string
+		wantErr string
+	}{
+		{"in order", "", "", false, []string{"http", "hub", "sinks"}, ""},
+		{"failed step continues", "", "hub", false, []string{"http", "hub", "sinks"}, ""},
+		{"timeout", "hub", "", false, nil, "关闭超时"},
+		{"second signal", "hub", "", true, nil, "再次收到信号"},
+	}
+	for _, tt := range tests {
+		tt := tt //超时后未完成的步骤仍在运行
+		var mu sync.Mutex
+		var ran []string
+		step := func(name string) shutdownStep {
+			return shutdownStep{name, func(ctx context.Context) error {
+				mu.Lock()
+				ran = append(ran, name)
+				mu.Unlock()
+				if name == tt.block {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				if name == tt.fail {
+					return errors.New("failed")
+				}
+				return nil
+			}}
+		}
+		sig := make(chan os.Signal, 1)
+		timeout := time.Second
+		if tt.block != "" && !tt.signal {
+			timeout = 50 * time.Millisecond
+		}
+		if tt.signal {
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				sig <- syscall.SIGTERM
+			}()
+		}
+		err := shutdown(sig, timeout, step("http"), step("hub"), step("sinks"))
+		if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		mu.Lock()
+		if tt.want != nil && !reflect.DeepEqual(ran, tt.want) {
+			t.Errorf("%s: ran %v, want %v", tt.name, ran, tt.want)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestHttpServers(t *testing.T) {
+	servers := httpServers(config.ServerConfig{Listen: ":8080", AdminListen: "127.0.0.1:8081", AdminToken: "secret"})
+	if len(servers) != 2 || servers[0].Addr != ":8080" || servers[0].Handler != nil || servers[1].Addr != "127.0.0.1:8081" {
+		t.Fatalf("separate admin listener: %+v", servers)
+	}
+
+	//共用监听地址时管理接口挂在websocket服务的 /admin/ 下，同样需要令牌，其余路径不受影响
+	servers = httpServers(config.ServerConfig{Listen: ":8080", AdminToken: "secret"})
+	if len(servers) != 1 || servers[0].Addr != ":8080" {
+		t.Fatalf("shared listener: %+v", servers)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"no token", "/admin/connections", "", http.StatusUnauthorized},
+		{"wrong token", "/admin/connections", "Bearer guess", http.StatusUnauthorized},
+		{"token", "/admin/connections", "Bearer secret", http.StatusNotFound}, //测试中未注册管理接口
+		{"public", "/unknown", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		servers[0].Handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
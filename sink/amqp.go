@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"wisp/common"
+	"wisp/middleware"
+)
+
+// AMQPPublisher is the part of middleware.MarketPublisher used by AMQPSink
+type AMQPPublisher interface {
+	PublishEvent(ev *common.MarketEvent) error
+	Close() error
+}
+
+// AMQPSink publishes to a RabbitMQ topic exchange through middleware.MarketPublisher
+type AMQPSink struct {
+	conn      io.Closer
+	publisher AMQPPublisher
+}
+
+// NewAMQPSink wraps an existing connection, settings provide the publisher section
+func NewAMQPSink(conn *middleware.Connection, settings middleware.Settings) (*AMQPSink, error) {
+	publisher, err := middleware.NewMarketPublisher(conn, settings)
+	if err != nil {
+		return nil, err
+	}
+	return &AMQPSink{conn: conn, publisher: publisher}, nil
+}
+
+// DialAMQP connects to cfg.Url and creates the scheme read from cfg.Scheme
+func DialAMQP(cfg Config) (*AMQPSink, error) {
+	if cfg.Url == "" || cfg.Scheme == "" {
+		return nil, fmt.Errorf("amqp sink requires url and scheme")
+	}
+	f, err := os.Open(cfg.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := middleware.DecodeYaml(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Encoding != "" {
+		settings.Publisher.Encoding = cfg.Encoding
+	}
+
+	conn, err := middleware.ConnectWithOptions(cfg.Url, settings.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.CreateScheme(settings); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s, err := NewAMQPSink(conn, settings)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *AMQPSink) Name() string {
+	return TypeAMQP
+}
+
+func (s *AMQPSink) Publish(ev *common.MarketEvent) error {
+	return s.publisher.PublishEvent(ev)
+}
+
+// Close publishes the queued events before closing the connection
+func (s *AMQPSink) Close() error {
+	if err := s.publisher.Close(); err != nil {
+		s.conn.Close()
+		return err
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+	"wisp/common"
+)
+
+type fakeAMQPPublisher struct {
+	events []*common.MarketEvent
+	err    error
+	closed bool
+}
+
+func (p *fakeAMQPPublisher) PublishEvent(ev *common.MarketEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func (p *fakeAMQPPublisher) Close() error {
+	p.closed = true
+	return nil
+}
+
+type fakeCloser struct {
+	closed bool
+}
+
+func (c *fakeCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAMQPSink(t *testing.T) {
+	nacked := errors.New("middleware: message nacked by broker")
+	tests := []struct {
+		name    string
+		err     error
+		wantLen int
+	}{
+		{"published", nil, 3},
+		{"publisher error", nacked, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &fakeAMQPPublisher{err: tt.err}
+			conn := &fakeCloser{}
+			s := &AMQPSink{conn: conn, publisher: publisher}
+			for _, ev := range testEvents() {
+				if err := s.Publish(ev); err != tt.err {
+					t.Errorf("Publish() err = %v, want %v", err, tt.err)
+				}
+			}
+			if len(publisher.events) != tt.wantLen {
+				t.Errorf("published %d events, want %d", len(publisher.events), tt.wantLen)
+			}
+			s.Close()
+			if !publisher.closed || !conn.closed {
+				t.Errorf("publisher closed %v, connection closed %v, want both closed", publisher.closed, conn.closed)
+			}
+		})
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	tests := []Config{
+		{Type: TypeKafka, Topic: "market"},
+		{Type: TypeKafka, Brokers: []string{"localhost:9092"}},
+		{Type: TypeKafka, Brokers: []string{"localhost:9092"}, Topic: "market", Encoding: "xml"},
+		{Type: TypeNATS},
+		{Type: TypeRedis},
+		{Type: TypeAMQP, Url: "amqp://localhost"},
+	}
+	for _, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wisp/codec"
+	"wisp/common"
+)
+
+const (
+	// kafkaQueueSize is the number of encoded events waiting for the writer goroutine
+	kafkaQueueSize = 10000
+	// kafkaBatchSize caps the number of messages per WriteMessages call
+	kafkaBatchSize = 500
+)
+
+var (
+	// ErrQueueFull is returned by KafkaSink.Publish when the writer can't keep up and the event is dropped
+	ErrQueueFull = errors.New("sink: kafka queue full, event dropped")
+	// ErrClosed is returned when publishing to a closed sink
+	ErrClosed = errors.New("sink: closed")
+)
+
+// KafkaWriter is the part of kafka.Writer used by KafkaSink
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaSink writes events to a topic keyed by event topic, so all events of
+// one symbol and channel land in the same partition and keep their order.
+// Publish only encodes and queues the event, a writer goroutine sends the
+// queued messages in batches so a slow broker doesn't block the exchange read
+// loop or the other sinks. Events are dropped when the queue is full and
+// failed writes are reported to the error handler.
+type KafkaSink struct {
+	sync.RWMutex
+	writer  KafkaWriter
+	codec   codec.Codec
+	timeout time.Duration
+	queue   chan kafka.Message
+	done    chan struct{}
+	closed  bool
+	onError func(err error, count int)
+	dropped uint64
+}
+
+func NewKafkaSink(writer KafkaWriter, c codec.Codec) *KafkaSink {
+	return newKafkaSink(writer, c, kafkaQueueSize)
+}
+
+func newKafkaSink(writer KafkaWriter, c codec.Codec, queueSize int) *KafkaSink {
+	s := &KafkaSink{
+		writer:  writer,
+		codec:   c,
+		timeout: 5 * time.Second,
+		queue:   make(chan kafka.Message, queueSize),
+		done:    make(chan struct{}),
+		onError: func(err error, count int) {
+			logger.Error("kafka写入失败，丢弃 %d 条消息: %v\n", count, err.Error())
+		},
+	}
+	go s.loop()
+	return s
+}
+
+// DialKafka creates a writer for cfg.Brokers and cfg.Topic. With cfg.Async the
+// writer doesn't wait for broker acks either, write errors are then only logged.
+func DialKafka(cfg Config) (*KafkaSink, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka sink requires brokers and topic")
+	}
+	c, err := codec.Get(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      cfg.Brokers,
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    kafkaBatchSize,
+		BatchTimeout: 10 * time.Millisecond,
+		Async:        cfg.Async,
+		ErrorLogger: kafka.LoggerFunc(func(format string, v ...interface{}) {
+			logger.Error(format+"\n", v...)
+		}),
+	})
+	return NewKafkaSink(writer, c), nil
+}
+
+// SetErrorHandler replaces the handler called with failed writes and the
+// number of messages lost, the default logs the error
+func (s *KafkaSink) SetErrorHandler(f func(err error, count int)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onError = f
+}
+
+// Dropped returns the number of events dropped because the queue was full
+func (s *KafkaSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *KafkaSink) Name() string {
+	return TypeKafka
+}
+
+func (s *KafkaSink) Publish(ev *common.MarketEvent) error {
+	body, err := s.codec.Encode(ev)
+	if err != nil {
+		return err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	select {
+	case s.queue <- kafka.Message{Key: []byte(ev.Topic()), Value: body}:
+		return nil
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrQueueFull
+	}
+}
+
+// loop writes queued messages in batches of whatever is waiting, up to kafkaBatchSize
+func (s *KafkaSink) loop() {
+	defer close(s.done)
+	batch := make([]kafka.Message, 0, kafkaBatchSize)
+	for msg := range s.queue {
+		batch = append(batch[:0], msg)
+	fill:
+		for len(batch) < kafkaBatchSize {
+			select {
+			case msg, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, msg)
+			default:
+				break fill
+			}
+		}
+		s.write(batch)
+	}
+}
+
+func (s *KafkaSink) write(batch []kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.writer.WriteMessages(ctx, batch...); err != nil {
+		s.RLock()
+		onError := s.onError
+		s.RUnlock()
+		onError(err, len(batch))
+	}
+}
+
+// Close stops accepting events, writes the queued ones and closes the writer
+func (s *KafkaSink) Close() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	close(s.queue)
+	s.Unlock()
+
+	<-s.done
+	return s.writer.Close()
+}
@@ -0,0 +1,143 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKafkaWriter records written messages, writes wait while block is open
+type fakeKafkaWriter struct {
+	sync.Mutex
+	msgs   []kafka.Message
+	calls  int
+	err    error
+	block  chan struct{}
+	closed bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.block != nil {
+		<-w.block
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.calls++
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafkaSinkPublish(t *testing.T) {
+	for _, encoding := range []string{"json", "protobuf", "msgpack"} {
+		t.Run(encoding, func(t *testing.T) {
+			w := &fakeKafkaWriter{}
+			s := NewKafkaSink(w, mustCodec(t, encoding))
+			events := testEvents()
+			for _, ev := range events {
+				if err := s.Publish(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Close flushes the queue
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !w.closed {
+				t.Error("writer not closed")
+			}
+			if len(w.msgs) != len(events) {
+				t.Fatalf("wrote %d messages, want %d", len(w.msgs), len(events))
+			}
+			for i, ev := range events {
+				if key := string(w.msgs[i].Key); key != ev.Topic() {
+					t.Errorf("message %d key = %q, want %q", i, key, ev.Topic())
+				}
+				checkEncoded(t, encoding, w.msgs[i].Value, ev)
+			}
+		})
+	}
+}
+
+func TestKafkaSinkErrors(t *testing.T) {
+	writeErr := errors.New("leader not available")
+	tests := []struct {
+		name       string
+		encoding   string
+		writerErr  error
+		data       interface{}
+		wantErr    bool
+		wantFailed int
+	}{
+		{"ok", "json", nil, nil, false, 0},
+		{"write error goes to handler", "json", writeErr, nil, false, 1},
+		{"encode error returned", "protobuf", nil, "not market data", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &fakeKafkaWriter{err: tt.writerErr}
+			s := NewKafkaSink(w, mustCodec(t, tt.encoding))
+			var failed int
+			var handled error
+			s.SetErrorHandler(func(err error, count int) {
+				handled = err
+				failed += count
+			})
+
+			ev := testEvents()[0]
+			if tt.data != nil {
+				ev.Data = tt.data
+			}
+			if err := s.Publish(ev); (err != nil) != tt.wantErr {
+				t.Errorf("Publish() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			s.Close()
+			if failed != tt.wantFailed {
+				t.Errorf("failed = %d, want %d", failed, tt.wantFailed)
+			}
+			if tt.writerErr != nil && handled != tt.writerErr {
+				t.Errorf("handler got %v, want %v", handled, tt.writerErr)
+			}
+		})
+	}
+}
+
+func TestKafkaSinkDoesNotBlock(t *testing.T) {
+	w := &fakeKafkaWriter{block: make(chan struct{})}
+	s := newKafkaSink(w, mustCodec(t, "json"), 2)
+	ev := testEvents()[0]
+
+	// the first event is taken by the blocked writer, two more fill the queue
+	start := time.Now()
+	var full int
+	for i := 0; i < 10; i++ {
+		if err := s.Publish(ev); err == ErrQueueFull {
+			full++
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Publish blocked on a slow writer for %v", time.Since(start))
+	}
+	if full == 0 || s.Dropped() != uint64(full) {
+		t.Errorf("full = %d, Dropped() = %d", full, s.Dropped())
+	}
+
+	close(w.block)
+	s.Close()
+	if len(w.msgs) != 10-full {
+		t.Errorf("wrote %d messages, want %d", len(w.msgs), 10-full)
+	}
+	if err := s.Publish(ev); err != ErrClosed {
+		t.Errorf("Publish() after Close err = %v, want ErrClosed", err)
+	}
+}
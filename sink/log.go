@@ -0,0 +1,5 @@
+package sink
+
+import "wisp/log"
+
+var logger = log.Named("sink")
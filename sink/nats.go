@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"wisp/codec"
+	"wisp/common"
+)
+
+// NATSConn is the part of nats.Conn used by NATSSink
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+	Drain() error
+}
+
+// NATSSink publishes every event on subject <prefix>.<event topic>,
+// e.g. wisp.binance.btcusdt.kline.1m, so subscribers can use wildcards
+type NATSSink struct {
+	conn   NATSConn
+	codec  codec.Codec
+	prefix string
+}
+
+func NewNATSSink(conn NATSConn, c codec.Codec, prefix string) *NATSSink {
+	return &NATSSink{conn: conn, codec: c, prefix: prefix}
+}
+
+// DialNATS connects to cfg.Url, reconnecting indefinitely on connection loss
+func DialNATS(cfg Config) (*NATSSink, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("nats sink requires url")
+	}
+	c, err := codec.Get(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := nats.Connect(cfg.Url, nats.Name("wisp"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return NewNATSSink(conn, c, cfg.SubjectPrefix), nil
+}
+
+func (s *NATSSink) Name() string {
+	return TypeNATS
+}
+
+func (s *NATSSink) Publish(ev *common.MarketEvent) error {
+	body, err := s.codec.Encode(ev)
+	if err != nil {
+		return err
+	}
+	subject := ev.Topic()
+	if s.prefix != "" {
+		subject = s.prefix + "." + subject
+	}
+	return s.conn.Publish(subject, body)
+}
+
+// Close flushes pending messages before closing the connection
+func (s *NATSSink) Close() error {
+	return s.conn.Drain()
+}
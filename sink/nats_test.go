@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+)
+
+type natsMsg struct {
+	subject string
+	data    []byte
+}
+
+type fakeNATSConn struct {
+	msgs    []natsMsg
+	err     error
+	drained bool
+}
+
+func (c *fakeNATSConn) Publish(subject string, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.msgs = append(c.msgs, natsMsg{subject, data})
+	return nil
+}
+
+func (c *fakeNATSConn) Drain() error {
+	c.drained = true
+	return nil
+}
+
+func TestNATSSinkPublish(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		encoding string
+		want     []string
+	}{
+		{"", "json", []string{"binance.btcusdt.ticker", "binance.ethusdt.kline.1m", "user.binance.execution_report"}},
+		{"wisp", "protobuf", []string{"wisp.binance.btcusdt.ticker", "wisp.binance.ethusdt.kline.1m", "wisp.user.binance.execution_report"}},
+		{"edge.v1", "msgpack", []string{"edge.v1.binance.btcusdt.ticker", "edge.v1.binance.ethusdt.kline.1m", "edge.v1.user.binance.execution_report"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"/"+tt.encoding, func(t *testing.T) {
+			conn := &fakeNATSConn{}
+			s := NewNATSSink(conn, mustCodec(t, tt.encoding), tt.prefix)
+			events := testEvents()
+			for _, ev := range events {
+				if err := s.Publish(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, ev := range events {
+				if conn.msgs[i].subject != tt.want[i] {
+					t.Errorf("subject = %q, want %q", conn.msgs[i].subject, tt.want[i])
+				}
+				checkEncoded(t, tt.encoding, conn.msgs[i].data, ev)
+			}
+			s.Close()
+			if !conn.drained {
+				t.Error("Close() didn't drain the connection")
+			}
+		})
+	}
+}
+
+func TestNATSSinkErrors(t *testing.T) {
+	slow := errors.New("nats: slow consumer")
+	tests := []struct {
+		name     string
+		encoding string
+		connErr  error
+		data     interface{}
+		wantErr  error
+	}{
+		{"publish error", "json", slow, nil, slow},
+		{"encode error", "msgpack", nil, 42, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeNATSConn{err: tt.connErr}
+			s := NewNATSSink(conn, mustCodec(t, tt.encoding), "wisp")
+			ev := testEvents()[0]
+			if tt.data != nil {
+				ev.Data = tt.data
+			}
+			err := s.Publish(ev)
+			if err == nil || tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("Publish() err = %v, want %v", err, tt.wantErr)
+			}
+			if len(conn.msgs) != 0 {
+				t.Errorf("published %d messages", len(conn.msgs))
+			}
+		})
+	}
+}
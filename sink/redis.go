@@ -0,0 +1,71 @@
+package sink
+
+import (
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"wisp/codec"
+	"wisp/common"
+)
+
+// RedisClient is the part of redis.Client used by RedisSink
+type RedisClient interface {
+	XAdd(a *redis.XAddArgs) *redis.StringCmd
+	Close() error
+}
+
+// RedisSink appends every event to the stream <prefix><event topic>,
+// e.g. wisp:binance.btcusdt.ticker, trimmed to about maxLen entries
+type RedisSink struct {
+	client RedisClient
+	codec  codec.Codec
+	prefix string
+	maxLen int64
+}
+
+func NewRedisSink(client RedisClient, c codec.Codec, prefix string, maxLen int64) *RedisSink {
+	return &RedisSink{client: client, codec: c, prefix: prefix, maxLen: maxLen}
+}
+
+// DialRedis connects to cfg.Addr and checks the connection
+func DialRedis(cfg Config) (*RedisSink, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("redis sink requires addr")
+	}
+	c, err := codec.Get(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(&redis.Options{Addr: cfg.Addr, Password: cfg.Password, DB: cfg.DB})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return NewRedisSink(client, c, cfg.StreamPrefix, cfg.MaxLen), nil
+}
+
+func (s *RedisSink) Name() string {
+	return TypeRedis
+}
+
+func (s *RedisSink) Publish(ev *common.MarketEvent) error {
+	body, err := s.codec.Encode(ev)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(&redis.XAddArgs{
+		Stream:       s.prefix + ev.Topic(),
+		MaxLenApprox: s.maxLen,
+		Values: map[string]interface{}{
+			"venue":    ev.Venue,
+			"symbol":   ev.Symbol,
+			"channel":  ev.Channel,
+			"period":   ev.Period,
+			"encoding": s.codec.Name(),
+			"data":     body,
+		},
+	}).Err()
+}
+
+func (s *RedisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+	"testing"
+)
+
+type fakeRedisClient struct {
+	adds   []*redis.XAddArgs
+	err    error
+	closed bool
+}
+
+func (c *fakeRedisClient) XAdd(a *redis.XAddArgs) *redis.StringCmd {
+	if c.err != nil {
+		return redis.NewStringResult("", c.err)
+	}
+	c.adds = append(c.adds, a)
+	return redis.NewStringResult("1500000000000-0", nil)
+}
+
+func (c *fakeRedisClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRedisSinkPublish(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		encoding string
+		maxLen   int64
+		want     []string
+	}{
+		{"", "json", 0, []string{"binance.btcusdt.ticker", "binance.ethusdt.kline.1m", "user.binance.execution_report"}},
+		{"wisp:", "protobuf", 1000, []string{"wisp:binance.btcusdt.ticker", "wisp:binance.ethusdt.kline.1m", "wisp:user.binance.execution_report"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+tt.encoding, func(t *testing.T) {
+			client := &fakeRedisClient{}
+			s := NewRedisSink(client, mustCodec(t, tt.encoding), tt.prefix, tt.maxLen)
+			events := testEvents()
+			for _, ev := range events {
+				if err := s.Publish(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, ev := range events {
+				a := client.adds[i]
+				if a.Stream != tt.want[i] || a.MaxLenApprox != tt.maxLen {
+					t.Errorf("stream %q maxlen %d, want %q maxlen %d", a.Stream, a.MaxLenApprox, tt.want[i], tt.maxLen)
+				}
+				fields := map[string]interface{}{"venue": ev.Venue, "symbol": ev.Symbol, "channel": ev.Channel, "period": ev.Period, "encoding": tt.encoding}
+				for k, v := range fields {
+					if a.Values[k] != v {
+						t.Errorf("field %s = %v, want %v", k, a.Values[k], v)
+					}
+				}
+				checkEncoded(t, tt.encoding, a.Values["data"].([]byte), ev)
+			}
+			s.Close()
+			if !client.closed {
+				t.Error("client not closed")
+			}
+		})
+	}
+}
+
+func TestRedisSinkError(t *testing.T) {
+	oom := errors.New("OOM command not allowed")
+	s := NewRedisSink(&fakeRedisClient{err: oom}, mustCodec(t, "json"), "wisp:", 0)
+	if err := s.Publish(testEvents()[0]); err != oom {
+		t.Errorf("Publish() err = %v, want %v", err, oom)
+	}
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+	"wisp/common"
+)
+
+// Sink forwards market events to a message broker
+type Sink interface {
+	Name() string
+	Publish(ev *common.MarketEvent) error
+	Close() error
+}
+
+const (
+	TypeAMQP  = "amqp"
+	TypeKafka = "kafka"
+	TypeNATS  = "nats"
+	TypeRedis = "redis"
+)
+
+// Config selects and configures one sink, only the fields used by its type are read
+type Config struct {
+	Type string `yaml:"type"`
+	// Encoding is json, protobuf or msgpack, amqp sinks default to the scheme's publisher encoding
+	Encoding string `yaml:"encoding"`
+
+	// Url is the broker address of amqp and nats sinks
+	Url string `yaml:"url"`
+	// Scheme is the middleware.Settings yaml file of an amqp sink
+	Scheme string `yaml:"scheme"`
+
+	// Brokers, Topic and Async configure a kafka sink, events are always
+	// written in the background, Async also skips waiting for broker acks
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+	Async   bool     `yaml:"async"`
+
+	// SubjectPrefix is prepended to the event topic to form the nats subject
+	SubjectPrefix string `yaml:"subject_prefix"`
+
+	// Addr, Password, DB, StreamPrefix and MaxLen configure a redis streams sink
+	Addr         string `yaml:"addr"`
+	Password     string `yaml:"password"`
+	DB           int    `yaml:"db"`
+	StreamPrefix string `yaml:"stream_prefix"`
+	MaxLen       int64  `yaml:"max_len"`
+}
+
+// DecodeYaml reads a list of sink configs
+func DecodeYaml(r io.Reader) ([]Config, error) {
+	var s struct {
+		Sinks []Config `yaml:"sinks"`
+	}
+	err := yaml.NewDecoder(r).Decode(&s)
+	return s.Sinks, err
+}
+
+// New creates the sink described by cfg
+func New(cfg Config) (Sink, error) {
+	switch cfg.Type {
+	case TypeAMQP:
+		return DialAMQP(cfg)
+	case TypeKafka:
+		return DialKafka(cfg)
+	case TypeNATS:
+		return DialNATS(cfg)
+	case TypeRedis:
+		return DialRedis(cfg)
+	default:
+		return nil, fmt.Errorf("sink: unknown type %q", cfg.Type)
+	}
+}
+
+// NewMulti creates every configured sink and combines them, sinks already
+// created are closed if a later one fails
+func NewMulti(cfgs []Config) (Sink, error) {
+	m := Multi{}
+	for i, cfg := range cfgs {
+		s, err := New(cfg)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("sink %d (%s): %w", i, cfg.Type, err)
+		}
+		m = append(m, s)
+	}
+	return m, nil
+}
+
+// Multi publishes every event to all of its sinks
+type Multi []Sink
+
+func (m Multi) Name() string {
+	names := make([]string, len(m))
+	for i, s := range m {
+		names[i] = s.Name()
+	}
+	return "multi(" + strings.Join(names, ",") + ")"
+}
+
+// Publish sends the event to every sink, a failing sink doesn't stop the others
+func (m Multi) Publish(ev *common.MarketEvent) error {
+	var errs []string
+	for _, s := range m {
+		if err := s.Publish(ev); err != nil {
+			errs = append(errs, s.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("sink: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (m Multi) Close() error {
+	var errs []string
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, s.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("sink: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
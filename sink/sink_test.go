@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"wisp/codec"
+	"wisp/common"
+	"wisp/utils"
+)
+
+func testEvents() []*common.MarketEvent {
+	p := new(utils.DecimalParser)
+	ticker := common.NewTickerEvent(common.BINANCE, &common.Ticker{Symbol: "btcusdt", Last: p.Parse("9500.5"), Vol: p.Parse("12"), Date: 1500000000000})
+	kline := common.NewKlineEvent(common.BINANCE, &common.Kline{Symbol: "ethusdt", Timestamp: 1500000000000, Open: p.Parse("1"), Close: p.Parse("2")}, common.KLINE_PERIOD_1MIN)
+	report := common.NewExecutionReportEvent(common.BINANCE, &common.ExecutionReport{Symbol: "BTCUSDT", OrderId: 7, Status: "FILLED"})
+	events := []*common.MarketEvent{ticker, kline, report}
+	for i, ev := range events {
+		ev.ReceiveTime = 1500000000001
+		ev.Sequence = uint64(i + 1)
+	}
+	return events
+}
+
+// checkEncoded decodes body with the named codec and compares it with ev
+func checkEncoded(t *testing.T, encoding string, body []byte, ev *common.MarketEvent) {
+	t.Helper()
+	c, err := codec.Get(encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Decode(body)
+	if err != nil {
+		t.Fatalf("decode %s: %v", encoding, err)
+	}
+	if got.Topic() != ev.Topic() || got.Sequence != ev.Sequence {
+		t.Errorf("decoded %s seq %d, want %s seq %d", got.Topic(), got.Sequence, ev.Topic(), ev.Sequence)
+	}
+}
+
+func mustCodec(t *testing.T, encoding string) codec.Codec {
+	t.Helper()
+	c, err := codec.Get(encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// fakeSink records published topics and fails with err
+type fakeSink struct {
+	sync.Mutex
+	name   string
+	err    error
+	topics []string
+	closed bool
+}
+
+func (s *fakeSink) Name() string {
+	return s.name
+}
+
+func (s *fakeSink) Publish(ev *common.MarketEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	s.topics = append(s.topics, ev.Topic())
+	return s.err
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return s.err
+}
+
+func TestMulti(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		wantErr string
+	}{
+		{"all ok", []error{nil, nil}, ""},
+		{"one fails", []error{errors.New("down"), nil}, "a: down"},
+		{"both fail", []error{errors.New("down"), errors.New("full")}, "a: down; b: full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &fakeSink{name: "a", err: tt.errs[0]}
+			b := &fakeSink{name: "b", err: tt.errs[1]}
+			m := Multi{a, b}
+
+			err := m.Publish(testEvents()[0])
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Publish() err = %v, want %q", err, tt.wantErr)
+			}
+			// a failing sink doesn't stop the others
+			if len(a.topics) != 1 || len(b.topics) != 1 {
+				t.Errorf("published %d/%d events, want 1/1", len(a.topics), len(b.topics))
+			}
+			m.Close()
+			if !a.closed || !b.closed {
+				t.Error("not every sink was closed")
+			}
+		})
+	}
+}
+
+func TestNewUnknownType(t *testing.T) {
+	if _, err := New(Config{Type: "zeromq"}); err == nil {
+		t.Error("New() accepted an unknown type")
+	}
+}
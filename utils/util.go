@@ -1,58 +1,125 @@
 package utils
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	. "wisp/common"
 )
 
-func ToFloat64(v interface{}) float64 {
+//转换为int64，浮点数须为整数值，数值格式错误时返回错误
+func ToInt64(v interface{}) (int64, error) {
 	if v == nil {
-		return 0.0
+		return 0, nil
 	}
 	switch v.(type) {
-	case float64:
-		return v.(float64)
 	case string:
-		vStr := v.(string)
-		vF, _ := strconv.ParseFloat(vStr, 64)
-		return vF
+		i, err := strconv.ParseInt(v.(string), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("int64转换错误: %q", v)
+		}
+		return i, nil
+	case int:
+		return int64(v.(int)), nil
+	case int64:
+		return v.(int64), nil
+	case float64:
+		f := v.(float64)
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("int64转换错误: %v", v)
+		}
+		return int64(f), nil
 	default:
-		panic("float64转换错误")
+		return 0, fmt.Errorf("int64转换错误: %v", v)
 	}
 }
 
-func ToInt(v interface{}) int {
+//转换为uint64，浮点数须为非负整数值，数值格式错误时返回错误
+func ToUint64(v interface{}) (uint64, error) {
 	if v == nil {
-		return 0
+		return 0, nil
 	}
 	switch v.(type) {
 	case string:
-		vStr := v.(string)
-		vInt, _ := strconv.Atoi(vStr)
-		return vInt
+		u, err := strconv.ParseUint(v.(string), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("uint64转换错误: %q", v)
+		}
+		return u, nil
 	case int:
-		return v.(int)
+		if v.(int) < 0 {
+			return 0, fmt.Errorf("uint64转换错误: %v", v)
+		}
+		return uint64(v.(int)), nil
 	case float64:
-		vF := v.(float64)
-		return int(vF)
+		f := v.(float64)
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("uint64转换错误: %v", v)
+		}
+		return uint64(f), nil
 	default:
-		panic("int转换错误")
+		return 0, fmt.Errorf("uint64转换错误: %v", v)
 	}
 }
 
-func ToUint64(v interface{}) uint64 {
+func ToString(v interface{}) string {
 	if v == nil {
-		return 0
+		return ""
 	}
-
 	switch v.(type) {
-	case int:
-		return uint64(v.(int))
+	case string:
+		return v.(string)
 	case float64:
-		return uint64((v.(float64)))
+		return strconv.FormatFloat(v.(float64), 'f', -1, 64)
+	default:
+		panic("string转换错误")
+	}
+}
+
+//转换为定点十进制数，数值格式错误时返回错误
+func ToDecimal(v interface{}) (Decimal, error) {
+	if v == nil {
+		return Decimal{}, nil
+	}
+	switch v.(type) {
 	case string:
-		uV, _ := strconv.ParseUint(v.(string), 10, 64)
-		return uV
+		return NewDecimalFromString(v.(string))
+	case float64:
+		return NewDecimalFromFloat(v.(float64)), nil
+	case int:
+		return NewDecimal(int64(v.(int)), 0), nil
+	case int64:
+		return NewDecimal(v.(int64), 0), nil
 	default:
-		panic("uint64转换错误")
+		return Decimal{}, fmt.Errorf("decimal转换错误: %v", v)
+	}
+}
+
+//依次转换多个数值字段(定点数、时间戳及编号)，记录第一个转换错误，便于批量解析后统一检查
+type DecimalParser struct {
+	Err error
+}
+
+func (this *DecimalParser) Parse(v interface{}) Decimal {
+	d, err := ToDecimal(v)
+	this.record(err)
+	return d
+}
+
+func (this *DecimalParser) Int64(v interface{}) int64 {
+	i, err := ToInt64(v)
+	this.record(err)
+	return i
+}
+
+func (this *DecimalParser) Uint64(v interface{}) uint64 {
+	u, err := ToUint64(v)
+	this.record(err)
+	return u
+}
+
+func (this *DecimalParser) record(err error) {
+	if err != nil && this.Err == nil {
+		this.Err = err
 	}
 }
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		v       interface{}
+		want    int64
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{float64(1499405658658), 1499405658658, false},
+		{float64(-1), -1, false},
+		{"718", 718, false},
+		{7, 7, false},
+		{int64(-5), -5, false},
+		{1.5, 0, true},
+		{1e19, 0, true},
+		{"12a", 0, true},
+		{"", 0, true},
+		{true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ToInt64(tt.v)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ToInt64(%#v) = %d, %v, want %d (err %v)", tt.v, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestToUint64(t *testing.T) {
+	tests := []struct {
+		v       interface{}
+		want    uint64
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{float64(1564034571105), 1564034571105, false},
+		{"18446744073709551615", 18446744073709551615, false},
+		{3, 3, false},
+		{float64(-1), 0, true},
+		{-1, 0, true},
+		{0.5, 0, true},
+		{"-1", 0, true},
+		{map[string]interface{}{}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ToUint64(tt.v)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ToUint64(%#v) = %d, %v, want %d (err %v)", tt.v, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecimalParser(t *testing.T) {
+	parser := new(DecimalParser)
+	if d := parser.Parse("0.01000000"); d.String() != "0.01000000" || parser.Err != nil {
+		t.Fatalf("Parse = %v, err %v", d, parser.Err)
+	}
+	if i := parser.Int64(float64(42)); i != 42 || parser.Err != nil {
+		t.Fatalf("Int64 = %d, err %v", i, parser.Err)
+	}
+
+	//只记录第一个错误，之后的字段继续转换
+	parser.Uint64("abc")
+	first := parser.Err
+	parser.Parse("1e")
+	if first == nil || parser.Err != first {
+		t.Errorf("Err = %v, want the first error %v", parser.Err, first)
+	}
+	if u := parser.Uint64(float64(7)); u != 7 {
+		t.Errorf("Uint64 after an error = %d, want 7", u)
+	}
+}
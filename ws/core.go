@@ -7,6 +7,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 	"wisp/log"
 )
@@ -25,12 +26,22 @@ type WebsocketConfig struct {
 	isDump                bool                         //是否开启堆栈信息
 }
 
+//连接编号，用于日志区分各连接
+var connId uint64
+
+var wsLog = log.Named("ws")
+
 type WebsocketConnection struct {
 	*websocket.Conn
 	sync.Mutex
 	WebsocketConfig
+	id             uint64
 	activeTime     time.Time
 	activeTimeL    sync.Mutex
+	connectedUrl   string    //当前连接的地址
+	connectedAt    time.Time //本次连接建立时间
+	lastMessage    time.Time //最近一次收到消息的时间
+	reconnects     uint64    //重连次数
 	mu             chan struct{}
 	closeHeartbeat chan struct{}
 	closeReconnect chan struct{}
@@ -99,22 +110,26 @@ func (this *WebsocketBuilder) SetErrorHandle(handle func(error)) *WebsocketBuild
 	return this
 }
 
-func (this *WebsocketBuilder) Build() *WebsocketConnection {
+//建立连接，连接失败时返回错误
+func (this *WebsocketBuilder) Build() (*WebsocketConnection, error) {
 	if this.errorHandleFunc == nil {
 		this.errorHandleFunc = func(e error) {
-			log.Info("异常信息: %v\n", e.Error())
+			wsLog.Info("异常信息: %v\n", e.Error())
 		}
 	}
 	conn := &WebsocketConnection{
 		WebsocketConfig: *this.WebsocketConfig,
+		id:              atomic.AddUint64(&connId, 1),
 	}
 	return conn.New()
 }
 
-func (this *WebsocketConnection) New() *WebsocketConnection {
+func (this *WebsocketConnection) New() (*WebsocketConnection, error) {
 	this.Lock()
 	defer this.Unlock()
-	this.connect()
+	if err := this.connect(); err != nil {
+		return nil, err
+	}
 	this.mu = make(chan struct{}, 1)
 	this.closeHeartbeat = make(chan struct{}, 1)
 	this.closeReconnect = make(chan struct{}, 1)
@@ -123,7 +138,7 @@ func (this *WebsocketConnection) New() *WebsocketConnection {
 	this.HeartbeatTimer()
 	this.ReconnectTimer()
 	this.checkStatusTimer()
-	return this
+	return this, nil
 }
 
 func (this *WebsocketConnection) RecvMsg() {
@@ -132,16 +147,24 @@ func (this *WebsocketConnection) RecvMsg() {
 		for {
 			if len(this.closeRecv) > 0 {
 				<-this.closeRecv
-				log.Info("关闭连接,退出 RecvMsg协程\n")
+				this.logger().Info("关闭连接,退出 RecvMsg协程\n")
 				return
 			}
 
-			t, msg, err := this.ReadMessage()
+			conn := this.current()
+			t, msg, err := conn.ReadMessage()
 			if err != nil {
+				//连接已关闭或读取期间已被重连替换时不回调异常
+				if len(this.closeRecv) > 0 || this.current() != conn {
+					continue
+				}
 				this.errorHandleFunc(err)
 				time.Sleep(time.Second)
 				continue
 			}
+			this.activeTimeL.Lock()
+			this.lastMessage = time.Now()
+			this.activeTimeL.Unlock()
 
 			switch t {
 			case websocket.TextMessage:
@@ -164,14 +187,14 @@ func (this *WebsocketConnection) RecvMsg() {
 				this.Close()
 				return
 			default:
-				log.Info("消息解析错误: %v %v\n", string(msg), err.Error())
+				this.logger().Info("消息解析错误: %v %v\n", string(msg), err.Error())
 			}
 		}
 	}()
 }
 
 func (this *WebsocketConnection) HeartbeatTimer() {
-	log.Info("心跳周期时间为: %v\n", this.heartBeatIntervalTime)
+	this.logger().Info("心跳周期时间为: %v\n", this.heartBeatIntervalTime)
 	if this.heartBeatIntervalTime == 0 || (this.heartBeatFunc == nil && this.heartBeatData == nil) {
 		return
 	}
@@ -190,12 +213,12 @@ func (this *WebsocketConnection) HeartbeatTimer() {
 				}
 
 				if err != nil {
-					log.Info("心跳数据发送错误: %v\n", err.Error())
+					this.logger().Info("心跳数据发送错误: %v\n", err.Error())
 					time.Sleep(time.Second)
 				}
 			case <-this.closeHeartbeat:
 				timer.Stop()
-				log.Info("关闭websocket连接,退出心跳协程\n")
+				this.logger().Info("关闭websocket连接,退出心跳协程\n")
 				return
 			}
 		}
@@ -213,12 +236,12 @@ func (this *WebsocketConnection) checkStatusTimer() {
 		case <-timer.C:
 			now := time.Now()
 			if now.Sub(this.activeTime) >= 2*this.heartBeatIntervalTime {
-				log.Info("上次一活动时间为: [%v],已经过期，开始重新连接\n", this.activeTime)
-				this.Reconnect()
+				this.logger().Info("上次一活动时间为: [%v],已经过期，开始重新连接\n", this.activeTime)
+				this.Reconnect() //失败时已记录日志，下个周期再重连
 			}
 			timer.Reset(this.heartBeatIntervalTime)
 		case <-this.closeCheck:
-			log.Info("退出状态监测协程\n")
+			this.logger().Info("退出状态监测协程\n")
 			return
 		}
 	}()
@@ -235,28 +258,56 @@ func (this *WebsocketConnection) ReconnectTimer() {
 		for {
 			select {
 			case <-timer.C:
-				log.Info("开始重新连接\n")
-				this.Reconnect()
+				this.logger().Info("开始重新连接\n")
+				this.Reconnect() //失败时已记录日志，下个周期再重连
 				timer.Reset(this.reconnectIntervalTime)
 			case <-this.closeReconnect:
 				timer.Stop()
-				log.Info("关闭连接,退出当前协程\n")
+				this.logger().Info("关闭连接,退出当前协程\n")
 				return
 			}
 		}
 	}()
 }
 
-func (this *WebsocketConnection) Reconnect() {
+//重新连接，连接失败时返回错误，连接保持关闭直到下次重连成功
+func (this *WebsocketConnection) Reconnect() error {
+	this.Lock()
+	defer this.Unlock()
+	return this.reconnect()
+}
+
+//切换连接地址后重新连接，用于地址中带有临时凭证(如listenKey)的场景
+func (this *WebsocketConnection) ReconnectTo(websocketUrl string) error {
+	this.Lock()
+	defer this.Unlock()
+	this.websocketUrl = websocketUrl
+	return this.reconnect()
+}
+
+//关闭连接并退出所有后台协程，关闭后不再重连
+func (this *WebsocketConnection) Shutdown() {
 	this.Lock()
 	defer this.Unlock()
+	this.notifyChannel(this.closeRecv)
+	this.notifyChannel(this.closeHeartbeat)
+	this.notifyChannel(this.closeReconnect)
+	this.notifyChannel(this.closeCheck)
+	this.Close()
+}
+
+func (this *WebsocketConnection) reconnect() error {
+	atomic.AddUint64(&this.reconnects, 1)
 	this.Close()
 	time.Sleep(time.Second)
-	this.connect()
+	if err := this.connect(); err != nil {
+		return err
+	}
 	for _, event := range this.subs {
-		log.Info("订阅频道: %v\n", event)
+		this.logger().Info("订阅频道: %v\n", event)
 		this.SendJson(event)
 	}
+	return nil
 }
 
 func (this *WebsocketConnection) SendText(data []byte) error {
@@ -285,12 +336,13 @@ func (this *WebsocketConnection) Subscribe(event interface{}) error {
 	return nil
 }
 
-func (this *WebsocketConnection) connect() {
-	dial := websocket.DefaultDialer
+func (this *WebsocketConnection) connect() error {
+	//复制默认拨号器，避免代理设置影响其他连接
+	dial := *websocket.DefaultDialer
 	if this.proxyUrl != "" {
 		proxy, err := url.Parse(this.proxyUrl)
 		if err != nil {
-			log.Info("代理地址设置错误: 代理地址为: [%s] 错误信息: %v\n", this.proxyUrl, err.Error())
+			this.logger().Info("代理地址设置错误: 代理地址为: [%s] 错误信息: %v\n", this.proxyUrl, err.Error())
 		} else {
 			dial.Proxy = http.ProxyURL(proxy)
 			//log.Info("设置当前连接代理地址为: [%s]\n", this.proxyUrl)
@@ -299,16 +351,58 @@ func (this *WebsocketConnection) connect() {
 
 	conn, res, err := dial.Dial(this.websocketUrl, http.Header(this.requestHeaders))
 	if err != nil {
-		log.Info("连接发生错误: %v\n", err.Error())
-		panic(err)
+		this.logger().Info("连接发生错误: %v\n", err.Error())
+		return err
 	}
 	this.Conn = conn
+	this.activeTimeL.Lock()
+	this.connectedUrl = this.websocketUrl
+	this.connectedAt = time.Now()
+	this.activeTimeL.Unlock()
 
 	if this.isDump {
 		dumpData, _ := httputil.DumpResponse(res, true)
-		log.Info("连接堆栈信息: %v\n", string(dumpData))
+		this.logger().Info("连接堆栈信息: %v\n", string(dumpData))
 	}
 	this.UpdateActiveTime()
+	return nil
+}
+
+//当前连接，重连进行中时等待重连结束
+func (this *WebsocketConnection) current() *websocket.Conn {
+	this.Lock()
+	defer this.Unlock()
+	return this.Conn
+}
+
+func (this *WebsocketConnection) Id() uint64 {
+	return this.id
+}
+
+//连接状态，Streams 由使用方按订阅内容填写
+type ConnectionState struct {
+	Id             uint64    `json:"id"`
+	Url            string    `json:"url"`
+	ConnectedSince time.Time `json:"connected_since"`
+	LastMessage    time.Time `json:"last_message"`
+	Reconnects     uint64    `json:"reconnects"`
+	Streams        []string  `json:"streams"`
+}
+
+func (this *WebsocketConnection) State() ConnectionState {
+	this.activeTimeL.Lock()
+	defer this.activeTimeL.Unlock()
+	return ConnectionState{
+		Id:             this.id,
+		Url:            this.connectedUrl,
+		ConnectedSince: this.connectedAt,
+		LastMessage:    this.lastMessage,
+		Reconnects:     atomic.LoadUint64(&this.reconnects),
+	}
+}
+
+func (this *WebsocketConnection) logger() *log.Entry {
+	return wsLog.WithField("conn_id", this.id)
 }
 
 func (this *WebsocketConnection) UpdateActiveTime() {
@@ -317,6 +411,13 @@ func (this *WebsocketConnection) UpdateActiveTime() {
 	this.activeTime = time.Now()
 }
 
+func (this *WebsocketConnection) notifyChannel(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
 func (this *WebsocketConnection) clearChannel(c chan struct{}) {
 	for {
 		if len(c) > 0 {